@@ -0,0 +1,439 @@
+package analyzer
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/lexer"
+	"jsInterpreter/logger"
+	"sort"
+)
+
+type ScopeKind uint8
+
+const (
+	//脚本的顶层
+	ScopeGlobal ScopeKind = iota
+	ScopeModule
+	//函数、箭头函数、类的方法和属性初始值，参数和函数体的顶层在同一个作用域
+	ScopeFunction
+	//{ }、for的头部、if/while/for的循环体
+	ScopeBlock
+	//catch (e) { }，参数和catch块在同一个作用域
+	ScopeCatch
+)
+
+type SymbolKind uint8
+
+const (
+	SymbolVar SymbolKind = iota
+	SymbolLet
+	SymbolConst
+	SymbolFunction
+	SymbolParam
+	SymbolClass
+	SymbolImport
+	SymbolCatch
+	//具名函数表达式的名字，只在函数内部可见
+	SymbolFunctionName
+)
+
+type Symbol struct {
+	Name  string
+	Kind  SymbolKind
+	Scope *Scope
+	//声明所在的语句或表达式的位置
+	Loc logger.Loc
+	//在声明之前就能读到值：var、函数声明、参数和import，let/const/class在声明之前处于TDZ
+	Hoisted bool
+	//被内层函数引用，函数返回之后变量还要继续存在
+	Captured   bool
+	References []*Reference
+}
+
+type Reference struct {
+	Name string
+	//export { a }中引用的名字没有对应的标识符，Id为nil
+	Id    *ast_parser.EIdentifier
+	Loc   logger.Loc
+	Write bool
+	//引用所在的作用域
+	Scope *Scope
+	//为nil时是没有声明的全局变量
+	Symbol *Symbol
+}
+
+type Scope struct {
+	Kind     ScopeKind
+	Parent   *Scope
+	Children []*Scope
+	Symbols  map[string]*Symbol
+	//按照声明顺序排列
+	Declared []*Symbol
+	//在这个块中声明、提升到外层函数的var，用来检查之后的let是否重复声明
+	hoistedVars map[string]bool
+}
+
+/*
+作用域分析的结果
+Scopes的key是创建作用域的节点：程序的*Stmt、函数的*Expr、类成员*ClassMember、
+块语句和for语句的*Stmt、循环和分支的*SBody，以及catch所在的try语句的*Stmt
+*/
+type Result struct {
+	Root       *Scope
+	Scopes     map[ast_parser.Node]*Scope
+	Symbols    map[*ast_parser.EIdentifier]*Symbol
+	References []*Reference
+	Unresolved []*Reference
+}
+
+//声明或引用这个标识符的Symbol
+func (r *Result) SymbolOf(id *ast_parser.EIdentifier) *Symbol {
+	return r.Symbols[id]
+}
+
+//没有声明就使用的全局变量
+func (r *Result) Globals() []string {
+	seen := map[string]bool{}
+	globals := []string{}
+	for _, ref := range r.Unresolved {
+		if !seen[ref.Name] {
+			seen[ref.Name] = true
+			globals = append(globals, ref.Name)
+		}
+	}
+	sort.Strings(globals)
+	return globals
+}
+
+//沿着作用域链查找名字
+func (s *Scope) Lookup(name string) *Symbol {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if symbol, has := scope.Symbols[name]; has {
+			return symbol
+		}
+	}
+	return nil
+}
+
+//var和函数声明提升到的作用域
+func (s *Scope) FunctionScope() *Scope {
+	scope := s
+	for scope.Kind != ScopeFunction && scope.Kind != ScopeGlobal && scope.Kind != ScopeModule {
+		scope = scope.Parent
+	}
+	return scope
+}
+
+func newScope(kind ScopeKind, parent *Scope) *Scope {
+	scope := &Scope{Kind: kind, Parent: parent, Symbols: map[string]*Symbol{}}
+	if parent != nil {
+		parent.Children = append(parent.Children, scope)
+	}
+	return scope
+}
+
+type analyzer struct {
+	result      *Result
+	diagnostics []logger.Diagnostic
+}
+
+/*
+分两遍进行：第一遍创建作用域、登记声明并记录所有引用，
+第二遍在声明全部登记完之后解析引用，这样提升的声明在使用之后出现也能找到
+*/
+func Analyze(program *ast_parser.Stmt, module bool) (*Result, []logger.Diagnostic) {
+	kind := ScopeGlobal
+	if module {
+		kind = ScopeModule
+	}
+	a := &analyzer{result: &Result{
+		Root:    newScope(kind, nil),
+		Scopes:  map[ast_parser.Node]*Scope{},
+		Symbols: map[*ast_parser.EIdentifier]*Symbol{},
+	}}
+	a.result.Scopes[program] = a.result.Root
+	ast_parser.Walk(visitor{a, a.result.Root}, program)
+
+	for _, ref := range a.result.References {
+		symbol := ref.Scope.Lookup(ref.Name)
+		if symbol == nil {
+			a.result.Unresolved = append(a.result.Unresolved, ref)
+			continue
+		}
+		ref.Symbol = symbol
+		symbol.References = append(symbol.References, ref)
+		if ref.Id != nil {
+			a.result.Symbols[ref.Id] = symbol
+		}
+		if ref.Scope.FunctionScope() != symbol.Scope.FunctionScope() {
+			symbol.Captured = true
+		}
+	}
+	return a.result, a.diagnostics
+}
+
+func isLexical(kind SymbolKind) bool {
+	switch kind {
+	case SymbolLet, SymbolConst, SymbolClass, SymbolImport:
+		return true
+	}
+	return false
+}
+
+func isHoisted(kind SymbolKind) bool {
+	switch kind {
+	case SymbolLet, SymbolConst, SymbolClass, SymbolCatch:
+		return false
+	}
+	return true
+}
+
+func (a *analyzer) redeclared(name string, loc logger.Loc) {
+	a.diagnostics = append(a.diagnostics, logger.Diagnostic{
+		Kind: logger.LError,
+		Loc:  loc,
+		Msg:  "Syntax Error: Identifier '" + name + "' has already been declared",
+	})
+}
+
+/*
+在scope中声明名字，重复声明的规则：
+let/const/class/import不能和同一个作用域中的任何声明重名，
+var、参数和函数体顶层的函数声明之间可以重名，块中的函数声明和let一样处理
+*/
+func (a *analyzer) declare(scope *Scope, id *ast_parser.EIdentifier, kind SymbolKind, loc logger.Loc) *Symbol {
+	name := id.Value
+	if kind == SymbolVar {
+		//var提升到函数作用域，经过的块中不能有同名的let
+		target := scope.FunctionScope()
+		for s := scope; s != target; s = s.Parent {
+			if existing, has := s.Symbols[name]; has && existing.Kind != SymbolCatch {
+				a.redeclared(name, loc)
+				break
+			}
+			if s.hoistedVars == nil {
+				s.hoistedVars = map[string]bool{}
+			}
+			s.hoistedVars[name] = true
+		}
+		scope = target
+	}
+	lexical := isLexical(kind) || (kind == SymbolFunction && scope.Kind == ScopeBlock)
+	if existing, has := scope.Symbols[name]; has && existing.Kind != SymbolFunctionName {
+		if lexical || isLexical(existing.Kind) || existing.Kind == SymbolCatch ||
+			(existing.Kind == SymbolFunction && scope.Kind == ScopeBlock) {
+			a.redeclared(name, loc)
+		} else if kind == SymbolFunction {
+			existing.Kind = SymbolFunction
+		}
+		a.result.Symbols[id] = existing
+		return existing
+	}
+	if lexical && scope.hoistedVars[name] {
+		a.redeclared(name, loc)
+	}
+	symbol := &Symbol{Name: name, Kind: kind, Scope: scope, Loc: loc, Hoisted: isHoisted(kind)}
+	if existing, has := scope.Symbols[name]; has {
+		//覆盖具名函数表达式的名字
+		for i := range scope.Declared {
+			if scope.Declared[i] == existing {
+				scope.Declared[i] = symbol
+			}
+		}
+	} else {
+		scope.Declared = append(scope.Declared, symbol)
+	}
+	scope.Symbols[name] = symbol
+	a.result.Symbols[id] = symbol
+	return symbol
+}
+
+func (a *analyzer) reference(scope *Scope, name string, id *ast_parser.EIdentifier, loc logger.Loc, write bool) {
+	a.result.References = append(a.result.References, &Reference{
+		Name:  name,
+		Id:    id,
+		Loc:   loc,
+		Write: write,
+		Scope: scope,
+	})
+}
+
+func varKind(kind ast_parser.VarKind) SymbolKind {
+	switch kind {
+	case ast_parser.VConst:
+		return SymbolConst
+	case ast_parser.VVar:
+		return SymbolVar
+	default:
+		return SymbolLet
+	}
+}
+
+type visitor struct {
+	a     *analyzer
+	scope *Scope
+}
+
+func (v visitor) walk(node ast_parser.Node) {
+	ast_parser.Walk(v, node)
+}
+
+func (v visitor) enter(kind ScopeKind, node ast_parser.Node) visitor {
+	scope := newScope(kind, v.scope)
+	v.a.result.Scopes[node] = scope
+	return visitor{v.a, scope}
+}
+
+/*
+函数：参数和函数体的顶层语句在同一个作用域，具名函数表达式的名字也放在这里，
+参数或者函数体中的声明和它重名时会覆盖它
+*/
+func (v visitor) function(node ast_parser.Node, name *ast_parser.EIdentifier, params []ast_parser.EIdentifier, body *ast_parser.SBody, loc logger.Loc) {
+	fn := v.enter(ScopeFunction, node)
+	if name != nil {
+		v.a.declare(fn.scope, name, SymbolFunctionName, loc)
+	}
+	for i := range params {
+		v.a.declare(fn.scope, &params[i], SymbolParam, loc)
+	}
+	for _, stmt := range body.Data.Data {
+		fn.walk(stmt)
+	}
+}
+
+func (v visitor) Visit(node ast_parser.Node) ast_parser.NodeVisitor {
+	switch n := node.(type) {
+	case *ast_parser.Stmt:
+		return v.stmt(n)
+	case *ast_parser.Expr:
+		return v.expr(n)
+	case *ast_parser.SBody:
+		return v.enter(ScopeBlock, n)
+	case *ast_parser.ClassMember:
+		//方法和属性的初始值都相当于一个函数
+		switch value := n.Value.(type) {
+		case *ast_parser.SFunctionDecl:
+			v.function(n, nil, value.Params, value.Body, n.Loc)
+		case *ast_parser.SVarDecl:
+			if value.Init != nil {
+				v.enter(ScopeFunction, n).walk(value.Init)
+			}
+		}
+		return nil
+	case *ast_parser.Property:
+		//不是计算属性时属性名不是引用
+		if n.Computed {
+			v.walk(&n.Key)
+		}
+		v.walk(&n.Value)
+		return nil
+	case *ast_parser.EIdentifier, nil:
+		//声明的名字在语句中处理，这里遇到的*EIdentifier都不是引用
+		return nil
+	}
+	return v
+}
+
+func (v visitor) stmt(stmt *ast_parser.Stmt) ast_parser.NodeVisitor {
+	switch s := stmt.Data.(type) {
+	case *ast_parser.SBlock:
+		return v.enter(ScopeBlock, stmt)
+	case *ast_parser.SFor:
+		return v.enter(ScopeBlock, stmt)
+	case *ast_parser.SVarDecl:
+		v.a.declare(v.scope, &s.Id, varKind(s.Kind()), stmt.Loc)
+		if s.Init != nil {
+			v.walk(s.Init)
+		}
+		return nil
+	case *ast_parser.SExpr:
+		//语句开头的具名function是函数声明
+		if fn, isFn := s.Data.(*ast_parser.EFunctionExpr); isFn && fn.Id != nil {
+			v.a.declare(v.scope, fn.Id, SymbolFunction, stmt.Loc)
+			v.function(&s.Expr, nil, fn.Params, fn.Body, s.Loc)
+			return nil
+		}
+	case *ast_parser.SFunctionDecl:
+		if s.Id != nil {
+			v.a.declare(v.scope, s.Id, SymbolFunction, stmt.Loc)
+		}
+		v.function(stmt, nil, s.Params, s.Body, stmt.Loc)
+		return nil
+	case *ast_parser.SClass:
+		v.a.declare(v.scope, &s.Id, SymbolClass, stmt.Loc)
+	case *ast_parser.STry:
+		v.walk(s.Block)
+		if s.Handler != nil {
+			catch := v.enter(ScopeCatch, stmt)
+			if s.Param != nil {
+				v.a.declare(catch.scope, s.Param, SymbolCatch, stmt.Loc)
+			}
+			for _, handlerStmt := range s.Handler.Data.Data {
+				catch.walk(handlerStmt)
+			}
+		}
+		if s.Finalizer != nil {
+			v.walk(s.Finalizer)
+		}
+		return nil
+	case *ast_parser.SImport:
+		if s.Default != nil {
+			v.a.declare(v.scope, s.Default, SymbolImport, stmt.Loc)
+		}
+		if s.Namespace != nil {
+			v.a.declare(v.scope, s.Namespace, SymbolImport, stmt.Loc)
+		}
+		for i := range s.Specifiers {
+			v.a.declare(v.scope, &s.Specifiers[i].Local, SymbolImport, stmt.Loc)
+		}
+		return nil
+	case *ast_parser.SExportDefault:
+		//export default function f() { }在模块中声明f
+		if fn, isFn := s.Expr.Data.(*ast_parser.EFunctionExpr); isFn && fn.Id != nil {
+			v.a.declare(v.scope, fn.Id, SymbolFunction, stmt.Loc)
+			v.function(&s.Expr, nil, fn.Params, fn.Body, s.Expr.Loc)
+			return nil
+		}
+	case *ast_parser.SExportNamed:
+		if s.Source == nil {
+			for _, specifier := range s.Specifiers {
+				v.a.reference(v.scope, specifier.Local, nil, stmt.Loc, false)
+			}
+		}
+		return nil
+	}
+	return v
+}
+
+func (v visitor) expr(expr *ast_parser.Expr) ast_parser.NodeVisitor {
+	switch e := expr.Data.(type) {
+	case *ast_parser.EIdentifier:
+		v.a.reference(v.scope, e.Value, e, expr.Loc, false)
+		return nil
+	case *ast_parser.EAssign:
+		if id, isId := e.Target.Data.(*ast_parser.EIdentifier); isId {
+			v.a.reference(v.scope, id.Value, id, e.Target.Loc, true)
+		} else {
+			v.walk(e.Target)
+		}
+		v.walk(e.Assignment)
+		return nil
+	case *ast_parser.EUnary:
+		//a++和--a同时读写a
+		op := lexer.T(e.Op)
+		if id, isId := e.Value.Data.(*ast_parser.EIdentifier); isId && (op == lexer.TPlusPlus || op == lexer.TMinusMinus) {
+			v.a.reference(v.scope, id.Value, id, e.Value.Loc, true)
+			return nil
+		}
+	case *ast_parser.EMemberExpr:
+		//a.b中的b不是引用
+		v.walk(&e.Obj)
+		return nil
+	case *ast_parser.EFunctionExpr:
+		v.function(expr, e.Id, e.Params, e.Body, expr.Loc)
+		return nil
+	case *ast_parser.EArrowFunction:
+		v.function(expr, nil, e.Params, e.Body, expr.Loc)
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"jsInterpreter/ast_parser"
+	"strings"
+	"testing"
+)
+
+func analyze(t *testing.T, code string, module bool) (*ast_parser.Stmt, *Result, []string) {
+	p := ast_parser.NewParser(code)
+	p.IsModule = module
+	ast, diagnostics := p.Parse()
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	result, errors := Analyze(&ast, module)
+	msgs := []string{}
+	for _, d := range errors {
+		msgs = append(msgs, d.Msg)
+	}
+	return &ast, result, msgs
+}
+
+func Test_Analyze(t *testing.T) {
+	_, result, errors := analyze(t, `
+let count = 0
+function inc(step) {
+	var total = count + step
+	count = total
+	return () => total
+}
+if (count) { let inner = 1; var hoisted = inner }
+try { f() } catch (e) { console.log(e, hoisted) }
+`, false)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	root := result.Root
+	names := []string{}
+	for _, symbol := range root.Declared {
+		names = append(names, symbol.Name)
+	}
+	if got := strings.Join(names, " "); got != "count inc hoisted" {
+		t.Errorf("unexpected global declarations: %s", got)
+	}
+
+	count := root.Symbols["count"]
+	if !count.Captured || count.Hoisted || len(count.References) != 3 {
+		t.Errorf("count: captured %v, hoisted %v, %d references", count.Captured, count.Hoisted, len(count.References))
+	}
+	writes := 0
+	for _, ref := range count.References {
+		if ref.Write {
+			writes++
+		}
+	}
+	if writes != 1 {
+		t.Errorf("expected 1 write to count, got %d", writes)
+	}
+	if !root.Symbols["inc"].Hoisted || root.Symbols["inc"].Kind != SymbolFunction {
+		t.Error("function declarations should be hoisted")
+	}
+	if root.Symbols["hoisted"].Kind != SymbolVar {
+		t.Error("var in block should be hoisted to the global scope")
+	}
+
+	fn := root.Children[0]
+	if fn.Kind != ScopeFunction || fn.Symbols["step"].Kind != SymbolParam {
+		t.Error("params should be declared in the function scope")
+	}
+	if !fn.Symbols["total"].Captured || fn.Symbols["step"].Captured {
+		t.Error("only variables used by the arrow function are captured")
+	}
+	if got := strings.Join(result.Globals(), " "); got != "console f" {
+		t.Errorf("unexpected globals: %s", got)
+	}
+}
+
+func Test_AnalyzeShadowing(t *testing.T) {
+	ast, result, _ := analyze(t, "let a = 1\n{ let a = 2; a }\na", false)
+	body := ast.Data.(*ast_parser.SProgram).Body
+	outer := result.SymbolOf(&body[0].Data.(*ast_parser.SVarDecl).Id)
+	block := body[1].Data.(*ast_parser.SBlock)
+	inner := result.SymbolOf(&block.Data[0].Data.(*ast_parser.SVarDecl).Id)
+	if outer == inner || result.Scopes[body[1]] != inner.Scope {
+		t.Fatal("block should create a new scope")
+	}
+	innerRef := block.Data[1].Data.(*ast_parser.SExpr).Data.(*ast_parser.EIdentifier)
+	outerRef := body[2].Data.(*ast_parser.SExpr).Data.(*ast_parser.EIdentifier)
+	if result.SymbolOf(innerRef) != inner || result.SymbolOf(outerRef) != outer {
+		t.Error("references should resolve to the nearest declaration")
+	}
+}
+
+func Test_AnalyzeRedeclaration(t *testing.T) {
+	cases := map[string]int{
+		"let a; let a":                        1,
+		"let a; var a":                        1,
+		"var a; var a":                        0,
+		"var a; function a() {}":              0,
+		"function f(a) { let a }":             1,
+		"function f(a) { var a }":             0,
+		"{ let a; { var a } }":                1,
+		"{ { var a } let a }":                 1,
+		"{ function a() {} function a() {} }": 1,
+		"try {} catch (e) { let e }":          1,
+		"try {} catch (e) { var e }":          0,
+		"let f = function a() { let a }":      0,
+		"class A {} let A":                    1,
+	}
+	for code, expected := range cases {
+		_, _, errors := analyze(t, code, false)
+		if len(errors) != expected {
+			t.Errorf("%s: expected %d errors, got %v", code, expected, errors)
+		}
+	}
+	_, _, errors := analyze(t, "import { a } from \"m\"\nlet a", true)
+	if len(errors) != 1 {
+		t.Errorf("import should conflict with let, got %v", errors)
+	}
+}
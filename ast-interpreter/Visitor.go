@@ -3,183 +3,384 @@ package ast_interpreter
 import (
 	"jsInterpreter/ast_parser"
 	"jsInterpreter/lexer"
+	"jsInterpreter/logger"
+	"math"
 	"strconv"
 )
 
 type Visitor interface {
 	//statement
-	VisitProgram(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitVarDeclStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitFuncStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitReturnStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitConditionStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitForLoopStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitBreakStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitContinueStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitBlockStmt(s *ast_parser.Stmt, stat *InterpreterStat)
-	VisitStmts(stmts []*ast_parser.Stmt, stat *InterpreterStat)
+	VisitProgram(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitVarDeclStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitFuncStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitReturnStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitConditionStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitForLoopStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitLabeledStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitBreakStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitContinueStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitBlockStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitThrowStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitTryStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitExportStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion
+	VisitStmts(stmts []*ast_parser.Stmt, stat *InterpreterStat) Completion
 
 	//expression
-	VisitExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitFuncExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitCallExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitNumericLiteral(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitStringLiteral(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitBoolLiteral(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitBinaryExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitUnaryExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitMemberExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitParen(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitFunctionExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitAssignExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitArrayExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitObjectExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
-	VisitIndexExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue
+	VisitExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitFuncExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitCallExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitNumericLiteral(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitStringLiteral(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitBoolLiteral(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitBinaryExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitConditionalExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitUnaryExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitMemberExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitParen(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitFunctionExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitAssignExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitSequenceExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitArrayExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitObjectExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitIndexExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitYieldExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitAwaitExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitArrowFunction(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitNewExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue
+	VisitImportCall(e *ast_parser.Expr, stat *InterpreterStat) JsValue
 }
 
 type IVisitor struct{}
 
-func (v *IVisitor) VisitProgram(s *ast_parser.Stmt, stat *InterpreterStat) {
-	for _, stmt := range s.Data.(*ast_parser.SProgram).Body {
-		EvaluateStmt(stmt, stat)
-	}
+func (v *IVisitor) VisitProgram(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	program := s.Data.(*ast_parser.SProgram)
+	stat.Strict = program.Strict
+	hoistDeclarations(program.Body, stat, true)
+	return evaluateStmts(program.Body, stat)
 }
 
-func (v *IVisitor) VisitBlockStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
-	for _, stmt := range s.Data.(*ast_parser.SBlock).Data {
-		EvaluateStmt(stmt, stat)
-	}
+func (v *IVisitor) VisitBlockStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	return evaluateBlock(s.Data.(*ast_parser.SBlock), stat)
 }
 
-func (v *IVisitor) VisitForLoopStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
-	stat.EnterScope()
-	defer func() {
-		stat.PopScope()
-		err := recover()
-		if err != nil {
-			switch err.(type) {
-			case ast_parser.SBreak:
-			case ast_parser.SContinue:
-			default:
-				panic(err)
+func (v *IVisitor) VisitForLoopStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	return runLoop(s.Data.(*ast_parser.SFor), nil, stat)
+}
+
+/*
+labels是循环语句前的标签，continue label只能作用于带这个标签的循环，
+循环体的完成记录决定是否继续循环：break结束循环，continue执行reset后进入下一次循环，
+标签不属于这个循环的break/continue和return、throw一起传给外层
+头部声明的let每次循环都是新的变量：执行条件之前复制一份头部的作用域，
+之前循环中创建的闭包仍然引用上一次的变量
+*/
+func runLoop(forLoop *ast_parser.SFor, labels []string, stat *InterpreterStat) Completion {
+	parent := stat.EnterScope(forLoop.Layout)
+	defer stat.LeaveScope(parent)
+	perIteration := stat.Scope != parent
+	if c := EvaluateStmt(forLoop.Initializer, stat); c.Abrupt() {
+		return c
+	}
+	if perIteration {
+		stat.Scope = stat.Scope.copyBindings()
+	}
+	//for(;;)没有条件，一直循环
+	for forLoop.Condition.Data == nil || IsTruthy(EvaluateExpr(forLoop.Condition, stat)) {
+		//每次循环至少算一步，for(;;){}同样会用完执行预算
+		stat.Runtime.Step()
+		c := evaluateBlock(forLoop.Body.Data, stat)
+		switch c.Type {
+		case CompletionBreak:
+			if targetsLoop(c, labels) {
+				return Completion{}
 			}
+			return c
+		case CompletionContinue:
+			if !targetsLoop(c, labels) {
+				return c
+			}
+		case CompletionReturn, CompletionThrow:
+			return c
 		}
-	}()
-	forLoop := s.Data.(*ast_parser.SFor)
-	EvaluateStmt(forLoop.Initializer, stat)
-	runLoop(forLoop, stat)
-}
-
-func runLoop(forLoop *ast_parser.SFor, stat *InterpreterStat) {
-	defer func() {
-		err := recover()
-		switch err.(type) {
-		case ast_parser.SContinue:
-			EvaluateStmt(forLoop.Reset, stat)
-			runLoop(forLoop, stat)
-		case ast_parser.SBreak: //do nothing
-		case nil: //do nothing
-		default:
-			panic(err)
-		}
-	}()
-	for IsTruthy(EvaluateExpr(forLoop.Condition, stat)) {
-		for _, stmt := range forLoop.Body.Data.Data {
-			EvaluateStmt(stmt, stat)
+		if perIteration {
+			stat.Scope = stat.Scope.copyBindings()
 		}
 		EvaluateStmt(forLoop.Reset, stat)
 	}
+	return Completion{}
 }
 
-func (v *IVisitor) VisitBreakStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
-	panic(ast_parser.SBreak{})
+/*
+a: b: for (...) 连续的标签都属于同一个语句，循环语句需要知道自己的标签来处理continue label，
+其他语句只需要在这里结束break label
+*/
+func (v *IVisitor) VisitLabeledStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	var labels []string
+	body := s
+	for {
+		labeled, isLabeled := body.Data.(*ast_parser.SLabeled)
+		if !isLabeled {
+			break
+		}
+		labels = append(labels, labeled.Label)
+		body = labeled.Body
+	}
+	var c Completion
+	if forLoop, isLoop := body.Data.(*ast_parser.SFor); isLoop {
+		c = runLoop(forLoop, labels, stat)
+	} else {
+		c = EvaluateStmt(body, stat)
+	}
+	if c.Type == CompletionBreak && hasLabel(labels, c.Label) {
+		return Completion{}
+	}
+	return c
 }
-func (v *IVisitor) VisitContinueStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
-	panic(ast_parser.SContinue{})
+
+func (v *IVisitor) VisitBreakStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	return Completion{Type: CompletionBreak, Label: s.Data.(*ast_parser.SBreak).Label}
+}
+func (v *IVisitor) VisitContinueStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	return Completion{Type: CompletionContinue, Label: s.Data.(*ast_parser.SContinue).Label}
 }
 
-func (v *IVisitor) VisitConditionStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
-	stat.EnterScope()
-	defer func() {
-		stat.PopScope()
-	}()
+func (v *IVisitor) VisitConditionStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
 	conditionStmt := s.Data.(*ast_parser.SCondition)
 	for _, branch := range conditionStmt.Branches {
-		if IsTruthy(EvaluateExpr(branch.Condition, stat)) {
-			v.VisitStmts(branch.Body.Data.Data, stat)
-			break
+		//else分支没有条件
+		if branch.Condition == nil || IsTruthy(EvaluateExpr(branch.Condition, stat)) {
+			return evaluateBlock(branch.Body.Data, stat)
 		}
 	}
+	return Completion{}
 }
 
-func (v *IVisitor) VisitFuncStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
+func (v *IVisitor) VisitFuncStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
 	fnDecl := s.Data.(*ast_parser.SFunctionDecl)
-	fn := NewJsValue(JsFunction{
-		Closure: stat.Scope,
-		Params:  fnDecl.Params,
-		Body:    fnDecl.Body,
+	fn := NewJsValue(&JsFunction{
+		Closure:   stat.Scope,
+		Params:    fnDecl.Params,
+		Body:      fnDecl.Body,
+		Generator: fnDecl.Generator,
+		Async:     fnDecl.Async,
 	})
 
-	if fnDecl.Id != nil {
+	if fnDecl.Id != nil && fnDecl.Id.Resolved {
+		stat.Scope.Slots[fnDecl.Id.Index] = *fn
+	} else if fnDecl.Id != nil {
 		stat.Scope.Set(fnDecl.Id.Value, fn)
 	}
+	return Completion{}
+}
+
+func (v *IVisitor) VisitReturnStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	ret := s.Data.(*ast_parser.SReturn)
+	e := &ret.Expr
+	for ret.Tail {
+		paren, isParen := e.Data.(*ast_parser.EParen)
+		if !isParen {
+			break
+		}
+		e = &paren.Data
+	}
+	if _, isCall := e.Data.(*ast_parser.ECallExpr); isCall && ret.Tail {
+		return tailCallCompletion(e, stat)
+	}
+	value := EvaluateExpr(&ret.Expr, stat)
+	return Completion{Type: CompletionReturn, Value: &value}
 }
 
-func (v *IVisitor) VisitReturnStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
-	panic(EvaluateExpr(&s.Data.(*ast_parser.SReturn).Expr, stat))
+//return f()中的f是普通的JS函数时把调用交给Call执行，其他函数直接调用
+func tailCallCompletion(e *ast_parser.Expr, stat *InterpreterStat) Completion {
+	defer fillLoc(e.Loc)
+	callee, this, args := evaluateCall(e, stat)
+	if f, isFn := callee.Value.(*JsFunction); isFn && !f.Generator && !f.Async {
+		return Completion{Type: CompletionReturn, Value: &JsValue{Value: &tailCall{f, this, args}, Type: Undefined}}
+	}
+	return Completion{Type: CompletionReturn, Value: stat.CallFunction(&callee, this, args)}
+}
+
+func (v *IVisitor) VisitThrowStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	value := EvaluateExpr(&s.Data.(*ast_parser.SThrow).Expr, stat)
+	return throwCompletion(value, s.Loc)
+}
+
+/*
+try中的throw完成记录和抛出的JsException、RuntimeError会被catch，return、break等直接穿过，
+无论怎样离开try/catch，finally都会执行，finally中的return、throw等会覆盖原来的结果，
+generator被return()时的panic也会经过finally
+*/
+func (v *IVisitor) VisitTryStmt(s *ast_parser.Stmt, stat *InterpreterStat) (completion Completion) {
+	tryStmt := s.Data.(*ast_parser.STry)
+	scope := stat.Scope
+	if tryStmt.Finalizer != nil {
+		defer func() {
+			err := recover()
+			//超出执行预算时不再执行finally，否则finally中的return会让脚本继续执行
+			//被丢弃的generator退出时同样不执行finally
+			switch err.(type) {
+			case LimitError, generatorAbandoned:
+				panic(err)
+			}
+			stat.Scope = scope
+			if final := v.visitBlockBody(tryStmt.Finalizer, stat, nil); final.Abrupt() {
+				completion = final
+				return
+			}
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+
+	completion = catchCompletion(func() Completion {
+		return v.visitBlockBody(tryStmt.Block, stat, nil)
+	})
+	if completion.Type != CompletionThrow || tryStmt.Handler == nil {
+		return completion
+	}
+	stat.Scope = scope
+	value := completion.Value
+	return v.visitBlockBody(tryStmt.Handler, stat, func() {
+		if tryStmt.Param != nil && tryStmt.Param.Resolved {
+			stat.Scope.Slots[tryStmt.Param.Index] = *value
+		} else if tryStmt.Param != nil {
+			stat.Scope.Set(tryStmt.Param.Value, value)
+		}
+	})
 }
 
-func (v *IVisitor) VisitStmts(stmts []*ast_parser.Stmt, stat *InterpreterStat) {
-	for _, stmt := range stmts {
-		EvaluateStmt(stmt, stat)
+//在新的块级作用域中执行body，init用来在作用域中声明变量，例如catch的参数
+func (v *IVisitor) visitBlockBody(body *ast_parser.SBody, stat *InterpreterStat, init func()) Completion {
+	defer stat.LeaveScope(stat.EnterScope(body.Data.Layout))
+	if init != nil {
+		init()
 	}
+	hoistDeclarations(body.Data.Data, stat, false)
+	return v.VisitStmts(body.Data.Data, stat)
 }
 
-func (v *IVisitor) VisitVarDeclStmt(s *ast_parser.Stmt, stat *InterpreterStat) {
+func (v *IVisitor) VisitStmts(stmts []*ast_parser.Stmt, stat *InterpreterStat) Completion {
+	return evaluateStmts(stmts, stat)
+}
+
+func (v *IVisitor) VisitVarDeclStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
 	varDecl := s.Data.(*ast_parser.SVarDecl)
+	value := JsValue{Type: Undefined}
 	if varDecl.Init != nil {
-		stat.Scope.Set(varDecl.Id.Value, EvaluateExpr(varDecl.Init, stat))
-	} else {
-		stat.Scope.Set(varDecl.Id.Value, &JsValue{nil, Undefined})
+		value = EvaluateExpr(varDecl.Init, stat)
 	}
+	switch varDecl.Kind() {
+	case ast_parser.VVar:
+		//var已经被提升到函数作用域，这里只是赋值
+		if varDecl.Init != nil {
+			stat.assignIdentifier(&varDecl.Id, &value, s.Loc)
+		}
+	case ast_parser.VConst:
+		if varDecl.Id.Resolved {
+			//let/const的位置就在当前作用域
+			stat.Scope.Slots[varDecl.Id.Index] = value
+			break
+		}
+		stat.Scope.Declare(varDecl.Id.Value, &value)
+		stat.Scope.SetConst(varDecl.Id.Value, true)
+	default:
+		if varDecl.Id.Resolved {
+			stat.Scope.Slots[varDecl.Id.Index] = value
+			break
+		}
+		stat.Scope.Declare(varDecl.Id.Value, &value)
+		stat.Scope.SetConst(varDecl.Id.Value, false)
+	}
+	return Completion{}
 }
 
 /****************/
 /** expression **/
 /****************/
-func (v *IVisitor) VisitExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	return EvaluateExpr(e, stat)
 }
 
-func (v *IVisitor) VisitBinaryExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitBinaryExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	binaryExpr := e.Data.(*ast_parser.EBinary)
 	op := binaryExpr.Op
 
 	lValue := EvaluateExpr(&binaryExpr.Left, stat)
+
+	//逻辑运算符短路，右侧只在需要时求值
+	switch op {
+	case ast_parser.EOp(lexer.TAmpersandAmpersand):
+		if !IsTruthy(lValue) {
+			return lValue
+		}
+		return EvaluateExpr(&binaryExpr.Right, stat)
+	case ast_parser.EOp(lexer.TBarBar):
+		if IsTruthy(lValue) {
+			return lValue
+		}
+		return EvaluateExpr(&binaryExpr.Right, stat)
+	case ast_parser.EOp(lexer.TQuestionQuestion):
+		if lValue.Type != Undefined && lValue.Type != Null {
+			return lValue
+		}
+		return EvaluateExpr(&binaryExpr.Right, stat)
+	}
+
 	rValue := EvaluateExpr(&binaryExpr.Right, stat)
+	return BinaryOperation(op, lValue, rValue, e.Loc, stat)
+}
 
+//除了&&、||、??以外的二元运算，两侧都已经求值，字节码虚拟机也使用它
+func BinaryOperation(op ast_parser.EOp, lValue JsValue, rValue JsValue, loc logger.Loc, stat *InterpreterStat) JsValue {
 	switch op {
 	case
 		ast_parser.EOp(lexer.TMinus),
 		ast_parser.EOp(lexer.TSlash),
 		ast_parser.EOp(lexer.TAsterisk),
-		ast_parser.EOp(lexer.TPercent):
-		lNum := ToNumber(lValue).Value.(float64)
-		rNum := ToNumber(rValue).Value.(float64)
+		ast_parser.EOp(lexer.TPercent),
+		ast_parser.EOp(lexer.TAsteriskAsterisk):
+		lNum := ToNumber(&lValue).num
+		rNum := ToNumber(&rValue).num
 
 		switch op {
 		case
 			ast_parser.EOp(lexer.TMinus):
-			return &JsValue{lNum - rNum, Number}
+			return JsValue{Type: Number, num: lNum - rNum}
 		case ast_parser.EOp(lexer.TSlash):
-			return &JsValue{lNum / rNum, Number}
+			return JsValue{Type: Number, num: lNum / rNum}
 		case ast_parser.EOp(lexer.TAsterisk):
-			return &JsValue{lNum * rNum, Number}
+			return JsValue{Type: Number, num: lNum * rNum}
 		case ast_parser.EOp(lexer.TPercent):
-			return &JsValue{int(lNum) % int(rNum), Number}
+			return JsValue{Type: Number, num: math.Mod(lNum, rNum)}
+		case ast_parser.EOp(lexer.TAsteriskAsterisk):
+			return JsValue{Type: Number, num: math.Pow(lNum, rNum)}
+		default:
+			panic(RuntimeError{loc, "operand not allowed"})
+		}
+	case
+		ast_parser.EOp(lexer.TAmpersand),
+		ast_parser.EOp(lexer.TBar),
+		ast_parser.EOp(lexer.TCaret),
+		ast_parser.EOp(lexer.TLessThanLessThan),
+		ast_parser.EOp(lexer.TGreaterThanGreaterThan):
+		//位运算的操作数先转换成32位整数
+		lInt := ToInt32(&lValue)
+		rInt := ToInt32(&rValue)
+		switch op {
+		case ast_parser.EOp(lexer.TAmpersand):
+			return JsValue{Type: Number, num: float64(lInt & rInt)}
+		case ast_parser.EOp(lexer.TBar):
+			return JsValue{Type: Number, num: float64(lInt | rInt)}
+		case ast_parser.EOp(lexer.TCaret):
+			return JsValue{Type: Number, num: float64(lInt ^ rInt)}
+		case ast_parser.EOp(lexer.TLessThanLessThan):
+			return JsValue{Type: Number, num: float64(lInt << (uint32(rInt) & 31))}
 		default:
-			panic(RuntimeError{e.Loc, "operand not allowed"})
+			return JsValue{Type: Number, num: float64(lInt >> (uint32(rInt) & 31))}
 		}
+	case ast_parser.EOp(lexer.TGreaterThanGreaterThanGreaterThan):
+		return JsValue{Type: Number, num: float64(uint32(ToInt32(&lValue)) >> (uint32(ToInt32(&rValue)) & 31))}
 	case ast_parser.EOp(lexer.TPlus):
 		isStringPlus := false
 		//判断是否是字符串相加
@@ -196,200 +397,442 @@ func (v *IVisitor) VisitBinaryExpr(e *ast_parser.Expr, stat *InterpreterStat) *J
 
 	Calc:
 		if isStringPlus {
-			return &JsValue{ToString(lValue).Value.(string) + ToString(rValue).Value.(string), String}
+			result := concatStrings(stringOperand(&lValue), stringOperand(&rValue))
+			if stat != nil {
+				stat.Runtime.allocString(&result)
+			}
+			return result
 		} else {
-			lNum := ToNumber(lValue)
-			return &JsValue{lNum.Value.(float64) + ToNumber(rValue).Value.(float64), Number}
+			return JsValue{Type: Number, num: ToNumber(&lValue).num + ToNumber(&rValue).num}
+		}
+	case ast_parser.EOp(lexer.TEqualsEquals), ast_parser.EOp(lexer.TEqualsEqualsEquals):
+		return JsValue{
+			Value: StrictEquals(&lValue, &rValue),
+			Type:  Boolean,
 		}
-	case ast_parser.EOp(lexer.TEqualsEquals):
-		return &JsValue{
-			Value: lValue.Type == rValue.Type && lValue.Value == rValue.Value,
+	case ast_parser.EOp(lexer.TExclamationEquals), ast_parser.EOp(lexer.TExclamationEqualsEquals):
+		return JsValue{
+			Value: !StrictEquals(&lValue, &rValue),
 			Type:  Boolean,
 		}
+	case ast_parser.EOp(lexer.TIn):
+		//右边是原始值时抛出TypeError，函数、promise等内置的值都是对象
+		switch rValue.Type {
+		case Undefined, Null, Number, String, Boolean:
+			panic(RuntimeError{loc, "TypeError: Cannot use 'in' operator to search for '" + ToPropertyKey(&lValue) + "' in " + ToString(&rValue).Value.(string)})
+		}
+		return JsValue{Value: stat.HasProperty(&rValue, ToPropertyKey(&lValue)), Type: Boolean}
+	case ast_parser.EOp(lexer.TInstanceof):
+		return JsValue{Value: InstanceOf(&lValue, &rValue, loc), Type: Boolean}
 	case ast_parser.EOp(lexer.TLessThan),
 		ast_parser.EOp(lexer.TGreaterThan),
 		ast_parser.EOp(lexer.TLessThanEquals),
 		ast_parser.EOp(lexer.TGreaterThanEquals):
 		if lValue.Type != rValue.Type {
-			panic(RuntimeError{e.Loc, "left type mismatch right type"})
+			panic(RuntimeError{loc, "left type mismatch right type"})
 		}
 		if lValue.Type != Number {
-			panic(RuntimeError{e.Loc, "type must be number"})
+			panic(RuntimeError{loc, "type must be number"})
 		}
 		switch op {
 		case ast_parser.EOp(lexer.TLessThan):
-			return &JsValue{lValue.Value.(float64) < rValue.Value.(float64), Boolean}
+			return JsValue{Value: lValue.num < rValue.num, Type: Boolean}
 		case ast_parser.EOp(lexer.TGreaterThan):
-			return &JsValue{lValue.Value.(float64) > rValue.Value.(float64), Boolean}
+			return JsValue{Value: lValue.num > rValue.num, Type: Boolean}
 		case ast_parser.EOp(lexer.TLessThanEquals):
-			return &JsValue{lValue.Value.(float64) <= rValue.Value.(float64), Boolean}
+			return JsValue{Value: lValue.num <= rValue.num, Type: Boolean}
 		case ast_parser.EOp(lexer.TGreaterThanEquals):
-			return &JsValue{lValue.Value.(float64) >= rValue.Value.(float64), Boolean}
+			return JsValue{Value: lValue.num >= rValue.num, Type: Boolean}
 		default:
-			return &JsValue{false, Boolean}
+			return JsValue{Value: false, Type: Boolean}
 		}
 	default:
-		panic(RuntimeError{e.Loc, "unknown operator"})
+		panic(RuntimeError{loc, "unknown operator"})
 	}
 }
 
-func (v *IVisitor) VisitUnaryExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitConditionalExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	conditional := e.Data.(*ast_parser.EConditional)
+	if IsTruthy(EvaluateExpr(&conditional.Test, stat)) {
+		return EvaluateExpr(&conditional.Consequent, stat)
+	}
+	return EvaluateExpr(&conditional.Alternate, stat)
+}
+
+func (v *IVisitor) VisitUnaryExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	unary := e.Data.(*ast_parser.EUnary)
 
+	if unary.Op == ast_parser.EOp(lexer.TDelete) {
+		return deleteProperty(&unary.Value, stat)
+	}
+
+	//typeof对没有声明的变量返回"undefined"，不抛出ReferenceError
+	if id, isId := unary.Value.Data.(*ast_parser.EIdentifier); isId && unary.Op == ast_parser.EOp(lexer.TTypeof) {
+		if !id.Resolved && stat.LookupVariable(id.Value) == nil {
+			return JsValue{Value: "undefined", Type: String}
+		}
+	}
 	val := EvaluateExpr(&unary.Value, stat)
 
 	switch unary.Op {
-	case ast_parser.EOp(lexer.TExclamation):
-		return &JsValue{!ToBoolean(val).Value.(bool), Boolean}
 	case
 		ast_parser.EOp(lexer.TPlusPlus),
 		ast_parser.EOp(lexer.TMinusMinus):
 
-		if val.Type != Number {
-			panic(RuntimeError{e.Loc, "this operator need number operand"})
-		}
-		target := 1.0
-		if unary.Op == ast_parser.EOp(lexer.TMinusMinus) {
-			target = -1.0
-		}
-
-		nextVal := &JsValue{
-			Value: val.Value.(float64) + target,
-			Type:  Number,
-		}
+		nextVal := UpdateOperation(unary.Op, val, e.Loc)
 
 		switch t := unary.Value.Data.(type) {
 		case *ast_parser.EIdentifier:
-			key := t.Value
-			if unary.Association == ast_parser.AssociationRight {
-				defer func() {
-					stat.Scope.Update(key, nextVal)
-				}()
-				return val
-			}
-
-			return stat.Scope.Update(key, nextVal)
+			stat.assignIdentifier(t, &nextVal, e.Loc)
 		case *ast_parser.EMemberExpr:
-			val.Value = nextVal.Value
-			return nextVal
+			obj := EvaluateExpr(&t.Obj, stat)
+			stat.SetProperty(&obj, t.Property.Value, &nextVal)
 		default:
 			panic(RuntimeError{e.Loc, "unknown type"})
 		}
+		//后置的++、--返回原来的值
+		if unary.Association == ast_parser.AssociationRight {
+			return val
+		}
+		return nextVal
+
+	default:
+		return UnaryOperation(unary.Op, val, e.Loc)
+	}
+}
+
+//字符串拼接的一侧，字符串原样使用，不拼接rope
+func stringOperand(v *JsValue) interface{} {
+	if v.Type == String {
+		return v.Value
+	}
+	return ToString(v).Value
+}
+
+//除了++、--和delete以外的一元运算
+func UnaryOperation(op ast_parser.EOp, val JsValue, loc logger.Loc) JsValue {
+	switch op {
+	case ast_parser.EOp(lexer.TExclamation):
+		return JsValue{Value: !IsTruthy(val), Type: Boolean}
+	case ast_parser.EOp(lexer.TMinus):
+		return JsValue{Type: Number, num: -ToNumber(&val).num}
+	case ast_parser.EOp(lexer.TPlus):
+		return ToNumber(&val)
+	case ast_parser.EOp(lexer.TTilde):
+		return JsValue{Type: Number, num: float64(^ToInt32(&val))}
+	case ast_parser.EOp(lexer.TTypeof):
+		return JsValue{Value: TypeOf(&val), Type: String}
+	case ast_parser.EOp(lexer.TVoid):
+		return JsValue{Type: Undefined}
+	default:
+		panic(RuntimeError{loc, "unknown unary operator"})
+	}
+}
+
+//++和--的新值，只能用于数字
+func UpdateOperation(op ast_parser.EOp, val JsValue, loc logger.Loc) JsValue {
+	if val.Type != Number {
+		panic(RuntimeError{loc, "this operator need number operand"})
+	}
+	target := 1.0
+	if op == ast_parser.EOp(lexer.TMinusMinus) {
+		target = -1.0
+	}
+	return JsValue{Type: Number, num: val.num + target}
+}
 
+//delete obj.key / delete obj[key]，只删除对象自身的属性，其他情况返回true
+func deleteProperty(target *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	var obj JsValue
+	var key string
+	switch t := target.Data.(type) {
+	case *ast_parser.EMemberExpr:
+		obj = EvaluateExpr(&t.Obj, stat)
+		key = t.Property.Value
+	case *ast_parser.EIndex:
+		obj = EvaluateExpr(&t.Target, stat)
+		idx := EvaluateExpr(&t.Idx, stat)
+		key = ToPropertyKey(&idx)
+	case *ast_parser.EIdentifier:
+		//声明的变量不能删除，非严格模式下赋值创建的全局变量是全局对象的属性，可以删除
+		if t.Resolved || stat.Scope.Get(t.Value) != nil {
+			return JsValue{Value: false, Type: Boolean}
+		}
+		obj, key = *stat.Runtime.Global, t.Value
 	default:
-		panic(RuntimeError{e.Loc, "unknown unary operator"})
+		EvaluateExpr(target, stat)
+		return JsValue{Value: true, Type: Boolean}
+	}
+	return JsValue{Value: DeleteProperty(&obj, key, target.Loc), Type: Boolean}
+}
+
+//删除obj上的属性，对象以外的值上删除属性没有效果
+func DeleteProperty(obj *JsValue, key string, loc logger.Loc) bool {
+	switch obj.Type {
+	case Object:
+		o := obj.Value.(*JsObject)
+		if o.readOnly[key] {
+			return false
+		}
+		o.Delete(key)
+	case Undefined, Null:
+		panic(RuntimeError{loc, "Cannot convert undefined or null to object"})
 	}
+	return true
 }
 
-func (v *IVisitor) VisitFuncExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitFuncExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	fnDecl := e.Data.(*ast_parser.EFunctionExpr)
-	fn := &JsValue{&JsFunction{
-		Closure: stat.Scope,
-		Params:  fnDecl.Params,
-		Body:    fnDecl.Body,
-	}, Function}
-	if fnDecl.Id != nil {
-		stat.Scope.Set(fnDecl.Id.Value, fn)
+	fn := JsValue{Value: &JsFunction{
+		Closure:   stat.Scope,
+		Params:    fnDecl.Params,
+		Body:      fnDecl.Body,
+		Generator: fnDecl.Generator,
+		Async:     fnDecl.Async,
+	}, Type: Function}
+	if fnDecl.Id != nil && fnDecl.Body.Data.Layout != nil {
+		//经过作用域分析时名字在函数自己的作用域中，调用时绑定；被参数或var覆盖时没有解析
+		if fnDecl.Id.Resolved {
+			fn.Value.(*JsFunction).Name = fnDecl.Id
+		}
+	} else if fnDecl.Id != nil {
+		//具名函数表达式的名字只在函数内部可见，函数声明在进入作用域时已经创建好了
+		closure := NewScope(stat.Scope)
+		closure.Set(fnDecl.Id.Value, &fn)
+		fn.Value.(*JsFunction).Closure = closure
 	}
 	return fn
 }
 
-func (v *IVisitor) VisitCallExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitCallExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
+	calleeValue, _this, args := evaluateCall(e, stat)
+	return *stat.CallFunction(&calleeValue, _this, args)
+}
+
+//计算被调用的函数、this和参数
+func evaluateCall(e *ast_parser.Expr, stat *InterpreterStat) (JsValue, JsValue, []JsValue) {
 	callExpr := e.Data.(*ast_parser.ECallExpr)
-	calleeValue := EvaluateExpr(&callExpr.Callee, stat)
-	if calleeValue.Type != Function && calleeValue.Type != BuiltInFunction {
-		panic(RuntimeError{e.Loc, " is not a function"})
-	}
 
-	//找到"this"
-	var _this JsValue = JsValue{nil, Undefined}
+	//找到"this"，a.b()和a[b]()的this是a
+	var _this JsValue = JsValue{Type: Undefined}
+	var calleeValue JsValue
 	switch callee := callExpr.Callee.Data.(type) {
 	case *ast_parser.EMemberExpr:
-		//这里对于基本类型进行装箱
-		_this = *EvaluateExpr(&callee.Obj, stat)
+		_this = EvaluateExpr(&callee.Obj, stat)
+		calleeValue = *stat.GetProperty(&_this, callee.Property.Value)
+	case *ast_parser.EIndex:
+		_this = EvaluateExpr(&callee.Target, stat)
+		idx := EvaluateExpr(&callee.Idx, stat)
+		calleeValue = *stat.GetProperty(&_this, ToPropertyKey(&idx))
+	default:
+		calleeValue = EvaluateExpr(&callExpr.Callee, stat)
+	}
+	if calleeValue.Type != Function && calleeValue.Type != BuiltInFunction && calleeValue.Type != BuiltInClass {
+		panic(RuntimeError{e.Loc, " is not a function"})
 	}
 
 	args := []JsValue{}
 	for _, arg := range callExpr.Args {
-		_arg := EvaluateExpr(arg, stat)
-		args = append(args, *_arg)
+		args = append(args, EvaluateExpr(arg, stat))
 	}
 
-	if calleeValue.Type == BuiltInFunction {
-		result := calleeValue.Value.(func(JsValue, ...JsValue) JsValue)(_this, args...)
-		return &result
-	} else {
-		callee := calleeValue.Value.(*JsFunction)
-		return stat.Call(callee, args)
-	}
+	stat.Runtime.CallSite = e.Loc
+	return calleeValue, _this, args
 }
 
-func (v *IVisitor) VisitFunctionExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitFunctionExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	fnExpr := e.Data.(*ast_parser.EFunctionExpr)
-	return &JsValue{&JsFunction{
+	return JsValue{Value: &JsFunction{
+		Closure:   stat.Scope,
+		Params:    fnExpr.Params,
+		Body:      fnExpr.Body,
+		Generator: fnExpr.Generator,
+		Async:     fnExpr.Async,
+	}, Type: Function}
+}
+
+func (v *IVisitor) VisitArrowFunction(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	arrow := e.Data.(*ast_parser.EArrowFunction)
+	return JsValue{Value: &JsFunction{
 		Closure: stat.Scope,
-		Params:  fnExpr.Params,
-		Body:    fnExpr.Body,
-	}, Function}
+		Params:  arrow.Params,
+		Body:    arrow.Body,
+		Async:   arrow.Async,
+		Arrow:   true,
+	}, Type: Function}
+}
+
+func (v *IVisitor) VisitNewExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
+	newExpr := e.Data.(*ast_parser.ENew)
+	callee := EvaluateExpr(&newExpr.Callee, stat)
+
+	args := []JsValue{}
+	for _, arg := range newExpr.Args {
+		args = append(args, EvaluateExpr(arg, stat))
+	}
+	return *stat.Construct(&callee, args, e.Loc)
 }
 
-func (v *IVisitor) VisitMemberExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+/*
+new callee(args)
+内置的构造函数直接构造，普通函数以新创建的对象作为this调用，返回对象时以返回值为结果
+*/
+func (s *InterpreterStat) Construct(callee *JsValue, args []JsValue, loc logger.Loc) *JsValue {
+	switch callee.Type {
+	case BuiltInClass:
+		s.Runtime.CallSite = loc
+		result := callee.Value.(*JsBuiltInClass).Construct(args...)
+		return &result
+	case Function:
+		if f, isFn := callee.Value.(*JsFunction); isFn && (f.Arrow || f.Generator || f.Async) {
+			break
+		}
+		s.Runtime.AllocObject(0)
+		this := JsValue{Value: &JsObject{
+			Constructor: callee,
+			Proto:       &ObjectPrototype,
+		}, Type: Object}
+		result := s.CallFunction(callee, this, args)
+		if result.Type == Object {
+			return result
+		}
+		return &this
+	}
+	panic(RuntimeError{loc, "TypeError: " + ToString(callee).Value.(string) + " is not a constructor"})
+}
+
+func (v *IVisitor) VisitMemberExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
 	memberExpr := e.Data.(*ast_parser.EMemberExpr)
 	obj := EvaluateExpr(&memberExpr.Obj, stat)
-	property := memberExpr.Property.Value
-	switch obj.Type {
-	case Object:
-		val := obj.Value.(*JsObject).Properties[property]
-		return val
-	case BuiltInObject:
-		return obj.Value.(map[string]*JsValue)[property]
-	default:
-		//装箱
-		valWrap := Wrap(obj)
-		return valWrap.Value.(*JsValue).Value.(map[string]*JsValue)[property]
+	if obj.Type != Object {
+		return *stat.GetProperty(&obj, memberExpr.Property.Value)
+	}
+	//对象的shape在内联缓存中时直接按位置读取，没有命中时记录这次查找的结果
+	cache, _ := memberExpr.Cache.(*propertyCache)
+	if cache == nil {
+		cache = &propertyCache{}
+		memberExpr.Cache = cache
 	}
+	o := obj.Value.(*JsObject)
+	if cell := cache.lookup(o); cell == nil {
+		cache.update(o, memberExpr.Property.Value)
+	} else if cell.Type != Accessor {
+		return *cell
+	}
+	return *stat.GetProperty(&obj, memberExpr.Property.Value)
 }
 
-func (v *IVisitor) VisitNumericLiteral(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitNumericLiteral(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	if num, err := strconv.ParseFloat(e.Data.(*ast_parser.ENumericLiteral).Value, 64); err == nil {
-		return &JsValue{
-			num,
-			Number}
+		return JsValue{Type: Number, num: num}
 	} else {
 		panic(RuntimeError{e.Loc, "not a number"})
 	}
 }
 
-func (v *IVisitor) VisitParen(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitParen(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	return EvaluateExpr(&e.Data.(*ast_parser.EParen).Data, stat)
 }
 
-func (v *IVisitor) VisitStringLiteral(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
-	return &JsValue{e.Data.(*ast_parser.ENumericLiteral).Value, String}
+func (v *IVisitor) VisitStringLiteral(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	return JsValue{Value: e.Data.(*ast_parser.ENumericLiteral).Value, Type: String}
 }
 
-func (v *IVisitor) VisitBoolLiteral(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
-	return &JsValue{e.Data.(*ast_parser.ENumericLiteral).Value == "true", Boolean}
+func (v *IVisitor) VisitBoolLiteral(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	return JsValue{Value: e.Data.(*ast_parser.ENumericLiteral).Value == "true", Type: Boolean}
 }
 
-func (v *IVisitor) VisitAssignExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitAssignExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
 	assignExpr := e.Data.(*ast_parser.EAssign)
-	assignTarge := EvaluateExpr(assignExpr.Target, stat)
+	switch target := assignExpr.Target.Data.(type) {
+	case *ast_parser.EMemberExpr:
+		obj := EvaluateExpr(&target.Obj, stat)
+		assignValue, assign := assignedValue(e, func() JsValue {
+			return *stat.GetProperty(&obj, target.Property.Value)
+		}, stat)
+		if assign {
+			stat.SetProperty(&obj, target.Property.Value, &assignValue)
+		}
+		return assignValue
+	case *ast_parser.EIndex:
+		obj := EvaluateExpr(&target.Target, stat)
+		idx := EvaluateExpr(&target.Idx, stat)
+		key := ToPropertyKey(&idx)
+		assignValue, assign := assignedValue(e, func() JsValue {
+			return *stat.GetProperty(&obj, key)
+		}, stat)
+		if assign {
+			stat.SetProperty(&obj, key, &assignValue)
+		}
+		return assignValue
+	case *ast_parser.EIdentifier:
+		assignValue, assign := assignedValue(e, func() JsValue {
+			return *stat.readIdentifier(target, assignExpr.Target.Loc)
+		}, stat)
+		if assign {
+			stat.assignIdentifier(target, &assignValue, e.Loc)
+		}
+		return assignValue
+	}
+	//其他的左侧表达式只求值，赋值没有效果
+	EvaluateExpr(assignExpr.Target, stat)
+	return EvaluateExpr(assignExpr.Assignment, stat)
+}
+
+/*
+计算赋值的值，current读取左侧原来的值
+逻辑赋值短路时不计算右侧，返回原来的值和false，这时不进行赋值
+*/
+func assignedValue(e *ast_parser.Expr, current func() JsValue, stat *InterpreterStat) (JsValue, bool) {
+	assignExpr := e.Data.(*ast_parser.EAssign)
+	if assignExpr.Op == 0 {
+		return EvaluateExpr(assignExpr.Assignment, stat), true
+	}
+	value := current()
+	switch lexer.T(assignExpr.Op) {
+	case lexer.TAmpersandAmpersand:
+		if !IsTruthy(value) {
+			return value, false
+		}
+	case lexer.TBarBar:
+		if IsTruthy(value) {
+			return value, false
+		}
+	case lexer.TQuestionQuestion:
+		if value.Type != Undefined && value.Type != Null {
+			return value, false
+		}
+	default:
+		return BinaryOperation(assignExpr.Op, value, EvaluateExpr(assignExpr.Assignment, stat), e.Loc, stat), true
+	}
+	return EvaluateExpr(assignExpr.Assignment, stat), true
+}
 
-	assignValue := EvaluateExpr(assignExpr.Assignment, stat)
-	*assignTarge = *assignValue
-	return assignTarge
+//a, b, c依次求值，结果是最后一个表达式的值
+func (v *IVisitor) VisitSequenceExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	exprs := e.Data.(*ast_parser.ESequence).Exprs
+	for i := 0; i < len(exprs)-1; i++ {
+		EvaluateExpr(&exprs[i], stat)
+	}
+	return EvaluateExpr(&exprs[len(exprs)-1], stat)
 }
 
-func (v *IVisitor) VisitArrayExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitArrayExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	arrLiteral := e.Data.(*ast_parser.EArrayLiteral)
+	stat.Runtime.AllocArray(len(arrLiteral.Arr))
 	arr := []*JsValue{}
 
 	for _, expr := range arrLiteral.Arr {
-		arr = append(arr, EvaluateExpr(expr, stat))
+		//每个元素是单独的值，[a]中的元素和变量a互不影响
+		value := EvaluateExpr(expr, stat)
+		arr = append(arr, &value)
 	}
 
-	return &JsValue{
+	return JsValue{
 		Value: &JsArray{
 			Arr:    arr,
 			Length: arrLiteral.Length,
@@ -398,52 +841,74 @@ func (v *IVisitor) VisitArrayExpr(e *ast_parser.Expr, stat *InterpreterStat) *Js
 	}
 }
 
-func (v *IVisitor) VisitObjectExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+func (v *IVisitor) VisitObjectExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
 	objExpr := e.Data.(*ast_parser.EObjectLiteral)
-	properties := map[string]*JsValue{}
-	for i := 0; i < len(objExpr.Properties); i += 2 {
-		k := EvaluateExpr(objExpr.Properties[i], stat)
-		val := EvaluateExpr(objExpr.Properties[i+1], stat)
-		if k.Type == String {
-			properties[k.Value.(string)] = val
-		} else if k.Type == Number {
-			str := strconv.FormatFloat(k.Value.(float64), 'f', 5, 64)
-			properties[str] = val
-		} else {
-			panic(RuntimeError{e.Loc, JsTypeToString[k.Type] + " is not allowed to be keys"})
-		}
+	stat.Runtime.AllocObject(len(objExpr.Properties))
+	obj := &JsObject{
+		Constructor: nil,
+		Proto:       &ObjectPrototype,
 	}
 
-	var proto *JsValue = nil
-	if objExpr.Proto != nil {
-		proto = stat.Scope.Get(objExpr.Proto.Value)
-	} else {
-		proto = &ObjectPrototype
+	//按顺序定义属性，同名属性后面的覆盖前面的，get和set可以合并成同一个访问器属性
+	for _, property := range objExpr.Properties {
+		if property.Kind == ast_parser.PropertyProto {
+			//__proto__: value，只有对象或null会修改原型
+			proto := EvaluateExpr(&property.Value, stat)
+			switch proto.Type {
+			case Object:
+				obj.Proto = &proto
+			case Null:
+				obj.Proto = nil
+			}
+			continue
+		}
+
+		//非计算属性的key是字符串或数字字面量，同样需要规范化
+		keyValue := EvaluateExpr(&property.Key, stat)
+		key := ToPropertyKey(&keyValue)
+
+		switch property.Kind {
+		case ast_parser.PropertyGet, ast_parser.PropertySet:
+			fn := newMethod(property.Value.Data.(*ast_parser.EFunctionExpr), stat)
+			accessor := &JsAccessor{}
+			if prev, has := obj.Get(key); has && prev.Type == Accessor {
+				*accessor = *prev.Value.(*JsAccessor)
+			}
+			if property.Kind == ast_parser.PropertyGet {
+				accessor.Get = fn
+			} else {
+				accessor.Set = fn
+			}
+			obj.Set(key, &JsValue{Value: accessor, Type: Accessor})
+		case ast_parser.PropertyMethod:
+			obj.Set(key, newMethod(property.Value.Data.(*ast_parser.EFunctionExpr), stat))
+		default:
+			val := EvaluateExpr(&property.Value, stat)
+			obj.Set(key, &val)
+		}
 	}
 
-	return &JsValue{
-		Value: &JsObject{
-			Constructor: nil,
-			Proto:       proto,
-			Properties:  properties,
-		},
-		Type: Object,
+	return JsValue{
+		Value: obj,
+		Type:  Object,
 	}
 }
 
-func (v *IVisitor) VisitIndexExpr(e *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+//对象中的方法、getter和setter，和函数表达式不同的是方法名不会绑定到作用域中
+func newMethod(fnExpr *ast_parser.EFunctionExpr, stat *InterpreterStat) *JsValue {
+	return &JsValue{Value: &JsFunction{
+		Closure:   stat.Scope,
+		Params:    fnExpr.Params,
+		Body:      fnExpr.Body,
+		Generator: fnExpr.Generator,
+		Async:     fnExpr.Async,
+	}, Type: Function}
+}
+
+func (v *IVisitor) VisitIndexExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
 	idxExpr := e.Data.(*ast_parser.EIndex)
-	targetArr := EvaluateExpr(&idxExpr.Target, stat)
+	target := EvaluateExpr(&idxExpr.Target, stat)
 	idx := EvaluateExpr(&idxExpr.Idx, stat)
-	switch targetArr.Type {
-	case Array:
-		arr := targetArr.Value.(*JsArray)
-		i := uint(ToNumber(idx).Value.(float64))
-		if i >= arr.Length {
-			return &JsValue{nil, Undefined}
-		}
-		return arr.Arr[i]
-	default:
-		panic(RuntimeError{e.Loc, "index expression can only be used for array or object"})
-	}
+	return *stat.GetProperty(&target, ToPropertyKey(&idx))
 }
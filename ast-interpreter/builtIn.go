@@ -3,7 +3,9 @@ package ast_interpreter
 import (
 	"jsInterpreter/ast_parser"
 	"jsInterpreter/logger"
+	"math"
 	"strconv"
+	"strings"
 )
 
 type JsType uint8
@@ -19,48 +21,85 @@ const (
 	Object
 	BuiltInFunction
 	BuiltInObject
+	//getter/setter属性，只会作为JsObject的属性出现，读写属性时会调用对应的函数
+	Accessor
+	Generator
+	Promise
+	//内置的构造函数，例如Promise
+	BuiltInClass
+	//let/const在执行到声明之前(TDZ)的值，读写时抛出ReferenceError，不会出现在其他地方
+	Uninitialized
 )
 
 var JsTypeToString = map[JsType]string{
-	Array:    "Array",
-	Function: "Function",
-	Object:   "Object",
+	Array:        "Array",
+	Function:     "Function",
+	Object:       "Object",
+	Generator:    "Generator",
+	Promise:      "Promise",
+	BuiltInClass: "Function",
 }
 
+/*
+JS的值：数字直接存放在num中，其他值存放在Value中
+布尔值放进interface不需要分配，数字不装箱，表达式的结果按值返回，数字运算和比较都不会在堆上分配
+变量、属性和数组元素仍然是*JsValue，修改它们需要写回原来的位置
+*/
 type JsValue struct {
 	Value interface{}
 	Type  JsType
+	num   float64
+}
+
+func NumberValue(num float64) JsValue {
+	return JsValue{Type: Number, num: num}
+}
+
+//数字的值，只对Number有意义
+func (v *JsValue) Num() float64 {
+	return v.num
+}
+
+//转换成Go的值：数字是float64，字符串是string，布尔值是bool，其他类型原样返回Value
+func (v *JsValue) Export() interface{} {
+	switch v.Type {
+	case Number:
+		return v.num
+	case String:
+		return v.Str()
+	}
+	return v.Value
 }
 
 func NewJsValue(v interface{}) *JsValue {
 	switch v.(type) {
 	case string:
-		return &JsValue{v, String}
+		return &JsValue{Value: v, Type: String}
 	case int:
-		return &JsValue{float64(v.(int)), Number}
+		return &JsValue{Type: Number, num: float64(v.(int))}
 	case float32:
-		return &JsValue{float64(v.(float32)), Number}
+		return &JsValue{Type: Number, num: float64(v.(float32))}
 	case float64:
-		return &JsValue{v, Number}
+		return &JsValue{Type: Number, num: v.(float64)}
 	case bool:
-		return &JsValue{v, Boolean}
+		return &JsValue{Value: v, Type: Boolean}
 	case *JsFunction:
-		return &JsValue{v, Function}
+		return &JsValue{Value: v, Type: Function}
 	case *JsObject:
-		return &JsValue{v, Object}
+		return &JsValue{Value: v, Type: Object}
 	case *JsValue:
 		return v.(*JsValue)
 	default:
-		return &JsValue{nil, Undefined}
+		return &JsValue{Type: Undefined}
 	}
 }
 
 func NewBuiltIn(builtIn interface{}) *JsValue {
 	switch builtIn.(type) {
 	case func(JsValue, ...JsValue) JsValue:
-		return &JsValue{builtIn, BuiltInFunction}
+		return &JsValue{Value: builtIn, Type: BuiltInFunction}
 	case map[string]*JsValue:
-		return &JsValue{builtIn, BuiltInObject}
+		return &JsValue{Value: builtIn, Type: BuiltInObject}
 	default:
 		panic("unknown builtIn type")
 	}
@@ -69,76 +108,192 @@ func NewBuiltIn(builtIn interface{}) *JsValue {
 func ToString(v *JsValue) JsValue {
 	switch v.Type {
 	case String:
-		return JsValue{v.Value, String}
+		return JsValue{Value: v.Str(), Type: String}
 	case Number:
-		return JsValue{strconv.FormatFloat(v.Value.(float64), 'f', 5, 64), String}
+		return JsValue{Value: NumberToString(v.num), Type: String}
 	case Boolean:
 		if v.Value == true {
-			return JsValue{"true", String}
+			return JsValue{Value: "true", Type: String}
 		} else {
-			return JsValue{"false", String}
+			return JsValue{Value: "false", Type: String}
 		}
 	case Undefined:
-		return JsValue{"undefined", String}
+		return JsValue{Value: "undefined", Type: String}
 	case Null:
-		return JsValue{"null", Null}
+		return JsValue{Value: "null", Type: Null}
 	default:
 		if t, has := JsTypeToString[v.Type]; has {
-			return JsValue{"[object " + t + "]", String}
+			return JsValue{Value: "[object " + t + "]", Type: String}
 		} else {
-			return JsValue{"[object Internal]", String}
+			return JsValue{Value: "[object Internal]", Type: String}
 		}
 	}
 }
 
+/*
+Number::toString，按照规范选择最短的能还原该数字的表示
+1 -> "1", 0.5 -> "0.5", 1e21 -> "1e+21", 1e-7 -> "1e-7"
+*/
+func NumberToString(num float64) string {
+	switch {
+	case math.IsNaN(num):
+		return "NaN"
+	case num == 0:
+		return "0"
+	case math.IsInf(num, 1):
+		return "Infinity"
+	case math.IsInf(num, -1):
+		return "-Infinity"
+	case num < 0:
+		return "-" + NumberToString(-num)
+	}
+
+	//s × 10^(n-k)，digits为s的各位数字，k为位数
+	mantissa := strconv.FormatFloat(num, 'e', -1, 64)
+	ePos := strings.IndexByte(mantissa, 'e')
+	digits := strings.Replace(mantissa[:ePos], ".", "", 1)
+	exp, _ := strconv.Atoi(mantissa[ePos+1:])
+	k := len(digits)
+	n := exp + 1
+
+	switch {
+	case k <= n && n <= 21:
+		return digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return "0." + strings.Repeat("0", -n) + digits
+	}
+
+	sign := "+"
+	if n-1 < 0 {
+		sign = "-"
+	}
+	e := "e" + sign + strconv.Itoa(int(math.Abs(float64(n-1))))
+	if k == 1 {
+		return digits + e
+	}
+	return digits[:1] + "." + digits[1:] + e
+}
+
+//属性名统一转换成字符串，数字按照Number::toString规范化，{ 1.0: x }的key是"1"
+func ToPropertyKey(v *JsValue) string {
+	return ToString(v).Value.(string)
+}
+
 func ToNumber(v *JsValue) JsValue {
 	switch v.Type {
 	case Number:
-		return JsValue{v.Value, Number}
+		return *v
 	case String:
-		if value, err := strconv.ParseFloat(v.Value.(string), 64); err != nil {
-			return JsValue{0.0, Number}
+		if value, err := strconv.ParseFloat(v.Str(), 64); err != nil {
+			return JsValue{Type: Number, num: 0.0}
 		} else {
-			return JsValue{value, Number}
+			return JsValue{Type: Number, num: value}
 		}
 	case Boolean:
 		if v.Value == true {
-			return JsValue{1.0, Number}
+			return JsValue{Type: Number, num: 1.0}
 		} else {
-			return JsValue{0.0, Number}
+			return JsValue{Type: Number, num: 0.0}
 		}
 	default:
-		return JsValue{0.0, Number}
+		return JsValue{Type: Number, num: 0.0}
+	}
+}
+
+//位运算使用的ToInt32，NaN和Infinity转换成0，超出范围的数按2^32取模
+func ToInt32(v *JsValue) int32 {
+	num := ToNumber(v).num
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0
+	}
+	return int32(uint32(int64(math.Trunc(num))))
+}
+
+func TypeOf(v *JsValue) string {
+	switch v.Type {
+	case Undefined:
+		return "undefined"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Boolean:
+		return "boolean"
+	case Function, BuiltInFunction, BuiltInClass:
+		return "function"
+	default:
+		return "object"
+	}
+}
+
+/*
+obj instanceof F：对象的原型链上有F创建的对象时为true，
+内置的构造函数按照值的类型判断，例如promise instanceof Promise
+*/
+func InstanceOf(obj *JsValue, constructor *JsValue, loc logger.Loc) bool {
+	switch constructor.Type {
+	case Function:
+		for obj != nil && obj.Type == Object {
+			o := obj.Value.(*JsObject)
+			if o.Constructor != nil && o.Constructor.Value == constructor.Value {
+				return true
+			}
+			obj = o.Proto
+		}
+		return false
+	case BuiltInClass:
+		return JsTypeToString[obj.Type] == constructor.Value.(*JsBuiltInClass).Name
+	default:
+		panic(RuntimeError{loc, "TypeError: Right-hand side of 'instanceof' is not callable"})
 	}
 }
 
 func ToBoolean(v *JsValue) JsValue {
 	switch v.Type {
 	case Boolean:
-		return JsValue{v.Value, Boolean}
+		return JsValue{Value: v.Value, Type: Boolean}
 	case Number:
-		if v.Value == 0 {
-			return JsValue{false, Boolean}
+		if num := v.num; num == 0 || math.IsNaN(num) {
+			return JsValue{Value: false, Type: Boolean}
 		} else {
-			return JsValue{true, Boolean}
+			return JsValue{Value: true, Type: Boolean}
 		}
 	case String:
 		if v.Value == "" {
-			return JsValue{false, Boolean}
+			return JsValue{Value: false, Type: Boolean}
 		} else {
-			return JsValue{true, Boolean}
+			return JsValue{Value: true, Type: Boolean}
 		}
+	case Undefined, Null:
+		return JsValue{Value: false, Type: Boolean}
 	default:
-		return JsValue{true, Boolean}
+		return JsValue{Value: true, Type: Boolean}
 	}
 }
 
-func IsTruthy(v *JsValue) bool {
+//类型相同并且值相同，数字按数值比较，NaN不等于自己
+func StrictEquals(a *JsValue, b *JsValue) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case Number:
+		return a.num == b.num
+	case String:
+		return a.Str() == b.Str()
+	}
+	return a.Value == b.Value
+}
+
+func IsTruthy(v JsValue) bool {
 	switch v.Type {
 	case Boolean:
 		return v.Value == true
 	case Number:
-		return v.Value != 0
+		num := v.num
+		return num != 0 && !math.IsNaN(num)
 	case String:
 		return v.Value != ""
 	case Undefined, Null:
@@ -151,7 +306,12 @@ func IsTruthy(v *JsValue) bool {
 type JsObject struct {
 	Constructor *JsValue
 	Proto       *JsValue
-	Properties  map[string]*JsValue
+	//属性存放在slots中，位置由shape决定，字典模式下shape为nil，属性存放在dict中
+	shape *Shape
+	slots []*JsValue
+	dict  map[string]*JsValue
+	//不能赋值也不能删除的属性，例如全局对象上的undefined、NaN和Infinity，其他对象为nil
+	readOnly map[string]bool
 }
 
 type JsArray struct {
@@ -160,14 +320,40 @@ type JsArray struct {
 }
 
 type JsFunction struct {
-	Closure *Scope
-	Params  []ast_parser.EIdentifier
-	Body    *ast_parser.SBody
+	Closure   *Scope
+	Params    []ast_parser.EIdentifier
+	Body      *ast_parser.SBody
+	Generator bool
+	Async     bool
+	//箭头函数没有自己的this，使用定义时外层的this
+	Arrow bool
+	//经过作用域分析的具名函数表达式，调用时把名字绑定到函数自己的作用域中
+	Name *ast_parser.EIdentifier
+}
+
+//其他引擎创建的函数，例如vm包中的字节码函数，类型同样是Function，调用时执行自己的Call
+type Callable interface {
+	Call(this JsValue, args []JsValue) *JsValue
+}
+
+//内置的构造函数，可以被new调用，本身也带有静态方法，例如Promise和Promise.all
+type JsBuiltInClass struct {
+	Name      string
+	Construct func(args ...JsValue) JsValue
+	Statics   map[string]*JsValue
+}
+
+//get x() {} / set x(v) {}，没有定义的一方为nil
+type JsAccessor struct {
+	Get *JsValue
+	Set *JsValue
 }
 
-var ObjectPrototype = JsValue{map[string]*JsValue{
-	"toString": &JsValue{ToString, BuiltInFunction},
-}, BuiltInObject}
+var ObjectPrototype = JsValue{Value: map[string]*JsValue{
+	"toString": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
+		return ToString(&this)
+	}, Type: BuiltInFunction},
+}, Type: BuiltInObject}
 
 func ArrayPush(this JsValue, args ...JsValue) JsValue {
 	arr := this.Value.(*JsArray)
@@ -177,7 +363,7 @@ func ArrayPush(this JsValue, args ...JsValue) JsValue {
 	}
 	arr.Arr = append(arr.Arr, items...)
 	arr.Length += uint(len(args))
-	return JsValue{arr.Length, Number}
+	return JsValue{Value: arr.Length, Type: Number}
 }
 
 func ArraySplice(this JsValue, args ...JsValue) JsValue {
@@ -188,8 +374,8 @@ func ArraySplice(this JsValue, args ...JsValue) JsValue {
 			"should be at least 2"})
 	}
 
-	index := uint(ToNumber(&args[0]).Value.(float64))
-	deleteNum := int(ToNumber(&args[1]).Value.(float64))
+	index := uint(ToNumber(&args[0]).num)
+	deleteNum := int(ToNumber(&args[1]).num)
 	addItems := []*JsValue{}
 	for i, _ := range args[2:] {
 		addItems = append(addItems, &args[2+i])
@@ -211,13 +397,13 @@ func ArraySplice(this JsValue, args ...JsValue) JsValue {
 	arr.Arr = append(arr.Arr[:index], addItems...)
 	arr.Arr = append(arr.Arr, restArr...)
 
-	return JsValue{JsArray{deleted, uint(len(deleted))}, Array}
+	return JsValue{Value: JsArray{deleted, uint(len(deleted))}, Type: Array}
 }
 
-var ArrayPrototype = JsValue{map[string]*JsValue{
-	"splice": &JsValue{ArraySplice, BuiltInFunction},
-	"push":   &JsValue{ArrayPush, BuiltInFunction},
-}, BuiltInObject}
+var ArrayPrototype = JsValue{Value: map[string]*JsValue{
+	"splice": &JsValue{Value: ArraySplice, Type: BuiltInFunction},
+	"push":   &JsValue{Value: ArrayPush, Type: BuiltInFunction},
+}, Type: BuiltInObject}
 
 func JsToStringFactory(value JsValue) func() JsValue {
 	return func() JsValue {
@@ -239,14 +425,14 @@ func JsToBoolFactory(value JsValue) func() JsValue {
 
 func Wrap(primary *JsValue) JsValue {
 	return JsValue{
-		Value: &JsValue{map[string]*JsValue{
-			"toString": &JsValue{func(this JsValue, args ...JsValue) JsValue {
+		Value: &JsValue{Value: map[string]*JsValue{
+			"toString": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
 				return ToString(&this)
-			}, BuiltInFunction},
-			"toNumber": &JsValue{func(this JsValue, args ...JsValue) JsValue {
+			}, Type: BuiltInFunction},
+			"toNumber": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
 				return ToNumber(&this)
-			}, BuiltInFunction},
-		}, BuiltInObject},
+			}, Type: BuiltInFunction},
+		}, Type: BuiltInObject},
 		Type: BuiltInObject,
 	}
 }
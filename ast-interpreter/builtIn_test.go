@@ -2,28 +2,30 @@ package ast_interpreter
 
 import (
 	"fmt"
+	"jsInterpreter/ast_parser"
+	"strings"
 	t "testing"
 )
 
 func TestArrayMethods(t *t.T) {
-	jsArr := JsValue{&JsArray{
+	jsArr := JsValue{Value: &JsArray{
 		Arr: []*JsValue{
-			&JsValue{0.0, Number},
-			&JsValue{1.0, Number},
-			&JsValue{2.0, Number},
+			&JsValue{Type: Number, num: 0.0},
+			&JsValue{Type: Number, num: 1.0},
+			&JsValue{Type: Number, num: 2.0},
 		},
 		Length: 1,
-	}, Array}
+	}, Type: Array}
 	arr := []float64{.0, 1.0, 2.0}
 	array := jsArr.Value.(*JsArray)
 
-	ArrayPush(jsArr, JsValue{3.0, Number}, JsValue{4.0, Number})
+	ArrayPush(jsArr, JsValue{Type: Number, num: 3.0}, JsValue{Type: Number, num: 4.0})
 	arr = append(arr, 3.0, 4.0)
 
 	checkEqual(t, array, arr)
 
 
-	ArraySplice(jsArr, JsValue{1.0, Number}, JsValue{1.0, Number})
+	ArraySplice(jsArr, JsValue{Type: Number, num: 1.0}, JsValue{Type: Number, num: 1.0})
 	arr = append(arr[:1], arr[2:]...)
 
 	checkEqual(t, array, arr)
@@ -35,8 +37,72 @@ func checkEqual(t *t.T, array *JsArray, arr []float64) {
 	}
 
 	for i, item := range arr {
-		if array.Arr[i].Value != item {
+		if array.Arr[i].Num() != item {
 			t.Error("数组中元素应该和原生一致，")
 		}
 	}
 }
+
+func TestNumberToString(t *t.T) {
+	cases := map[float64]string{
+		1:         "1",
+		1.5:       "1.5",
+		-2:        "-2",
+		100:       "100",
+		0.000001:  "0.000001",
+		0.0000001: "1e-7",
+		1e21:      "1e+21",
+		1.5e300:   "1.5e+300",
+		123456789: "123456789",
+	}
+	for num, expected := range cases {
+		if result := NumberToString(num); result != expected {
+			t.Error(fmt.Sprint(num) + "应该转换为" + expected + "，结果为" + result)
+		}
+	}
+}
+
+func TestObjectLiteral(t *t.T) {
+	stat, err := evaluate(`
+let a = 1
+let proto = { inherited: "yes" }
+let o = {
+	a,
+	m() { return typeof m },
+	get x() { return this._x },
+	set x(v) { this._x = v * 2 },
+	1.0: "one",
+	dup: 1,
+	dup: 2,
+	__proto__: proto,
+}
+o.x = 3
+let shorthand = o.a
+let ownName = o.m()
+let accessor = o.x
+let numericKey = o["1"]
+let dup = o.dup
+let inherited = o.inherited
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"shorthand": 1.0, "ownName": "undefined", "accessor": 6.0,
+		"numericKey": "one", "dup": 2.0, "inherited": "yes"}
+	for name, value := range expected {
+		if got := stat.Scope.Get(name).Export(); got != value {
+			t.Errorf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+
+	//get和set合并成同一个访问器属性
+	o := stat.Scope.Get("o").Value.(*JsObject)
+	if x, _ := o.Get("x"); x.Type != Accessor || x.Value.(*JsAccessor).Get == nil || x.Value.(*JsAccessor).Set == nil {
+		t.Errorf("get x and set x should merge into one accessor, got %v", x)
+	}
+
+	p := ast_parser.NewParser("let c = { __proto__: null, __proto__: null }")
+	if _, diagnostics := p.Parse(); len(diagnostics) == 0 || !strings.Contains(diagnostics[0].Msg, "duplicate __proto__ fields") {
+		t.Errorf("expected duplicate __proto__ error, got %v", diagnostics)
+	}
+}
@@ -0,0 +1,277 @@
+package ast_interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+CommonJS模块：代码被包装成function (exports, require, module, __filename, __dirname) { }执行，
+require返回module.exports。模块在开始执行前就放入缓存，循环require时拿到的是还没执行完的exports
+*/
+var commonJSParams = []ast_parser.EIdentifier{
+	{Value: "exports"},
+	{Value: "require"},
+	{Value: "module"},
+	{Value: "__filename"},
+	{Value: "__dirname"},
+}
+
+/*
+按照CommonJS的规则解析路径：只支持相对路径和绝对路径，
+依次尝试path、path.js、path.json和path/index.js、path/index.json
+*/
+func (l *ModuleLoader) ResolveCommonJS(specifier string, referrer string) (string, bool) {
+	if !strings.HasPrefix(specifier, "./") && !strings.HasPrefix(specifier, "../") && !filepath.IsAbs(specifier) {
+		return "", false
+	}
+	path := specifier
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(referrer), specifier)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	candidates := []string{
+		path, path + ".js", path + ".json",
+		filepath.Join(path, "index.js"), filepath.Join(path, "index.json"),
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+/*
+模块中的require函数，路径相对于filename所在的目录
+*/
+func (l *ModuleLoader) NewRequire(filename string) *JsValue {
+	return NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+		specifier := argOrUndefined(args, 0)
+		if specifier.Type != String {
+			panic(RuntimeError{msg: "TypeError: The \"id\" argument must be of type string. Received " + ToString(&specifier).Value.(string)})
+		}
+		path, ok := l.ResolveCommonJS(specifier.Str(), filename)
+		if !ok {
+			panic(RuntimeError{msg: "Error: Cannot find module '" + specifier.Str() + "'"})
+		}
+		return *l.Require(path)
+	})
+}
+
+//加载并执行path对应的CommonJS模块，返回它的module.exports，同一个文件只执行一次
+func (l *ModuleLoader) Require(path string) *JsValue {
+	if module, has := l.commonJS[path]; has {
+		return l.runtime.Current.GetProperty(module, "exports")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(RuntimeError{msg: "Error: Cannot find module '" + path + "'"})
+	}
+
+	module := newCommonJSModule(path)
+	l.commonJS[path] = module
+	if strings.HasSuffix(path, ".json") {
+		exports := ParseJSON(string(data), path)
+		l.runtime.Current.SetProperty(module, "exports", exports)
+	} else {
+		l.evaluateCommonJS(module, path, string(data))
+	}
+	l.runtime.Current.SetProperty(module, "loaded", &JsValue{Value: true, Type: Boolean})
+	return l.runtime.Current.GetProperty(module, "exports")
+}
+
+func newCommonJSModule(path string) *JsValue {
+	exports := &JsValue{Value: &JsObject{Proto: &ObjectPrototype}, Type: Object}
+	return &JsValue{Value: NewObject(&ObjectPrototype, map[string]*JsValue{
+		"id":       {Value: path, Type: String},
+		"filename": {Value: path, Type: String},
+		"exports":  exports,
+		"loaded":   {Value: false, Type: Boolean},
+	}), Type: Object}
+}
+
+func (l *ModuleLoader) evaluateCommonJS(module *JsValue, path string, code string) {
+	p := ast_parser.NewParser(code)
+	p.Log.File = path
+	ast, diagnostics := p.Parse()
+	diagnostics = append(diagnostics, analyze(&ast, false, l.runtime.Optimize, &l.runtime.names)...)
+	if len(diagnostics) > 0 {
+		p.Log.PrintDiagnostics(diagnostics)
+		panic(RuntimeError{msg: "SyntaxError: failed to parse module '" + path + "'"})
+	}
+
+	rt := l.runtime
+	log := rt.Log
+	rt.Log = p.Log
+	stat := rt.Current
+	//顶层变量按名字存放，多一层作用域不影响查找，它只用来记录import()的相对路径相对于哪个文件
+	closure := NewScope(l.global)
+	if path != "" {
+		l.filenames[closure] = path
+	}
+	//模块的代码相当于一个函数体，顶层可以return
+	wrapper := &JsFunction{
+		Closure: closure,
+		Params:  commonJSParams,
+		Body: &ast_parser.SBody{
+			Loc:    ast.Loc,
+			Data:   &ast_parser.SBlock{Data: ast.Data.(*ast_parser.SProgram).Body},
+			Strict: ast.Data.(*ast_parser.SProgram).Strict,
+		},
+	}
+	exports := stat.GetProperty(module, "exports")
+	stat.Call(wrapper, *exports, []JsValue{
+		*exports,
+		*l.NewRequire(path),
+		*module,
+		{Value: path, Type: String},
+		{Value: filepath.Dir(path), Type: String},
+	})
+	rt.Log = log
+}
+
+/*
+作为入口执行一个CommonJS文件，path为空时是直接执行的一段代码
+*/
+func (l *ModuleLoader) RunCommonJS(path string, code string) {
+	module := newCommonJSModule(path)
+	if path != "" {
+		l.commonJS[path] = module
+	}
+	l.evaluateCommonJS(module, path, code)
+	l.runtime.Current.SetProperty(module, "loaded", &JsValue{Value: true, Type: Boolean})
+}
+
+/*
+判断入口文件按照ES模块还是CommonJS执行：.mjs是ES模块，.cjs是CommonJS，
+其他文件中有import/export声明或者顶层await时是ES模块
+*/
+func IsESModule(path string, code string) bool {
+	switch filepath.Ext(path) {
+	case ".mjs":
+		return true
+	case ".cjs":
+		return false
+	}
+
+	p := ast_parser.NewParser(code)
+	p.IsModule = true
+	ast, diagnostics := p.Parse()
+	if len(diagnostics) > 0 {
+		return false
+	}
+	if p.HasTopLevelAwait {
+		return true
+	}
+	for _, stmt := range ast.Data.(*ast_parser.SProgram).Body {
+		switch stmt.Data.(type) {
+		case *ast_parser.SImport, *ast_parser.SExportDecl, *ast_parser.SExportDefault,
+			*ast_parser.SExportNamed, *ast_parser.SExportAll:
+			return true
+		}
+	}
+	return false
+}
+
+/*
+把JSON文本转换成JS的值，对象和数组会递归转换，对象的属性和node一样保持在文本中出现的顺序
+*/
+func ParseJSON(text string, filename string) *JsValue {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	value, err := readJSON(decoder)
+	if err == nil {
+		//顶层的值之后只能有空白
+		if token, next := decoder.Token(); next != io.EOF {
+			err = next
+			if next == nil {
+				err = fmt.Errorf("unexpected %v after top-level value", token)
+			}
+		}
+	}
+	if err != nil {
+		panic(RuntimeError{msg: "SyntaxError: " + filename + ": " + err.Error()})
+	}
+	return value
+}
+
+//按token读取一个JSON值，对象的属性按读到的顺序加入
+func readJSON(decoder *json.Decoder) (*JsValue, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := token.(type) {
+	case nil:
+		return &JsValue{Type: Null}, nil
+	case bool:
+		return &JsValue{Value: v, Type: Boolean}, nil
+	case float64:
+		return &JsValue{Type: Number, num: v}, nil
+	case string:
+		return &JsValue{Value: v, Type: String}, nil
+	case json.Delim:
+		if v == '[' {
+			arr := []*JsValue{}
+			for decoder.More() {
+				item, err := readJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, item)
+			}
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+			return &JsValue{Value: &JsArray{Arr: arr, Length: uint(len(arr))}, Type: Array}, nil
+		}
+		obj := &JsObject{Proto: &ObjectPrototype}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key.(string), value)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return &JsValue{Value: obj, Type: Object}, nil
+	}
+	return &JsValue{Type: Undefined}, nil
+}
+
+//ES模块导入CommonJS模块或JSON文件时，module.exports作为default导出
+func isCommonJSFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".cjs" || ext == ".json"
+}
+
+func (l *ModuleLoader) loadCommonJSAsModule(path string) *Module {
+	m := &Module{
+		Path:            path,
+		Status:          ModuleLoaded,
+		Scope:           NewScope(l.global),
+		Log:             logger.Logger{File: path},
+		imports:         map[string]moduleImport{},
+		localExports:    map[string]string{"default": defaultExportName},
+		indirectExports: map[string]moduleImport{},
+		commonJS:        true,
+	}
+	m.Scope.Hoist(defaultExportName)
+	l.modules[path] = m
+	return m
+}
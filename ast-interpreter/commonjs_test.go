@@ -0,0 +1,83 @@
+package ast_interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	t "testing"
+)
+
+/*
+testdata/commonjs：require("./lib")解析到lib/index.js，可以省略.json后缀，
+同一个文件只执行一次，a和b互相require时b拿到的是a还没执行完的exports
+*/
+func TestCommonJS(t *t.T) {
+	output := captureOutput(func() {
+		if err := RunFile("testdata/commonjs/main.js", false); err != nil {
+			t.Fatal(err)
+		}
+	})
+	dir, _ := filepath.Abs("testdata/commonjs")
+	expected := []string{
+		"lib loaded",
+		"lib config 2 true",
+		"same true true true",
+		"cycle early undefined, late",
+		filepath.Join(dir, "main.js"),
+		dir,
+		"Error: Cannot find module './missing'",
+	}
+	if got := strings.TrimSuffix(output, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+//从其他目录执行时，require和import()的相对路径仍然相对于发起调用的文件
+func TestCommonJSReferrer(t *t.T) {
+	path, _ := filepath.Abs("testdata/commonjs/dynamic.js")
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	output := captureOutput(func() {
+		if err := RunFile(path, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expected := []string{
+		"cycle early undefined, late",
+		"import esm",
+		"Error: Cannot find module './missing.mjs'",
+	}
+	if got := strings.TrimSuffix(output, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+//JSON对象的属性保持文本中的顺序，重复的key保留第一次出现的位置和最后一个值
+func TestParseJSON(t *t.T) {
+	value := ParseJSON(`{"zeta": 1, "alpha": {"y": [true, null], "x": "s"}, "mid": 2, "zeta": 3}`, "order.json")
+	obj := value.Value.(*JsObject)
+	if keys := strings.Join(obj.Shape().keys, " "); keys != "zeta alpha mid" {
+		t.Errorf("expected keys in source order, got %s", keys)
+	}
+	if zeta, _ := obj.Get("zeta"); zeta.Num() != 3 {
+		t.Errorf("expected the last duplicate value, got %v", zeta.Export())
+	}
+	alpha, _ := obj.Get("alpha")
+	if keys := strings.Join(alpha.Value.(*JsObject).Shape().keys, " "); keys != "y x" {
+		t.Errorf("expected nested keys in source order, got %s", keys)
+	}
+
+	for _, text := range []string{`{"a": }`, `{"a": 1} {}`, `[1, 2`} {
+		func() {
+			defer func() {
+				if e, isErr := recover().(RuntimeError); !isErr || !strings.HasPrefix(e.msg, "SyntaxError: bad.json: ") {
+					t.Errorf("%s: expected a SyntaxError, got %v", text, e)
+				}
+			}()
+			ParseJSON(text, "bad.json")
+		}()
+	}
+}
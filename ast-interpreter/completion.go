@@ -0,0 +1,84 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+)
+
+type CompletionType uint8
+
+const (
+	CompletionNormal CompletionType = iota
+	CompletionReturn
+	CompletionBreak
+	CompletionContinue
+	CompletionThrow
+)
+
+/*
+语句执行的结果，return、break、continue和throw通过返回值一层层向外传递，不再使用panic
+Value是return的返回值或者throw抛出的值，Label是break和continue的标签，
+Loc是throw语句的位置
+*/
+type Completion struct {
+	Type  CompletionType
+	Value *JsValue
+	Label string
+	Loc   logger.Loc
+}
+
+func (c Completion) Abrupt() bool {
+	return c.Type != CompletionNormal
+}
+
+func throwCompletion(value JsValue, loc logger.Loc) Completion {
+	return Completion{Type: CompletionThrow, Value: &value, Loc: loc}
+}
+
+/*
+表达式中抛出的异常仍然是panic，在函数、程序和模块的边界把throw完成记录变回panic，
+这样promise、generator等原来处理异常的地方不需要改动
+*/
+func (c Completion) rethrow() {
+	if c.Type == CompletionThrow {
+		panic(JsException{Loc: c.Loc, Value: *c.Value})
+	}
+}
+
+//执行fn，其中抛出的JsException和RuntimeError变成throw完成记录，其他panic继续向上传递
+func catchCompletion(fn func() Completion) (c Completion) {
+	defer func() {
+		if err := recover(); err != nil {
+			value, loc, thrown := ThrownValue(err)
+			if !thrown {
+				panic(err)
+			}
+			c = throwCompletion(value, loc)
+		}
+	}()
+	return fn()
+}
+
+//执行一组语句，遇到非正常的完成记录时停下并返回它
+func evaluateStmts(stmts []*ast_parser.Stmt, stat *InterpreterStat) Completion {
+	for _, stmt := range stmts {
+		if c := EvaluateStmt(stmt, stat); c.Abrupt() {
+			return c
+		}
+	}
+	return Completion{}
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+//没有标签或者标签属于这个循环的break/continue作用于这个循环
+func targetsLoop(c Completion, labels []string) bool {
+	return c.Label == "" || hasLabel(labels, c.Label)
+}
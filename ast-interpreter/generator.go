@@ -0,0 +1,376 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+	"runtime"
+	"sync"
+)
+
+/*
+generator的函数体运行在单独的goroutine中，用两个无缓冲channel和调用方交替执行：
+调用next/return/throw时向resume发送信号并阻塞等待，函数体执行到yield时向yield发送结果并阻塞等待下一个信号，
+所以任意时刻只有一方在运行，不需要对解释器的状态加锁。
+JS中的generator对象是JsGenerator，函数体的goroutine只引用generatorCore，
+generator对象不再被引用时finalizer把挂起的generatorCore交给Runtime，见abandonedGenerators
+*/
+type JsGenerator struct {
+	*generatorCore
+}
+
+type generatorCore struct {
+	State GeneratorState
+	//函数体，在generator自己的goroutine中执行
+	body   func() *JsValue
+	stat   *InterpreterStat
+	resume chan generatorSignal
+	yield  chan generatorResult
+}
+
+type GeneratorState uint8
+
+const (
+	GeneratorSuspendedStart GeneratorState = iota
+	GeneratorSuspendedYield
+	GeneratorExecuting
+	GeneratorCompleted
+)
+
+type generatorSignalKind uint8
+
+const (
+	signalNext generatorSignalKind = iota
+	signalReturn
+	signalThrow
+	//generator对象已经被丢弃，函数体直接退出，不执行finally
+	signalAbandon
+)
+
+//调用方发给generator的恢复信号，对应next(v)、return(v)和throw(v)
+type generatorSignal struct {
+	kind  generatorSignalKind
+	value JsValue
+	//throw时异常最初被抛出的位置，例如await的promise被reject的位置
+	loc logger.Loc
+}
+
+//generator交还给调用方的结果，err不为nil时是函数体中没有被处理的panic
+type generatorResult struct {
+	value JsValue
+	done  bool
+	err   interface{}
+}
+
+//return(v)恢复执行时在yield处panic这个值，一路退出到函数体外
+type generatorReturn struct {
+	value JsValue
+}
+
+//被丢弃的generator恢复时在yield处panic这个值，和LimitError一样不会被catch，也不执行finally
+type generatorAbandoned struct{}
+
+func NewGenerator(fn *JsFunction, this JsValue, args []JsValue, stat *InterpreterStat) *JsValue {
+	g := newGenerator(stat)
+	core := g.generatorCore
+	core.body = func() *JsValue {
+		return core.stat.Call(fn, this, args)
+	}
+	return &JsValue{Value: g, Type: Generator}
+}
+
+func newGenerator(stat *InterpreterStat) *JsGenerator {
+	stat.Runtime.abandoned.release()
+	g := &generatorCore{
+		State: GeneratorSuspendedStart,
+		//函数体会修改Scope，需要和调用方分开
+		stat: &InterpreterStat{
+			Program: stat.Program,
+			Scope:   stat.Scope,
+			Runtime: stat.Runtime,
+			Visitor: stat.Visitor,
+		},
+		resume: make(chan generatorSignal),
+		yield:  make(chan generatorResult),
+	}
+	g.stat.Generator = g
+	handle := &JsGenerator{g}
+	abandoned := &stat.Runtime.abandoned
+	runtime.SetFinalizer(handle, func(handle *JsGenerator) {
+		abandoned.add(handle.generatorCore)
+	})
+	return handle
+}
+
+/*
+没有执行完就被丢弃的generator：函数体的goroutine一直阻塞在yield上，它引用的作用域也都无法回收。
+finalizer运行在单独的goroutine中，不能在那里恢复函数体，否则退出时的defer会和解释器同时修改Runtime，
+所以只记录下来，由解释器在下一次创建generator时逐个结束它们
+*/
+type abandonedGenerators struct {
+	sync.Mutex
+	list []*generatorCore
+}
+
+func (a *abandonedGenerators) add(g *generatorCore) {
+	a.Lock()
+	a.list = append(a.list, g)
+	a.Unlock()
+}
+
+func (a *abandonedGenerators) release() {
+	a.Lock()
+	list := a.list
+	a.list = nil
+	a.Unlock()
+	for _, g := range list {
+		if g.State == GeneratorSuspendedYield {
+			g.abandon()
+		}
+	}
+}
+
+//让挂起的函数体从yield处退出，goroutine随之结束。退出时的defer会恢复调用层数等状态，结束后改回原来的值
+func (g *generatorCore) abandon() {
+	rt := g.stat.Runtime
+	depth, current := rt.callDepth, rt.Current
+	g.State = GeneratorCompleted
+	g.resume <- generatorSignal{kind: signalAbandon}
+	<-g.yield
+	rt.callDepth, rt.Current = depth, current
+}
+
+func (g *generatorCore) run() {
+	<-g.resume
+	defer func() {
+		err := recover()
+		switch ret := err.(type) {
+		case nil:
+		case generatorReturn:
+			g.yield <- generatorResult{value: ret.value, done: true}
+		case generatorAbandoned:
+			g.yield <- generatorResult{done: true}
+		default:
+			g.yield <- generatorResult{value: JsValue{Type: Undefined}, done: true, err: err}
+		}
+	}()
+	returnValue := g.body()
+	g.yield <- generatorResult{value: *returnValue, done: true}
+}
+
+/*
+调用方恢复generator的执行，返回{ value, done }
+*/
+func (g *generatorCore) Resume(kind generatorSignalKind, value JsValue) *JsValue {
+	return NewIterResult(g.resumeRaw(generatorSignal{kind: kind, value: value}))
+}
+
+func (g *generatorCore) resumeRaw(signal generatorSignal) (JsValue, bool) {
+	kind, value := signal.kind, signal.value
+	switch g.State {
+	case GeneratorExecuting:
+		panic(RuntimeError{msg: "TypeError: Generator is already running"})
+	case GeneratorSuspendedStart:
+		//还没开始执行时return和throw直接结束generator
+		switch kind {
+		case signalReturn:
+			g.State = GeneratorCompleted
+			return value, true
+		case signalThrow:
+			g.State = GeneratorCompleted
+			panic(JsException{Loc: signal.loc, Value: value})
+		}
+		go g.run()
+	case GeneratorCompleted:
+		switch kind {
+		case signalReturn:
+			return value, true
+		case signalThrow:
+			panic(JsException{Loc: signal.loc, Value: value})
+		default:
+			return JsValue{Type: Undefined}, true
+		}
+	}
+
+	//函数体执行期间内置函数需要使用generator自己的stat
+	rt := g.stat.Runtime
+	//恢复执行相当于一层调用，函数体挂起时其中还没有返回的调用不计入调用方的层数
+	depth := rt.EnterCall()
+	caller := rt.Current
+	rt.Current = g.stat
+	g.State = GeneratorExecuting
+	g.resume <- signal
+	result := <-g.yield
+	rt.Current = caller
+	rt.LeaveCall(depth)
+	if result.done {
+		g.State = GeneratorCompleted
+	} else {
+		g.State = GeneratorSuspendedYield
+	}
+	if result.err != nil {
+		panic(result.err)
+	}
+	return result.value, result.done
+}
+
+/*
+在generator的goroutine中调用，把value交给调用方并等待下一次恢复
+next(v)时yield表达式的值是v，throw(v)在这里抛出异常，return(v)退出函数体
+*/
+func (g *generatorCore) Yield(value JsValue) JsValue {
+	signal := g.yieldRaw(generatorResult{value: value})
+	switch signal.kind {
+	case signalThrow:
+		panic(JsException{Loc: signal.loc, Value: signal.value})
+	case signalReturn:
+		panic(generatorReturn{signal.value})
+	default:
+		return signal.value
+	}
+}
+
+func (g *generatorCore) yieldRaw(result generatorResult) generatorSignal {
+	g.yield <- result
+	signal := <-g.resume
+	if signal.kind == signalAbandon {
+		panic(generatorAbandoned{})
+	}
+	return signal
+}
+
+//迭代器协议中next()返回的{ value, done }
+func NewIterResult(value JsValue, done bool) *JsValue {
+	return &JsValue{Value: NewObject(&ObjectPrototype, map[string]*JsValue{
+		"value": &value,
+		"done":  &JsValue{Value: done, Type: Boolean},
+	}), Type: Object}
+}
+
+var GeneratorPrototype = JsValue{Value: map[string]*JsValue{
+	"next": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
+		return *thisGenerator(this, "next").Resume(signalNext, argOrUndefined(args, 0))
+	}, Type: BuiltInFunction},
+	"return": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
+		return *thisGenerator(this, "return").Resume(signalReturn, argOrUndefined(args, 0))
+	}, Type: BuiltInFunction},
+	"throw": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
+		return *thisGenerator(this, "throw").Resume(signalThrow, argOrUndefined(args, 0))
+	}, Type: BuiltInFunction},
+}, Type: BuiltInObject}
+
+func thisGenerator(this JsValue, method string) *JsGenerator {
+	if this.Type != Generator {
+		panic(RuntimeError{msg: "TypeError: " + method + " method called on incompatible receiver " + ToString(&this).Value.(string)})
+	}
+	return this.Value.(*JsGenerator)
+}
+
+func argOrUndefined(args []JsValue, i int) JsValue {
+	if i < len(args) {
+		return args[i]
+	}
+	return JsValue{Type: Undefined}
+}
+
+/*
+迭代器协议：可迭代的值包括数组、字符串、generator对象，以及本身带有next方法的迭代器对象
+数组和字符串会被包装成一个带next方法的迭代器对象
+*/
+func (s *InterpreterStat) GetIterator(iterable *JsValue) *JsValue {
+	switch iterable.Type {
+	case Generator:
+		return iterable
+	case Array:
+		arr := iterable.Value.(*JsArray)
+		i := 0
+		return newBuiltInIterator(func() (JsValue, bool) {
+			if uint(i) >= arr.Length {
+				return JsValue{Type: Undefined}, true
+			}
+			i++
+			return *arr.Arr[i-1], false
+		})
+	case String:
+		chars := []rune(iterable.Str())
+		i := 0
+		return newBuiltInIterator(func() (JsValue, bool) {
+			if i >= len(chars) {
+				return JsValue{Type: Undefined}, true
+			}
+			i++
+			return JsValue{Value: string(chars[i-1]), Type: String}, false
+		})
+	case Object:
+		next := s.GetProperty(iterable, "next")
+		if next.Type == Function || next.Type == BuiltInFunction {
+			return iterable
+		}
+	}
+	panic(RuntimeError{msg: "TypeError: " + ToString(iterable).Value.(string) + " is not iterable"})
+}
+
+func newBuiltInIterator(next func() (JsValue, bool)) *JsValue {
+	return &JsValue{Value: NewObject(&ObjectPrototype, map[string]*JsValue{
+		"next": &JsValue{Value: func(this JsValue, args ...JsValue) JsValue {
+			return *NewIterResult(next())
+		}, Type: BuiltInFunction},
+	}), Type: Object}
+}
+
+//调用迭代器上的next/return/throw，返回结果对象以及done
+func (s *InterpreterStat) iteratorStep(iterator *JsValue, method string, value JsValue) (*JsValue, bool) {
+	result := s.CallFunction(s.GetProperty(iterator, method), *iterator, []JsValue{value})
+	if result.Type != Object {
+		panic(RuntimeError{msg: "TypeError: Iterator result " + ToString(result).Value.(string) + " is not an object"})
+	}
+	return result, IsTruthy(*s.GetProperty(result, "done"))
+}
+
+func (v *IVisitor) VisitYieldExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
+	yieldExpr := e.Data.(*ast_parser.EYield)
+	g := stat.Generator
+
+	value := JsValue{Type: Undefined}
+	if yieldExpr.Argument != nil {
+		value = EvaluateExpr(yieldExpr.Argument, stat)
+	}
+	if !yieldExpr.Delegate {
+		return g.Yield(value)
+	}
+
+	/*
+		yield* iterable：把内部迭代器的每个结果原样交给调用方，
+		调用方的next/throw/return转发给内部迭代器，内部迭代器结束时的value是yield*表达式的值
+	*/
+	iterator := stat.GetIterator(&value)
+	signal := generatorSignal{kind: signalNext, value: JsValue{Type: Undefined}}
+	for {
+		var result *JsValue
+		var done bool
+		switch signal.kind {
+		case signalThrow:
+			if throw := stat.GetProperty(iterator, "throw"); throw.Type == Undefined {
+				if ret := stat.GetProperty(iterator, "return"); ret.Type != Undefined {
+					stat.CallFunction(ret, *iterator, nil)
+				}
+				panic(RuntimeError{msg: "TypeError: The iterator does not provide a 'throw' method"})
+			}
+			result, done = stat.iteratorStep(iterator, "throw", signal.value)
+		case signalReturn:
+			if ret := stat.GetProperty(iterator, "return"); ret.Type == Undefined {
+				panic(generatorReturn{signal.value})
+			}
+			result, done = stat.iteratorStep(iterator, "return", signal.value)
+			if done {
+				panic(generatorReturn{*stat.GetProperty(result, "value")})
+			}
+		default:
+			result, done = stat.iteratorStep(iterator, "next", signal.value)
+		}
+		if done {
+			return *stat.GetProperty(result, "value")
+		}
+		signal = g.yieldRaw(generatorResult{value: *stat.GetProperty(result, "value")})
+	}
+}
@@ -0,0 +1,117 @@
+package ast_interpreter
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	t "testing"
+	"time"
+)
+
+func TestGenerator(t *t.T) {
+	stat, err := evaluate(`
+function* echo() {
+	let a = yield 1
+	let b = yield a + 1
+	return a + b
+}
+let it = echo()
+let first = it.next("ignored").value
+let second = it.next(10).value
+let last = it.next(5)
+let sum = last.value
+let finished = last.done
+
+let log = ""
+function* guarded() {
+	try { yield 1; log = log + "unreachable" } finally { log = log + "finally" }
+}
+it = guarded()
+it.next()
+let returned = it.return(7)
+let returnedValue = returned.value
+let returnedDone = returned.done
+let afterReturn = it.next().done
+
+it = guarded()
+let caughtBefore
+try { it.throw("before") } catch (e) { caughtBefore = e }
+let startedAfterThrow = it.next().done
+let caughtAfter
+try { it.throw("after") } catch (e) { caughtAfter = e }
+
+let received
+let innerCaught
+let innerFinally = false
+function* inner() {
+	received = yield "a"
+	try { yield "b" } catch (e) { innerCaught = e; yield "c" } finally { innerFinally = true }
+	return "inner done"
+}
+function* outer() { return yield* inner() }
+it = outer()
+let delegated = it.next().value + it.next("sent").value + it.throw("boom").value
+let forwarded = received
+let delegatedReturn = it.return(9)
+let delegatedReturnValue = delegatedReturn.value
+let delegatedDone = delegatedReturn.done
+it = outer()
+it.next()
+it.next()
+let innerResult = it.next().value
+
+let reentry
+function* self() { yield reentrant.next() }
+let reentrant = self()
+try { reentrant.next() } catch (e) { reentry = e }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"first": 1.0, "second": 11.0, "sum": 15.0, "finished": true,
+		"log": "finally", "returnedValue": 7.0, "returnedDone": true, "afterReturn": true,
+		"caughtBefore": "before", "startedAfterThrow": true, "caughtAfter": "after",
+		"forwarded": "sent", "innerCaught": "boom", "innerFinally": true, "delegated": "abc",
+		"delegatedReturnValue": 9.0, "delegatedDone": true, "innerResult": "inner done",
+	}
+	for name, value := range expected {
+		if got := stat.Scope.Get(name).Export(); got != value {
+			t.Errorf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+	if reentry, _ := stat.Scope.Get("reentry").Export().(string); !strings.HasPrefix(reentry, "TypeError: Generator is already running") {
+		t.Errorf("re-entering a running generator: got %q", reentry)
+	}
+}
+
+//丢弃没有执行完的generator后，它们的goroutine会在之后创建generator时结束，finally不会执行
+func TestAbandonedGenerators(t *t.T) {
+	//创建期间不回收，确认它们确实都挂起在自己的goroutine上
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	before := runtime.NumGoroutine()
+	stat, err := evaluate(`
+let ran = false
+function* g() { try { yield 1 } finally { ran = true } }
+for (let i = 0; i < 1000; i++) { g().next() }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.NumGoroutine() < before+900 {
+		t.Fatal("suspended generators should be running on their own goroutines")
+	}
+	debug.SetGCPercent(100)
+	create := parseExpr("g()")
+	for i := 0; i < 100 && runtime.NumGoroutine() > before+10; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		EvaluateExpr(create, stat)
+	}
+	if n := runtime.NumGoroutine(); n > before+10 {
+		t.Errorf("abandoned generators leaked %d goroutines", n-before)
+	}
+	if ran := stat.Scope.Get("ran").Export(); ran != false {
+		t.Error("finally in an abandoned generator should not run")
+	}
+}
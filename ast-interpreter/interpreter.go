@@ -4,69 +4,406 @@ import (
 	"fmt"
 	"jsInterpreter/ast_parser"
 	"jsInterpreter/logger"
+	"math"
+	"os"
+	"path/filepath"
 	"strconv"
 )
 
-func (s *InterpreterStat) Call(f *JsFunction, args []JsValue) (returnValue *JsValue) {
-	oldScope := s.Scope
-	returnValue = &JsValue{nil, Undefined}
+/*
+调用JS函数，函数体中的尾调用(return f())在这里循环执行，不再增加调用的层数
+*/
+func (s *InterpreterStat) Call(f *JsFunction, this JsValue, args []JsValue) (returnValue *JsValue) {
+	oldScope, oldStrict := s.Scope, s.Strict
+	depth := s.Runtime.EnterCall()
 	defer func() {
-		s.Scope = oldScope
-		err := recover()
-		if ret, hasReturn := err.(JsValue); hasReturn {
-			returnValue = &ret
-		} else if err != nil {
-			panic(err)
-		}
+		s.Scope, s.Strict = oldScope, oldStrict
+		s.Runtime.LeaveCall(depth)
 	}()
-	s.Scope = NewScope(f.Closure)
-	for i, arg := range args {
+	for {
+		c := s.callBody(f, this, args)
+		if c.Type != CompletionReturn {
+			return &JsValue{Type: Undefined}
+		}
+		call, isTail := c.Value.Value.(*tailCall)
+		if !isTail {
+			return c.Value
+		}
+		f, this, args = call.fn, call.this, call.args
+	}
+}
+
+//执行一次函数体，返回函数体的完成记录
+func (s *InterpreterStat) callBody(f *JsFunction, this JsValue, args []JsValue) Completion {
+	s.Scope = newScopeWithLayout(f.Closure, f.Body.Data.Layout)
+	s.Strict = f.Body.Strict
+	if !f.Arrow {
+		//非严格模式的函数中this为undefined或null时使用全局对象
+		if !f.Body.Strict && (this.Type == Undefined || this.Type == Null) {
+			this = *s.Runtime.Global
+		}
+		s.Scope.this = &this
+	}
+	if f.Name != nil {
+		s.Scope.Slots[f.Name.Index] = JsValue{Value: f, Type: Function}
+	}
+	for i := range args {
 		if i >= len(f.Params) {
 			break
 		}
+		if f.Params[i].Resolved {
+			s.Scope.Slots[f.Params[i].Index] = args[i]
+			continue
+		}
+		//不能取循环变量的地址，否则所有参数都指向同一个值
+		arg := args[i]
 		s.Scope.Set(f.Params[i].Value, &arg)
 	}
-	for _, stmt := range f.Body.Data.Data {
-		EvaluateStmt(stmt, s)
+	hoistDeclarations(f.Body.Data.Data, s, true)
+	//return的值作为返回值，throw变回panic，没有作用对象的break、continue被忽略
+	c := evaluateStmts(f.Body.Data.Data, s)
+	c.rethrow()
+	return c
+}
+
+/*
+尾调用：return f()不在这里调用f，而是把f和参数作为返回值交给Call，由Call在同一层中执行f
+只有普通的JS函数进行尾调用，generator、async、内置函数和其他引擎的函数直接调用
+*/
+type tailCall struct {
+	fn   *JsFunction
+	this JsValue
+	args []JsValue
+}
+
+//调用函数值，用户函数和内置函数都可以
+func (s *InterpreterStat) CallFunction(fn *JsValue, this JsValue, args []JsValue) *JsValue {
+	switch fn.Type {
+	case BuiltInFunction:
+		result := fn.Value.(func(JsValue, ...JsValue) JsValue)(this, args...)
+		return &result
+	case Function:
+		if c, isCallable := fn.Value.(Callable); isCallable {
+			return c.Call(this, args)
+		}
+		f := fn.Value.(*JsFunction)
+		if f.Generator {
+			//调用generator函数不执行函数体，而是返回generator对象
+			return NewGenerator(f, this, args, s)
+		}
+		if f.Async {
+			return s.Runtime.CallAsync(f, this, args, s)
+		}
+		return s.Call(f, this, args)
+	case BuiltInClass:
+		panic(RuntimeError{msg: "TypeError: Class constructor " + fn.Value.(*JsBuiltInClass).Name + " cannot be invoked without 'new'"})
+	default:
+		panic(RuntimeError{msg: ToString(fn).Value.(string) + " is not a function"})
+	}
+}
+
+/*
+读取属性，沿着原型链查找，getter会以obj作为this调用
+返回的是属性值的拷贝，修改属性需要通过SetProperty
+*/
+func (s *InterpreterStat) GetProperty(obj *JsValue, key string) *JsValue {
+	this := *obj
+	for obj != nil {
+		switch obj.Type {
+		case Object:
+			o := obj.Value.(*JsObject)
+			if prop, has := o.Get(key); has {
+				if prop.Type == Accessor {
+					getter := prop.Value.(*JsAccessor).Get
+					if getter == nil {
+						return &JsValue{Type: Undefined}
+					}
+					return s.CallFunction(getter, this, nil)
+				}
+				v := *prop
+				return &v
+			}
+			obj = o.Proto
+		case BuiltInObject:
+			if prop, has := obj.Value.(map[string]*JsValue)[key]; has {
+				v := *prop
+				return &v
+			}
+			obj = nil
+		case Generator:
+			obj = &GeneratorPrototype
+		case Promise:
+			obj = &PromisePrototype
+		case BuiltInClass:
+			if prop, has := obj.Value.(*JsBuiltInClass).Statics[key]; has {
+				v := *prop
+				return &v
+			}
+			obj = nil
+		case Array:
+			arr := obj.Value.(*JsArray)
+			if key == "length" {
+				return &JsValue{Type: Number, num: float64(arr.Length)}
+			}
+			if i, err := strconv.ParseUint(key, 10, 64); err == nil {
+				if i >= uint64(arr.Length) {
+					return &JsValue{Type: Undefined}
+				}
+				v := *arr.Arr[i]
+				return &v
+			}
+			obj = &ArrayPrototype
+		case String:
+			//下标访问时rope才拼接成完整的字符串
+			if key == "length" {
+				_, index := s.stringIndex(obj)
+				return &JsValue{Type: Number, num: float64(index.length)}
+			}
+			if i, err := strconv.ParseUint(key, 10, 64); err == nil {
+				//UTF-16的长度不会超过字节数
+				if i < uint64(stringPartLength(obj.Value)) {
+					str, index := s.stringIndex(obj)
+					if char, has := index.at(str, int(i)); has {
+						return &JsValue{Value: char, Type: String}
+					}
+				}
+				return &JsValue{Type: Undefined}
+			}
+			valWrap := Wrap(obj)
+			obj = valWrap.Value.(*JsValue)
+		case Undefined, Null:
+			panic(RuntimeError{msg: "Cannot read properties of " + ToString(obj).Value.(string) + " (reading '" + key + "')"})
+		default:
+			//装箱
+			valWrap := Wrap(obj)
+			obj = valWrap.Value.(*JsValue)
+		}
+	}
+	return &JsValue{Type: Undefined}
+}
+
+//key in obj，沿着原型链查找
+func (s *InterpreterStat) HasProperty(obj *JsValue, key string) bool {
+	for obj != nil {
+		switch obj.Type {
+		case Object:
+			o := obj.Value.(*JsObject)
+			if _, has := o.Get(key); has {
+				return true
+			}
+			obj = o.Proto
+		case BuiltInObject:
+			_, has := obj.Value.(map[string]*JsValue)[key]
+			return has
+		case Generator:
+			obj = &GeneratorPrototype
+		case Promise:
+			obj = &PromisePrototype
+		case BuiltInClass:
+			_, has := obj.Value.(*JsBuiltInClass).Statics[key]
+			return has
+		case Array:
+			arr := obj.Value.(*JsArray)
+			if i, err := strconv.ParseUint(key, 10, 64); key == "length" || (err == nil && i < uint64(arr.Length)) {
+				return true
+			}
+			obj = &ArrayPrototype
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+/*
+设置属性，自身或原型链上有setter时调用setter，否则在对象自身上定义数据属性
+*/
+func (s *InterpreterStat) SetProperty(obj *JsValue, key string, v *JsValue) {
+	switch obj.Type {
+	case Object:
+		for proto := obj; proto != nil && proto.Type == Object; proto = proto.Value.(*JsObject).Proto {
+			prop, has := proto.Value.(*JsObject).Get(key)
+			if !has {
+				continue
+			}
+			//只读属性：严格模式下抛出TypeError，否则忽略这次赋值
+			if proto.Value.(*JsObject).readOnly[key] {
+				if s.Strict {
+					panic(RuntimeError{msg: "TypeError: Cannot assign to read only property '" + key + "' of object"})
+				}
+				return
+			}
+			if prop.Type == Accessor {
+				if setter := prop.Value.(*JsAccessor).Set; setter != nil {
+					s.CallFunction(setter, *obj, []JsValue{*v})
+				} else if s.Strict {
+					panic(RuntimeError{msg: "TypeError: Cannot set property " + key + " of " + ToString(obj).Value.(string) + " which has only a getter"})
+				}
+				return
+			}
+			break
+		}
+		value := *v
+		o := obj.Value.(*JsObject)
+		if _, has := o.Get(key); !has {
+			s.Runtime.Alloc(cellSize + len(key))
+		}
+		o.Set(key, &value)
+	case Array:
+		arr := obj.Value.(*JsArray)
+		i, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			panic(RuntimeError{msg: "Cannot set property '" + key + "' of array"})
+		}
+		//先按增长的长度计入分配，arr[1e9] = 1超过预算时不会真的去分配
+		if i >= uint64(len(arr.Arr)) {
+			grow := i + 1 - uint64(len(arr.Arr))
+			if grow > math.MaxInt32 {
+				grow = math.MaxInt32
+			}
+			s.Runtime.Alloc(int(grow) * cellSize)
+		}
+		for uint64(len(arr.Arr)) <= i {
+			arr.Arr = append(arr.Arr, &JsValue{Type: Undefined})
+		}
+		value := *v
+		arr.Arr[i] = &value
+		arr.Length = uint(len(arr.Arr))
+	case Undefined, Null:
+		panic(RuntimeError{msg: "Cannot set properties of " + ToString(obj).Value.(string) + " (setting '" + key + "')"})
+	case Number, String, Boolean:
+		//基本类型上设置属性没有效果，严格模式下抛出异常
+		if s.Strict {
+			panic(RuntimeError{msg: "TypeError: Cannot create property '" + key + "' on " + TypeOf(obj) + " '" + ToString(obj).Value.(string) + "'"})
+		}
+	case BuiltInObject, BuiltInClass:
+		//内置的原型和构造函数上的属性是只读的
+		if s.Strict {
+			panic(RuntimeError{msg: "TypeError: Cannot assign to read only property '" + key + "' of object"})
+		}
 	}
-	return returnValue
 }
 
 type InterpreterStat struct {
 	Program *ast_parser.Stmt
 	Scope   *Scope
+	//正在执行的generator或async函数，yield和await通过它挂起当前的函数体
+	Generator *generatorCore
+	Runtime   *Runtime
+	//正在执行的代码是否是严格模式，进入函数时切换成函数自己的模式
+	Strict bool
 	Visitor
 }
 
+/*
+一个CodeRunner对应一个Runtime，generator和async函数在自己的goroutine中有单独的InterpreterStat，
+但是共享同一个Runtime
+*/
+type Runtime struct {
+	//正在执行JS代码的stat，内置函数需要回调JS函数时使用
+	Current *InterpreterStat
+	//微任务队列，每次执行完一段代码(宏任务)后清空
+	Microtasks []func()
+	//最近一次函数调用的位置，内置函数中reject的promise用它作为出错位置
+	CallSite logger.Loc
+	//当前执行的代码，用来打印出错位置
+	Log logger.Logger
+	//被reject时没有处理函数的promise
+	rejections []*JsPromise
+	Loader     *ModuleLoader
+	//全局对象globalThis，作用域链中找不到的名字在它的属性中查找
+	Global *JsValue
+	//函数调用的最大层数，为0时使用DefaultMaxCallDepth
+	MaxCallDepth int
+	callDepth    int
+	//执行之前优化语法树(-O)，之后加载的模块同样会被优化
+	Optimize bool
+	//执行预算，以及已经执行的步数、估算分配的字节数和下一次检查预算的步数
+	limits     Limits
+	steps      int64
+	heap       int64
+	checkpoint int64
+	interrupt  interruptState
+	//作用域分析驻留的名字，以及最近读取过下标的长字符串
+	names         InternTable
+	stringIndexes stringIndexCache
+	abandoned     abandonedGenerators
+}
+
+/*
+调用层数的默认上限，超过时抛出RangeError
+树遍历解释器每一层JS调用都会嵌套多层Go调用，不限制层数时无限递归会耗尽Go的栈，整个进程直接崩溃并且无法恢复
+*/
+const DefaultMaxCallDepth = 10000
+
+/*
+进入一层函数调用，超过上限时抛出可以被catch的RangeError
+返回进入之前的层数，调用结束(包括抛出异常)时交给LeaveCall恢复
+*/
+func (rt *Runtime) EnterCall() int {
+	limit := rt.MaxCallDepth
+	if limit <= 0 {
+		limit = DefaultMaxCallDepth
+	}
+	if rt.callDepth >= limit {
+		panic(RuntimeError{msg: "RangeError: Maximum call stack size exceeded"})
+	}
+	rt.callDepth++
+	return rt.callDepth - 1
+}
+
+func (rt *Runtime) LeaveCall(depth int) {
+	rt.callDepth = depth
+}
+
 func InitInterpreterStat(program *ast_parser.Stmt, visitor Visitor) *InterpreterStat {
 	scope := Scope{
 		Parent: nil,
 		Env:    map[string]*JsValue{},
 	}
 
-	console := NewJsValue(&JsObject{
-		Constructor: nil,
-		Properties:  map[string]*JsValue{},
-	})
-	console.Value.(*JsObject).Properties["log"] = NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
-		for _, arg := range args {
-			fmt.Println(ToString(&arg).Value)
-		}
-		return JsValue{nil, Undefined}
-	})
-	scope.Set("console", console)
+	console := NewJsValue(NewObject(nil, map[string]*JsValue{
+		"log": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			for _, arg := range args {
+				fmt.Println(ToString(&arg).Value)
+			}
+			return JsValue{Type: Undefined}
+		}),
+	}))
+	global := NewJsValue(&JsObject{})
+	globals := global.Value.(*JsObject)
+	globals.Set("globalThis", global)
+	globals.Set("console", console)
+	globals.SetReadOnly("undefined", &JsValue{Type: Undefined})
+	globals.SetReadOnly("NaN", &JsValue{Type: Number, num: math.NaN()})
+	globals.SetReadOnly("Infinity", &JsValue{Type: Number, num: math.Inf(1)})
+
+	runtime := &Runtime{Global: global}
+	runtime.Loader = NewModuleLoader(runtime, &scope, visitor)
+	globals.Set("Promise", NewPromiseClass(runtime))
 
 	interpreter := InterpreterStat{
 		Program: program,
 		Scope:   &scope,
+		Runtime: runtime,
 		Visitor: visitor,
 	}
+	runtime.Current = &interpreter
 	return &interpreter
 }
 
 type Scope struct {
 	Parent *Scope
 	Env    map[string]*JsValue
+	//经过作用域分析的变量按位置存放，layout记录每个位置的名字和声明方式
+	Slots  []JsValue
+	layout *ast_parser.ScopeLayout
+	//函数的this，箭头函数和块级作用域中为nil
+	this *JsValue
+	//执行前就已经创建好的变量，声明语句会写入原来的变量而不是创建新的，其他模块导入的正是这个变量
+	hoisted map[string]bool
+	//const声明的变量，赋值时抛出TypeError
+	consts map[string]bool
 }
 
 func NewScope(parent *Scope) *Scope {
@@ -76,21 +413,77 @@ func NewScope(parent *Scope) *Scope {
 	}
 }
 
-func (s *InterpreterStat) EnterScope() {
-	s.Scope = NewScope(s.Scope)
+//按照作用域分析得到的布局创建作用域，let/const在声明之前处于TDZ，layout为nil时变量按名字存放
+func newScopeWithLayout(parent *Scope, layout *ast_parser.ScopeLayout) *Scope {
+	if layout == nil {
+		return NewScope(parent)
+	}
+	scope := &Scope{Parent: parent, Slots: make([]JsValue, len(layout.Kinds)), layout: layout}
+	for i, kind := range layout.Kinds {
+		if kind != ast_parser.VVar {
+			scope.Slots[i].Type = Uninitialized
+		}
+	}
+	return scope
+}
+
+//进入块级作用域，返回原来的作用域。经过分析并且没有声明变量的块不需要创建作用域
+func (s *InterpreterStat) EnterScope(layout *ast_parser.ScopeLayout) *Scope {
+	parent := s.Scope
+	if layout == nil || len(layout.Kinds) > 0 {
+		s.Scope = newScopeWithLayout(parent, layout)
+	}
+	return parent
 }
 
-func (s *InterpreterStat) PopScope() {
-	s.Scope = s.Scope.Parent
+//离开块级作用域，回到EnterScope之前的作用域
+func (s *InterpreterStat) LeaveScope(parent *Scope) {
+	s.Scope = parent
 }
 
+//同一个父作用域下的新作用域，变量的值和s相同但不是同一个变量
+func (s *Scope) copyBindings() *Scope {
+	scope := &Scope{Parent: s.Parent, layout: s.layout, this: s.this, hoisted: s.hoisted, consts: s.consts}
+	if s.Slots != nil {
+		scope.Slots = append([]JsValue(nil), s.Slots...)
+	}
+	if s.Env != nil {
+		scope.Env = make(map[string]*JsValue, len(s.Env))
+		for name, value := range s.Env {
+			copied := *value
+			scope.Env[name] = &copied
+		}
+	}
+	return scope
+}
+
+//经过解析的标识符对应的变量和它的声明方式
+func (s *Scope) slot(id *ast_parser.EIdentifier) (*JsValue, ast_parser.VarKind) {
+	scope := s
+	for i := 0; i < id.Depth; i++ {
+		scope = scope.Parent
+	}
+	return &scope.Slots[id.Index], scope.layout.Kinds[id.Index]
+}
+
+//函数的this，箭头函数和块级作用域中使用外层函数的this，程序顶层没有this
+func (s *Scope) This() *JsValue {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if scope.this != nil {
+			return scope.this
+		}
+	}
+	return nil
+}
+
+//沿着作用域链查找变量，没有声明时返回nil
 func (s *Scope) Get(k string) *JsValue {
 	if v, has := s.Env[k]; has {
 		return v
 	} else if s.Parent != nil {
 		return s.Parent.Get(k)
 	} else {
-		return &JsValue{nil, Undefined}
+		return nil
 	}
 }
 
@@ -101,16 +494,196 @@ func (s *Scope) Set(k string, v *JsValue) {
 	s.Env[k] = v
 }
 
-func (s *Scope) Update(k string, v *JsValue) *JsValue {
-	if _, has := s.Env[k]; has {
-		s.Env[k] = v
+/*
+在执行之前创建变量，模块顶层的声明在链接阶段就要被其他模块引用
+*/
+func (s *Scope) Hoist(k string) *JsValue {
+	if s.hoisted == nil {
+		s.hoisted = map[string]bool{}
+	}
+	cell := &JsValue{Type: Undefined}
+	s.Set(k, cell)
+	s.hoisted[k] = true
+	return cell
+}
+
+//执行声明语句，变量被提前创建过时写入原来的变量
+func (s *Scope) Declare(k string, v *JsValue) {
+	if cell, has := s.Env[k]; has && (s.hoisted[k] || cell.Type == Uninitialized) {
+		*cell = *v
+		return
+	}
+	s.Set(k, v)
+}
+
+func (s *Scope) SetConst(k string, isConst bool) {
+	if s.consts == nil {
+		s.consts = map[string]bool{}
+	}
+	s.consts[k] = isConst
+}
+
+//let/const在声明之前处于TDZ
+func (s *Scope) DeclareUninitialized(k string, isConst bool) {
+	s.Declare(k, &JsValue{Type: Uninitialized})
+	s.SetConst(k, isConst)
+}
+
+/*
+进入作用域时提前创建其中声明的变量：函数声明直接创建好函数，let/const在执行到声明之前处于TDZ
+functionBody为true时还要把函数体中(不包括内层函数)所有的var提升到这里，值为undefined，
+和参数重名的var不会覆盖参数
+*/
+func hoistDeclarations(stmts []*ast_parser.Stmt, stat *InterpreterStat, functionBody bool) {
+	scope := stat.Scope
+	//经过分析的作用域在创建时已经准备好了var和let/const
+	if functionBody && scope.layout == nil {
+		for _, name := range varNames(stmts) {
+			if _, has := scope.Env[name]; !has {
+				scope.Set(name, &JsValue{Type: Undefined})
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		decl := stmt
+		if export, isExport := stmt.Data.(*ast_parser.SExportDecl); isExport {
+			decl = export.Decl
+		}
+		switch s := decl.Data.(type) {
+		case *ast_parser.SVarDecl:
+			if s.Kind() != ast_parser.VVar && !s.Id.Resolved {
+				scope.DeclareUninitialized(s.Id.Value, s.Kind() == ast_parser.VConst)
+			}
+		case *ast_parser.SExpr:
+			if fn, isFn := s.Data.(*ast_parser.EFunctionExpr); isFn && fn.Id != nil {
+				if fn.Id.Resolved {
+					scope.Slots[fn.Id.Index] = *newMethod(fn, stat)
+				} else {
+					scope.Declare(fn.Id.Value, newMethod(fn, stat))
+				}
+			}
+		}
+	}
+}
+
+//函数体中的var，内层函数中的var属于内层函数
+func varNames(stmts []*ast_parser.Stmt) []string {
+	names := []string{}
+	for _, stmt := range stmts {
+		ast_parser.Inspect(stmt, func(node ast_parser.Node) bool {
+			switch n := node.(type) {
+			case *ast_parser.Stmt:
+				if decl, isDecl := n.Data.(*ast_parser.SVarDecl); isDecl && decl.Kind() == ast_parser.VVar {
+					names = append(names, decl.Id.Value)
+				}
+			case *ast_parser.Expr:
+				switch n.Data.(type) {
+				case *ast_parser.EFunctionExpr, *ast_parser.EArrowFunction:
+					return false
+				}
+			case *ast_parser.ClassMember:
+				return false
+			}
+			return true
+		})
+	}
+	return names
+}
+
+//语句开头的具名function是函数声明，已经在进入作用域时创建好了
+func isFunctionDeclaration(stmt *ast_parser.Stmt) bool {
+	if s, isExpr := stmt.Data.(*ast_parser.SExpr); isExpr {
+		fn, isFn := s.Data.(*ast_parser.EFunctionExpr)
+		return isFn && fn.Id != nil
+	}
+	return false
+}
+
+//在新的块级作用域中执行语句
+func evaluateBlock(block *ast_parser.SBlock, stat *InterpreterStat) Completion {
+	defer stat.LeaveScope(stat.EnterScope(block.Layout))
+	hoistDeclarations(block.Data, stat, false)
+	return evaluateStmts(block.Data, stat)
+}
+
+/*
+给变量赋值，写入原来的变量，导入了这个变量的模块也能看到新的值
+const和TDZ中的变量不能赋值，作用域链中没有的名字写入全局对象的属性，
+全局对象上也没有时严格模式下抛出ReferenceError，非严格模式下在全局对象上创建这个属性
+*/
+func (s *InterpreterStat) AssignVariable(k string, v *JsValue, loc logger.Loc) *JsValue {
+	scope := s.Scope
+	for {
+		if cell, has := scope.Env[k]; has {
+			if cell.Type == Uninitialized {
+				panic(RuntimeError{loc, "ReferenceError: Cannot access '" + k + "' before initialization"})
+			}
+			if scope.consts[k] {
+				panic(RuntimeError{loc, "TypeError: Assignment to constant variable."})
+			}
+			*cell = *v
+			return v
+		}
+		if scope.Parent == nil {
+			break
+		}
+		scope = scope.Parent
+	}
+	if s.Strict && !s.HasProperty(s.Runtime.Global, k) {
+		panic(RuntimeError{loc, "ReferenceError: " + k + " is not defined"})
+	}
+	s.SetProperty(s.Runtime.Global, k, v)
+	return v
+}
+
+//读取变量，TDZ中的变量抛出ReferenceError，作用域链和全局对象上都没有的名字抛出ReferenceError
+func (s *InterpreterStat) ReadVariable(k string, loc logger.Loc) *JsValue {
+	if v := s.LookupVariable(k); v != nil {
+		if v.Type == Uninitialized {
+			panic(RuntimeError{loc, "ReferenceError: Cannot access '" + k + "' before initialization"})
+		}
 		return v
-	} else if s.Parent != nil {
-		return s.Parent.Update(k, v)
-	} else {
-		s.Env[k] = &JsValue{nil, Undefined}
-		return &JsValue{nil, Undefined}
 	}
+	panic(RuntimeError{loc, "ReferenceError: " + k + " is not defined"})
+}
+
+//读取标识符，经过解析的标识符直接按位置读取变量
+func (s *InterpreterStat) readIdentifier(id *ast_parser.EIdentifier, loc logger.Loc) *JsValue {
+	if !id.Resolved {
+		return s.ReadVariable(id.Value, loc)
+	}
+	v, _ := s.Scope.slot(id)
+	if v.Type == Uninitialized {
+		panic(RuntimeError{loc, "ReferenceError: Cannot access '" + id.Value + "' before initialization"})
+	}
+	return v
+}
+
+//给标识符赋值，没有经过解析的按名字赋值
+func (s *InterpreterStat) assignIdentifier(id *ast_parser.EIdentifier, v *JsValue, loc logger.Loc) *JsValue {
+	if !id.Resolved {
+		return s.AssignVariable(id.Value, v, loc)
+	}
+	cell, kind := s.Scope.slot(id)
+	if cell.Type == Uninitialized {
+		panic(RuntimeError{loc, "ReferenceError: Cannot access '" + id.Value + "' before initialization"})
+	}
+	if kind == ast_parser.VConst {
+		panic(RuntimeError{loc, "TypeError: Assignment to constant variable."})
+	}
+	*cell = *v
+	return v
+}
+
+//在作用域链和全局对象上查找名字，都没有时返回nil，typeof用它判断没有声明的变量
+func (s *InterpreterStat) LookupVariable(k string) *JsValue {
+	if v := s.Scope.Get(k); v != nil {
+		return v
+	}
+	if s.HasProperty(s.Runtime.Global, k) {
+		return s.GetProperty(s.Runtime.Global, k)
+	}
+	return nil
 }
 
 type RuntimeError struct {
@@ -118,62 +691,275 @@ type RuntimeError struct {
 	msg string
 }
 
+func NewRuntimeError(loc logger.Loc, msg string) RuntimeError {
+	return RuntimeError{loc, msg}
+}
+
+//JS代码中抛出的异常，例如generator.throw(value)
+type JsException struct {
+	Loc   logger.Loc
+	Value JsValue
+}
+
+//JsException和RuntimeError都可以被JS代码catch，返回被抛出的值
+func ThrownValue(err interface{}) (JsValue, logger.Loc, bool) {
+	switch e := err.(type) {
+	case JsException:
+		return e.Value, e.Loc, true
+	case RuntimeError:
+		return JsValue{Value: e.msg, Type: String}, e.Loc, true
+	default:
+		return JsValue{}, logger.Loc{}, false
+	}
+}
+
+//内置函数、属性访问等抛出的RuntimeError没有位置信息，用当前表达式的位置补上
+func fillLoc(loc logger.Loc) {
+	if err := recover(); err != nil {
+		switch e := err.(type) {
+		case RuntimeError:
+			if e.Loc == (logger.Loc{}) {
+				e.Loc = loc
+			}
+			panic(e)
+		case JsException:
+			if e.Loc == (logger.Loc{}) {
+				e.Loc = loc
+			}
+			panic(e)
+		case LimitError:
+			if e.Loc == (logger.Loc{}) {
+				e.Loc = loc
+			}
+			panic(e)
+		}
+		panic(err)
+	}
+}
+
+/*
+执行程序的引擎，CodeRunner默认使用树遍历的IVisitor，也可以换成vm包中的字节码虚拟机
+Compile中发现的错误(例如引擎不支持的语法)和语法错误一样在执行之前报告
+*/
+type Engine interface {
+	Compile(program *ast_parser.Stmt) (func(stat *InterpreterStat) Completion, []logger.Diagnostic)
+}
+
 type CodeRunner struct {
-	stat *InterpreterStat
-	ast  *ast_parser.Stmt
+	stat   *InterpreterStat
+	ast    *ast_parser.Stmt
+	engine Engine
 }
 
 func NewCodeRunner(ast *ast_parser.Stmt) CodeRunner {
+	stat := InitInterpreterStat(ast, &IVisitor{})
+	stat.Scope.Set("require", stat.Runtime.Loader.NewRequire(""))
 	return CodeRunner{
-		stat: InitInterpreterStat(ast, &IVisitor{}),
+		stat: stat,
 		ast:  ast,
 	}
 }
 
-func (runner *CodeRunner) Run(code string) {
+//之后的Run都使用engine执行，nil表示树遍历解释器
+func (runner *CodeRunner) SetEngine(engine Engine) {
+	runner.engine = engine
+}
+
+//之后的Run在执行之前优化语法树
+func (runner *CodeRunner) SetOptimize(optimize bool) {
+	runner.stat.Runtime.Optimize = optimize
+}
+
+//之后的Run中函数调用的最大层数，为0时使用DefaultMaxCallDepth
+func (runner *CodeRunner) SetMaxCallDepth(depth int) {
+	runner.stat.Runtime.MaxCallDepth = depth
+}
+
+//之后的每次Run都按limits限制执行，步数和分配的内存每次Run重新计算
+func (runner *CodeRunner) SetLimits(limits Limits) {
+	runner.stat.Runtime.SetLimits(limits)
+}
+
+//让正在执行的Run停止，可以在其他goroutine中调用，例如在命令行中按下Ctrl-C时
+func (runner *CodeRunner) Interrupt(reason string) {
+	runner.stat.Runtime.Interrupt(reason)
+}
+
+/*
+执行一段代码，语法错误和没有被catch的异常直接打印出来
+超出执行预算或者被打断时同样打印出来，丢掉还没执行的微任务，并且返回LimitError
+*/
+func (runner *CodeRunner) Run(code string) (err error) {
+	runtime := runner.stat.Runtime
+	defer func() {
+		recovered := recover()
+		runtime.clearInterrupt()
+		if limitErr, isLimit := recovered.(LimitError); isLimit {
+			runtime.Microtasks, runtime.rejections = nil, nil
+			err = limitErr
+		}
+		reportUncaught(recovered, runtime.Log)
+	}()
+	runner.stat.Runtime.resetBudget()
 	p := ast_parser.NewParser(code)
-	ast := p.Parse()
-	EvaluateStmt(&ast, runner.stat)
+	ast, diagnostics := p.Parse()
+	diagnostics = append(diagnostics, analyze(&ast, false, runner.stat.Runtime.Optimize, &runner.stat.Runtime.names)...)
+	run := func(stat *InterpreterStat) Completion {
+		return EvaluateStmt(&ast, stat)
+	}
+	if len(diagnostics) == 0 && runner.engine != nil {
+		run, diagnostics = runner.engine.Compile(&ast)
+	}
+	runner.stat.Runtime.Log = logger.Logger{Content: code}
+	if len(diagnostics) > 0 {
+		runner.stat.Runtime.Log.PrintDiagnostics(diagnostics)
+		return nil
+	}
+	run(runner.stat).rethrow()
+	runner.stat.Runtime.RunMicrotasks()
+	return nil
 }
 
 func Run(code string) {
+	stat := InitInterpreterStat(nil, &IVisitor{})
+	runtime := stat.Runtime
+	runtime.Log = logger.Logger{Content: code}
 	defer func() {
-		err := recover()
-		if err != nil {
-			if err, isRuntimeErr := err.(RuntimeError); isRuntimeErr {
-				log := logger.Logger{Content: code}
-				log.Print(logger.LError, err.Loc, err.msg)
-			} else {
-				panic(err)
-			}
-		}
+		reportUncaught(recover(), runtime.Log)
 	}()
 
 	p := ast_parser.NewParser(code)
-	if p.HasError {
+	ast, diagnostics := p.Parse()
+	diagnostics = append(diagnostics, analyze(&ast, false, false, &runtime.names)...)
+	if len(diagnostics) > 0 {
+		runtime.Log.PrintDiagnostics(diagnostics)
 		fmt.Println("program stops due to error")
 		return
 	}
-	ast := p.Parse()
-	visitor := IVisitor{}
-	stat := InitInterpreterStat(&ast, &visitor)
+	stat.Program = &ast
+	stat.Scope.Set("require", runtime.Loader.NewRequire(""))
+	EvaluateStmt(&ast, stat).rethrow()
+	runtime.RunMicrotasks()
+}
 
-	EvaluateStmt(&ast, stat)
+/*
+按照模块执行代码，模块顶层可以使用import、export和await，相对路径相对于当前目录
+*/
+func RunModule(code string) {
+	runModule("", code, false)
 }
 
-func EvaluateExpr(ast *ast_parser.Expr, stat *InterpreterStat) *JsValue {
+/*
+执行一个文件，按照ES模块或CommonJS执行由IsESModule决定，
+它导入的模块相对于这个文件所在的目录加载，optimize为true时执行之前优化每个模块的语法树
+*/
+func RunFile(path string, optimize bool) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	code := string(data)
+	if IsESModule(path, code) {
+		runModule(path, code, optimize)
+	} else {
+		runCommonJS(path, code, optimize)
+	}
+	return nil
+}
+
+func runModule(path string, code string, optimize bool) {
+	stat := InitInterpreterStat(nil, &IVisitor{})
+	runtime := stat.Runtime
+	runtime.Optimize = optimize
+	runtime.Log = logger.Logger{Content: code, File: path}
+	defer func() {
+		//出错的位置在哪个模块中，runtime.Log就是哪个模块的代码
+		reportUncaught(recover(), runtime.Log)
+	}()
+
+	loader := runtime.Loader
+	m := loader.load(path, code)
+	loader.Link(m)
+	loader.Evaluate(m)
+	runtime.RunMicrotasks()
+}
+
+func runCommonJS(path string, code string, optimize bool) {
+	stat := InitInterpreterStat(nil, &IVisitor{})
+	runtime := stat.Runtime
+	runtime.Optimize = optimize
+	runtime.Log = logger.Logger{Content: code, File: path}
+	defer func() {
+		reportUncaught(recover(), runtime.Log)
+	}()
+
+	runtime.Loader.RunCommonJS(path, code)
+	runtime.RunMicrotasks()
+}
+
+//打印没有被catch的异常，其他的panic继续向上传递
+func reportUncaught(err interface{}, log logger.Logger) {
+	switch err := err.(type) {
+	case nil:
+	case RuntimeError:
+		printError(log, err.Loc, err.msg)
+	case JsException:
+		printError(log, err.Loc, "Uncaught "+ToString(&err.Value).Value.(string))
+	case LimitError:
+		printError(log, err.Loc, err.Error())
+	default:
+		panic(err)
+	}
+}
+
+func printError(log logger.Logger, loc logger.Loc, msg string) {
+	if loc == (logger.Loc{}) {
+		fmt.Println(msg)
+	} else {
+		log.Print(logger.LError, loc, msg)
+	}
+}
+
+/*
+模块的顶层代码相当于一个async函数的函数体，直接在stat.Scope中执行，遇到顶层await时挂起，
+返回模块执行完成的promise
+*/
+func EvaluateModuleBody(ast *ast_parser.Stmt, stat *InterpreterStat) *JsValue {
+	program := ast.Data.(*ast_parser.SProgram)
+	g := newGenerator(stat)
+	g.stat.Strict = program.Strict
+	g.body = func() *JsValue {
+		hoistDeclarations(program.Body, g.stat, true)
+		evaluateStmts(program.Body, g.stat).rethrow()
+		return &JsValue{Type: Undefined}
+	}
+	return stat.Runtime.runAsync(g)
+}
+
+func EvaluateExpr(ast *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	stat.Runtime.Step()
 	switch t := ast.Data.(type) {
 	case *ast_parser.EAssign:
 		return stat.Visitor.VisitAssignExpr(ast, stat)
+	case *ast_parser.ESequence:
+		return stat.Visitor.VisitSequenceExpr(ast, stat)
 	case *ast_parser.ENumericLiteral:
 		num, _ := strconv.ParseFloat(t.Value, 64)
-		return &JsValue{num, Number}
+		return JsValue{Type: Number, num: num}
 	case *ast_parser.EStringLiteral:
-		return &JsValue{t.Value, String}
+		return JsValue{Value: t.Value, Type: String}
 	case *ast_parser.EBoolLiteral:
-		return &JsValue{t.Value, Boolean}
+		return JsValue{Value: t.Value, Type: Boolean}
+	case *ast_parser.ENullLiteral:
+		return JsValue{Type: Null}
 	case *ast_parser.EBinary:
 		return stat.Visitor.VisitBinaryExpr(ast, stat)
+	case *ast_parser.EConditional:
+		return stat.Visitor.VisitConditionalExpr(ast, stat)
 	case *ast_parser.EUnary:
 		return stat.Visitor.VisitUnaryExpr(ast, stat)
 	case *ast_parser.EMemberExpr:
@@ -185,37 +971,73 @@ func EvaluateExpr(ast *ast_parser.Expr, stat *InterpreterStat) *JsValue {
 	case *ast_parser.ECallExpr:
 		return stat.Visitor.VisitCallExpr(ast, stat)
 	case *ast_parser.EIdentifier:
-		return stat.Scope.Get(t.Value)
+		return *stat.readIdentifier(t, ast.Loc)
 	case *ast_parser.EParen:
 		return stat.Visitor.VisitParen(ast, stat)
 	case *ast_parser.EFunctionExpr:
 		return stat.VisitFuncExpr(ast, stat)
 	case *ast_parser.EIndex:
 		return stat.Visitor.VisitIndexExpr(ast, stat)
+	case *ast_parser.EThis:
+		if this := stat.Scope.This(); this != nil {
+			return *this
+		}
+		return JsValue{Type: Undefined}
+	case *ast_parser.EYield:
+		return stat.Visitor.VisitYieldExpr(ast, stat)
+	case *ast_parser.EAwait:
+		return stat.Visitor.VisitAwaitExpr(ast, stat)
+	case *ast_parser.EArrowFunction:
+		return stat.Visitor.VisitArrowFunction(ast, stat)
+	case *ast_parser.ENew:
+		return stat.Visitor.VisitNewExpr(ast, stat)
+	case *ast_parser.EImportCall:
+		return stat.Visitor.VisitImportCall(ast, stat)
 	default:
-		return &JsValue{nil, Undefined}
+		return JsValue{Type: Undefined}
 	}
 }
 
-func EvaluateStmt(ast *ast_parser.Stmt, stat *InterpreterStat) {
+func EvaluateStmt(ast *ast_parser.Stmt, stat *InterpreterStat) Completion {
 	if ast.Data == nil {
-		return
+		return Completion{}
 	}
+	stat.Runtime.Step()
 
 	switch ast.Data.(type) {
 	case *ast_parser.SProgram:
-		stat.Visitor.VisitProgram(ast, stat)
+		return stat.Visitor.VisitProgram(ast, stat)
 	case *ast_parser.SFor:
-		stat.Visitor.VisitForLoopStmt(ast, stat)
+		return stat.Visitor.VisitForLoopStmt(ast, stat)
 	case *ast_parser.SCondition:
-		stat.Visitor.VisitConditionStmt(ast, stat)
+		return stat.Visitor.VisitConditionStmt(ast, stat)
 	case *ast_parser.SFunctionDecl:
-		stat.Visitor.VisitFuncStmt(ast, stat)
+		return stat.Visitor.VisitFuncStmt(ast, stat)
+	case *ast_parser.SBlock:
+		return stat.Visitor.VisitBlockStmt(ast, stat)
+	case *ast_parser.SLabeled:
+		return stat.Visitor.VisitLabeledStmt(ast, stat)
+	case *ast_parser.SBreak:
+		return stat.Visitor.VisitBreakStmt(ast, stat)
+	case *ast_parser.SContinue:
+		return stat.Visitor.VisitContinueStmt(ast, stat)
 	case *ast_parser.SExpr:
+		if isFunctionDeclaration(ast) {
+			return Completion{}
+		}
 		stat.Visitor.VisitExpr(&ast.Data.(*ast_parser.SExpr).Expr, stat)
 	case *ast_parser.SReturn:
-		stat.Visitor.VisitReturnStmt(ast, stat)
+		return stat.Visitor.VisitReturnStmt(ast, stat)
 	case *ast_parser.SVarDecl:
-		stat.Visitor.VisitVarDeclStmt(ast, stat)
+		return stat.Visitor.VisitVarDeclStmt(ast, stat)
+	case *ast_parser.SThrow:
+		return stat.Visitor.VisitThrowStmt(ast, stat)
+	case *ast_parser.STry:
+		return stat.Visitor.VisitTryStmt(ast, stat)
+	case *ast_parser.SExportDecl, *ast_parser.SExportDefault:
+		return stat.Visitor.VisitExportStmt(ast, stat)
+	case *ast_parser.SImport, *ast_parser.SExportNamed, *ast_parser.SExportAll:
+		//在链接模块时已经处理过
 	}
+	return Completion{}
 }
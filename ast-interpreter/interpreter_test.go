@@ -0,0 +1,389 @@
+package ast_interpreter
+
+import (
+	"context"
+	"errors"
+	"jsInterpreter/ast_parser"
+	"strings"
+	t "testing"
+	"time"
+)
+
+//执行一段代码，返回执行后的stat和抛出的错误
+func evaluate(code string) (stat *InterpreterStat, err interface{}) {
+	return evaluateAST(code, false)
+}
+
+//resolve为true时先进行作用域分析，变量按位置存放
+func evaluateAST(code string, resolve bool) (stat *InterpreterStat, err interface{}) {
+	p := ast_parser.NewParser(code)
+	ast, _ := p.Parse()
+	if resolve {
+		analyze(&ast, false, false, nil)
+	}
+	stat = InitInterpreterStat(&ast, &IVisitor{})
+	defer func() {
+		err = recover()
+	}()
+	EvaluateStmt(&ast, stat).rethrow()
+	return stat, nil
+}
+
+func errorMessage(err interface{}) string {
+	if runtimeErr, isErr := err.(RuntimeError); isErr {
+		return runtimeErr.msg
+	}
+	return ""
+}
+
+func TestHoisting(t *t.T) {
+	stat, err := evaluate(`
+let before = f()
+function f() { return 1 }
+function g() {
+	if (true) { var inner = 2; let hidden = 3 }
+	return inner + (typeof hidden === "undefined" ? 0 : 100)
+}
+let fromG = g()
+let fromVar = v
+var v = 4
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"before": 1.0, "fromG": 2.0, "fromVar": nil, "v": 4.0}
+	for name, value := range expected {
+		if got := stat.Scope.Get(name).Export(); got != value {
+			t.Errorf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+}
+
+func TestTDZAndConst(t *t.T) {
+	cases := map[string]string{
+		"x; let x = 1":                            "ReferenceError: Cannot access 'x' before initialization",
+		"function f() { return y } f(); let y":    "ReferenceError: Cannot access 'y' before initialization",
+		"z = 1; let z":                            "ReferenceError: Cannot access 'z' before initialization",
+		"const c = 1; c = 2":                      "TypeError: Assignment to constant variable.",
+		"const c = 1; { c++ }":                    "TypeError: Assignment to constant variable.",
+		"'use strict'; undeclared = 1":            "ReferenceError: undeclared is not defined",
+		"let ok = 1; { let ok = 2; ok = 3 } ok++": "",
+	}
+	for code, expected := range cases {
+		_, err := evaluate(code)
+		if got := errorMessage(err); !strings.HasPrefix(got, expected) || (expected == "" && err != nil) {
+			t.Errorf("%s: expected %q, got %v", code, expected, err)
+		}
+	}
+}
+
+//in的右边是原始值时抛出TypeError，函数、数组和promise都可以作为右边
+func TestInOperator(t *t.T) {
+	for code, expected := range map[string]string{
+		`"a" in 1`:         "TypeError: Cannot use 'in' operator to search for 'a' in 1",
+		`"a" in "str"`:     "TypeError: Cannot use 'in' operator to search for 'a' in str",
+		`0 in undefined`:   "TypeError: Cannot use 'in' operator to search for '0' in undefined",
+		`"x" in null`:      "TypeError: Cannot use 'in' operator to search for 'x' in null",
+		`"length" in true`: "TypeError: Cannot use 'in' operator to search for 'length' in true",
+	} {
+		_, err := evaluate(code)
+		if got := errorMessage(err); got != expected {
+			t.Errorf("%s: expected %q, got %v", code, expected, err)
+		}
+	}
+
+	stat, err := evaluate(`
+function f() {}
+let results = [("a" in f), ("length" in [1]), (0 in [1]), (1 in [1]), ("then" in Promise.resolve(1)), ("resolve" in Promise), ("x" in { x: 1 })]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{false, true, true, false, true, true, true}
+	results := stat.Scope.Get("results").Value.(*JsArray)
+	for i, value := range expected {
+		if got := results.Arr[i].Value; got != value {
+			t.Errorf("results[%d]: expected %v, got %v", i, value, got)
+		}
+	}
+}
+
+func TestGlobals(t *t.T) {
+	_, err := evaluate("let a = 1\nlet b = a + missing")
+	if runtimeErr, isErr := err.(RuntimeError); !isErr || runtimeErr.msg != "ReferenceError: missing is not defined" || runtimeErr.Loc.Line != 2 {
+		t.Errorf("expected ReferenceError at line 2, got %v", err)
+	}
+
+	stat, err := evaluate(`
+let kind = typeof missing
+function f() { created = 1; return this }
+let self = f()
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := stat.Scope.Get("kind").Value; kind != "undefined" {
+		t.Errorf("typeof undeclared: got %v", kind)
+	}
+	globals := stat.Runtime.Global.Value.(*JsObject)
+	if created, has := globals.Get("created"); !has || created.Export() != 1.0 {
+		t.Error("sloppy assignment should create a property on the global object")
+	}
+	if self := stat.Scope.Get("self"); self.Value != stat.Runtime.Global.Value {
+		t.Error("this in sloppy functions should be the global object")
+	}
+
+	stat, err = evaluate(`
+let a = undefined
+let notANumber = NaN !== NaN
+let infinite = Infinity > 1000000000
+undefined = 1
+let stillUndefined = typeof undefined
+let deleted = delete globalThis.Infinity
+let readOnly = (function () { "use strict"; try { NaN = 1 } catch (e) { return e } })()
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": nil, "notANumber": true, "infinite": true, "stillUndefined": "undefined", "deleted": false,
+		"readOnly": "TypeError: Cannot assign to read only property 'NaN' of object",
+	}
+	for name, value := range expected {
+		if got := stat.Scope.Get(name).Export(); got != value {
+			t.Errorf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+}
+
+func TestCompletions(t *t.T) {
+	stat, err := evaluate(`
+let count = 0
+for (let i = 0; i < 100000; i++) { if (i % 2) { continue } count++ }
+let pairs = ""
+outer: for (let i = 0; ; i++) {
+	for (let j = 0; j < 3; j++) {
+		if (j == 1) { continue outer }
+		if (i == 2) { break outer }
+		pairs = pairs + i + j
+	}
+}
+function finallyWins() { try { return 1 } finally { return 2 } }
+function caught() { try { throw 3 } catch (e) { return e } }
+let finallyResult = finallyWins()
+let caughtResult = caught()
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"count": 50000.0, "pairs": "0010", "finallyResult": 2.0, "caughtResult": 3.0}
+	for name, value := range expected {
+		if got := stat.Scope.Get(name).Export(); got != value {
+			t.Errorf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+
+	_, err = evaluate("function f() { throw 'x' }\nf()")
+	if exception, isException := err.(JsException); !isException || exception.Value.Value != "x" {
+		t.Errorf("throw should escape the function as an exception, got %v", err)
+	}
+}
+
+//for头部的let每次循环都是新的变量，按名字存放和按位置存放时都一样
+func TestLoopBindings(t *t.T) {
+	code := `
+let fns = []
+for (let i = 0; i < 3; i++) { fns.push(() => i) }
+let skipped = []
+for (let j = 0; j < 3; j++) { skipped.push(() => j); if (j == 1) { continue } }
+for (var k = 0; k < 2; k++) { }
+let first = fns[0]()
+let last = fns[2]()
+let afterContinue = skipped[1]()
+`
+	for _, resolve := range []bool{false, true} {
+		stat, err := evaluateAST(code, resolve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{"first": 0.0, "last": 2.0, "afterContinue": 1.0, "k": 2.0}
+		for name, value := range expected {
+			if got := stat.Scope.Get(name).Export(); got != value {
+				t.Errorf("resolve %v, %s: expected %v, got %v", resolve, name, value, got)
+			}
+		}
+	}
+}
+
+func TestSlotResolution(t *t.T) {
+	code := `
+let total = 0
+function sum(n, unused) {
+	let s = 0
+	for (let i = 0; i < n; i++) { { s = s + i } }
+	return [s, typeof unused]
+}
+let named = function fact(k) { return k <= 1 ? 1 : k * fact(k - 1) }
+let shadowed = function g(g) { return g }
+let m = 1
+let obj = { m() { return m } }
+function counter() { let c = 0; return () => { c++; return c } }
+let next = counter()
+next()
+function tdz() { try { return z } catch (e) { return e } let z }
+let result = sum(5)
+total = result[0] + named(5) + shadowed(3) + obj.m() + next()
+let kind = result[1]
+let tdzError = tdz()
+`
+	p := ast_parser.NewParser(code)
+	program, _ := p.Parse()
+	analyze(&program, false, false, nil)
+	//s = s + i跳过了没有声明的块和循环体，和函数作用域之间只隔着for头部的作用域
+	ast_parser.Inspect(&program, func(node ast_parser.Node) bool {
+		if expr, isExpr := node.(*ast_parser.Expr); isExpr {
+			if assign, isAssign := expr.Data.(*ast_parser.EAssign); isAssign {
+				if id, isId := assign.Target.Data.(*ast_parser.EIdentifier); isId && id.Value == "s" && (!id.Resolved || id.Depth != 1 || id.Index != 2) {
+					t.Errorf("s: expected depth 1 index 2, got %+v", *id)
+				}
+			}
+		}
+		return true
+	})
+
+	expected := map[string]interface{}{"total": 10.0 + 120 + 3 + 1 + 2, "kind": "undefined",
+		"tdzError": "ReferenceError: Cannot access 'z' before initialization"}
+	for _, resolve := range []bool{false, true} {
+		stat, err := evaluateAST(code, resolve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range expected {
+			if got := stat.Scope.Get(name).Export(); got != value {
+				t.Errorf("resolve=%v %s: expected %v, got %v", resolve, name, value, got)
+			}
+		}
+	}
+}
+
+//数字的算术、位运算和比较
+var binaryExprs = []string{"a + b", "a * b - a / b", "a % b ** 2", "a & b | a << 2", "a < b", "a === b", "a !== b && a >= b"}
+
+func parseExpr(code string) *ast_parser.Expr {
+	p := ast_parser.NewParser(code)
+	ast, _ := p.Parse()
+	return &ast.Data.(*ast_parser.SProgram).Body[0].Data.(*ast_parser.SExpr).Expr
+}
+
+func allocsPerRun(f func()) float64 {
+	return t.AllocsPerRun(100, f)
+}
+
+//值按值传递，数字存放在JsValue中，计算二元表达式不分配内存
+func TestBinaryExprAllocs(t *t.T) {
+	stat, _ := evaluate("let a = 3\nlet b = 4")
+	for _, code := range binaryExprs {
+		expr := parseExpr(code)
+		if allocs := allocsPerRun(func() { EvaluateExpr(expr, stat) }); allocs != 0 {
+			t.Errorf("%s: expected no allocation, got %v", code, allocs)
+		}
+	}
+}
+
+func BenchmarkBinaryExpr(b *t.B) {
+	stat, _ := evaluate("let a = 3\nlet b = 4")
+	for _, code := range binaryExprs {
+		expr := parseExpr(code)
+		b.Run(code, func(b *t.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				EvaluateExpr(expr, stat)
+			}
+		})
+	}
+}
+
+func TestCallDepth(t *t.T) {
+	stat, err := evaluate(`
+function down(n) { return n === 0 ? 0 : 1 + down(n - 1) }
+function forever() { return forever() + 1 }
+let caught
+try { forever() } catch (e) { caught = e }
+let after = down(100)
+function loop(n) { "use strict"; if (n === 0) { return "done" } return loop(n - 1) }
+let tail = loop(100000)
+function inTry(n) { "use strict"; try { if (n === 0) { return "ok" } return inTry(n - 1) } finally { } }
+let notTail
+try { inTry(100000) } catch (e) { notTail = e }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const overflow = "RangeError: Maximum call stack size exceeded"
+	expected := map[string]interface{}{"caught": overflow, "after": 100.0, "tail": "done", "notTail": overflow}
+	for name, value := range expected {
+		if got := stat.Scope.Get(name).Export(); got != value {
+			t.Errorf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+
+	stat, _ = evaluate("")
+	stat.Runtime.MaxCallDepth = 10
+	p := ast_parser.NewParser("function f(n) { return n === 0 ? 0 : 1 + f(n - 1) }\nf(20)")
+	program, _ := p.Parse()
+	defer func() {
+		if got := errorMessage(recover()); got != overflow {
+			t.Errorf("expected %q with MaxCallDepth 10, got %q", overflow, got)
+		}
+	}()
+	EvaluateStmt(&program, stat).rethrow()
+}
+
+func TestLimits(t *t.T) {
+	cases := []struct {
+		code   string
+		limits Limits
+		err    error
+	}{
+		{"for (;;) {}", Limits{MaxSteps: 10000}, ErrStepLimit},
+		{"function f() { try { for (;;) {} } catch (e) {} finally { return 1 } }\nf()", Limits{MaxSteps: 10000}, ErrStepLimit},
+		{"let a = []\nfor (let i = 0; ; i++) { a[i] = { value: i } }", Limits{MaxHeap: 1 << 20}, ErrHeapLimit},
+		{"let a = []\na[1000000000] = 1", Limits{MaxHeap: 1 << 20}, ErrHeapLimit},
+		{"let s = ''\nfor (let i = 0; ; i++) { s = s + i }", Limits{MaxHeap: 1 << 20}, ErrHeapLimit},
+		{"let a = []\nfor (let i = 0; i < 100; i++) { a[i] = 'item' + i }", Limits{MaxSteps: 100000, MaxHeap: 1 << 20}, nil},
+	}
+	for _, c := range cases {
+		runner := NewCodeRunner(nil)
+		runner.SetLimits(c.limits)
+		if err := runner.Run(c.code); !errors.Is(err, c.err) || (c.err == nil && err != nil) {
+			t.Errorf("%q: expected %v, got %v", c.code, c.err, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	runner := NewCodeRunner(nil)
+	runner.SetLimits(Limits{Context: ctx})
+	if err := runner.Run("for (;;) {}"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestInterrupt(t *t.T) {
+	runner := NewCodeRunner(nil)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		runner.Interrupt("stop")
+	}()
+	err := runner.Run("let after = 0\ntry { for (;;) {} } catch (e) { after = 1 } finally { after = 2 }")
+	if interrupt := (InterruptError{}); !errors.As(err, &interrupt) || interrupt.Reason != "stop" {
+		t.Fatalf("expected InterruptError, got %v", err)
+	}
+	//中断不能被catch和finally拦截，也不会影响之后的执行
+	if err := runner.Run("after = after + 10"); err != nil {
+		t.Fatal(err)
+	}
+	if after := runner.stat.Scope.Get("after").Export(); after != 10.0 {
+		t.Errorf("expected catch and finally to be skipped, got %v", after)
+	}
+}
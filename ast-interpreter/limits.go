@@ -0,0 +1,169 @@
+package ast_interpreter
+
+import (
+	"context"
+	"errors"
+	"jsInterpreter/logger"
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+/*
+执行预算：宿主执行不可信的代码时限制执行的步数、时间和分配的内存
+超出预算时抛出LimitError，它不是JS的异常，try/catch不会捕获，finally也不会执行，一直传到宿主
+*/
+type Limits struct {
+	//最多执行的步数，树遍历解释器每个语句和表达式算一步，虚拟机每条指令算一步，为0时不限制
+	MaxSteps int64
+	//被取消或者超过deadline时停止执行，为nil时不限制
+	Context context.Context
+	//创建数组、对象和字符串时估算分配的字节数的上限，不减去被回收的内存，为0时不限制
+	MaxHeap int64
+}
+
+var (
+	ErrStepLimit = errors.New("step limit exceeded")
+	ErrHeapLimit = errors.New("heap limit exceeded")
+)
+
+/*
+超出执行预算或者被Interrupt打断时抛出的错误，Err是ErrStepLimit、ErrHeapLimit、Context.Err()或者InterruptError，
+宿主可以用errors.Is(err, context.DeadlineExceeded)、errors.As(err, &InterruptError{})等区分
+*/
+type LimitError struct {
+	Loc logger.Loc
+	Err error
+}
+
+func (e LimitError) Error() string {
+	return "execution aborted: " + e.Err.Error()
+}
+
+func (e LimitError) Unwrap() error {
+	return e.Err
+}
+
+//Interrupt打断执行时LimitError中的错误，Reason是调用Interrupt时给出的原因
+type InterruptError struct {
+	Reason string
+}
+
+func (e InterruptError) Error() string {
+	return "interrupted: " + e.Reason
+}
+
+//每执行这么多步检查一次Context，检查需要加锁，不能每一步都检查
+const contextCheckInterval = 1024
+
+//估算分配的字节数时使用的大小，对象的每个属性和数组的每个元素都是一个指针和它指向的JsValue
+const (
+	valueSize  = int(unsafe.Sizeof(JsValue{}))
+	cellSize   = valueSize + int(unsafe.Sizeof(uintptr(0)))
+	objectSize = int(unsafe.Sizeof(JsObject{}))
+	arraySize  = int(unsafe.Sizeof(JsArray{}))
+	ropeSize   = int(unsafe.Sizeof(JsRope{}))
+)
+
+//设置执行预算，已经执行的步数和分配的内存从0开始重新计算
+func (rt *Runtime) SetLimits(limits Limits) {
+	rt.limits = limits
+	rt.resetBudget()
+}
+
+func (rt *Runtime) resetBudget() {
+	rt.steps, rt.heap = 0, 0
+	rt.resetCheckpoint()
+}
+
+/*
+在下一个安全点(Step)停止执行，抛出InterruptError，可以在其他goroutine中调用
+在Run之外调用时打断的是下一次Run，Run结束时清除这次执行中没有生效的中断
+*/
+func (rt *Runtime) Interrupt(reason string) {
+	rt.interrupt.Lock()
+	rt.interrupt.reason = reason
+	rt.interrupt.Unlock()
+	atomic.StoreInt32(&rt.interrupt.pending, 1)
+}
+
+func (rt *Runtime) clearInterrupt() {
+	atomic.StoreInt32(&rt.interrupt.pending, 0)
+}
+
+//执行一步，步数到达检查点或者有中断时检查执行预算
+func (rt *Runtime) Step() {
+	rt.steps++
+	if rt.steps >= rt.checkpoint || atomic.LoadInt32(&rt.interrupt.pending) != 0 {
+		rt.checkLimits()
+	}
+}
+
+func (rt *Runtime) checkLimits() {
+	if atomic.CompareAndSwapInt32(&rt.interrupt.pending, 1, 0) {
+		rt.interrupt.Lock()
+		reason := rt.interrupt.reason
+		rt.interrupt.Unlock()
+		panic(LimitError{Err: InterruptError{Reason: reason}})
+	}
+	if max := rt.limits.MaxSteps; max > 0 && rt.steps > max {
+		panic(LimitError{Err: ErrStepLimit})
+	}
+	if ctx := rt.limits.Context; ctx != nil && ctx.Err() != nil {
+		panic(LimitError{Err: ctx.Err()})
+	}
+	rt.resetCheckpoint()
+}
+
+//下一次需要检查的步数，没有限制时永远不会到达
+func (rt *Runtime) resetCheckpoint() {
+	rt.checkpoint = math.MaxInt64
+	if rt.limits.Context != nil {
+		rt.checkpoint = rt.steps + contextCheckInterval
+	}
+	if max := rt.limits.MaxSteps; max > 0 && max < rt.checkpoint {
+		rt.checkpoint = max + 1
+	}
+}
+
+//记录分配了大约size字节，超过MaxHeap时停止执行
+func (rt *Runtime) Alloc(size int) {
+	if rt.limits.MaxHeap <= 0 {
+		return
+	}
+	rt.heap += int64(size)
+	if rt.heap > rt.limits.MaxHeap {
+		panic(LimitError{Err: ErrHeapLimit})
+	}
+}
+
+//短的拼接结果复制出新的字符串，长的结果只创建一个rope节点
+func (rt *Runtime) allocString(s *JsValue) {
+	if _, isRope := s.Value.(*JsRope); isRope {
+		rt.Alloc(ropeSize)
+	} else {
+		rt.Alloc(len(s.Value.(string)))
+	}
+}
+
+//创建有n个元素的数组
+func (rt *Runtime) AllocArray(n int) {
+	rt.Alloc(arraySize + n*cellSize)
+}
+
+//创建有n个属性的对象，之后定义的属性由AllocProperty计入
+func (rt *Runtime) AllocObject(n int) {
+	rt.Alloc(objectSize + n*cellSize)
+}
+
+func (rt *Runtime) AllocProperty() {
+	rt.Alloc(cellSize)
+}
+
+//其他goroutine通过Interrupt设置pending，执行代码的goroutine在Step中读取
+type interruptState struct {
+	sync.Mutex
+	pending int32
+	reason  string
+}
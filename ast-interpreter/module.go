@@ -0,0 +1,560 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ModuleStatus uint8
+
+const (
+	ModuleLoaded ModuleStatus = iota
+	ModuleLinked
+	ModuleEvaluating
+	ModuleEvaluated
+)
+
+//export default expr导出的值保存在这个变量中，它不是合法的标识符，代码中无法访问
+const defaultExportName = "*default*"
+
+/*
+一个模块文件。加载时解析代码并提前创建顶层声明的变量，链接时把导入的名字绑定到导出模块的变量上，
+两个模块引用的是同一个*JsValue，所以导出方之后修改变量，导入方也能看到新的值(live binding)
+*/
+type Module struct {
+	Path   string
+	Status ModuleStatus
+	Scope  *Scope
+	Log    logger.Logger
+	ast    ast_parser.Stmt
+	//依赖的模块，按照import和export from在代码中出现的顺序执行
+	requests []moduleRequest
+	//本模块导入的变量：变量名 -> 来源，importOrder保证链接时按代码顺序报错
+	imports     map[string]moduleImport
+	importOrder []string
+	//导出名 -> 模块中的变量名
+	localExports map[string]string
+	//export { a as b } from "m" 和 export * as ns from "m"：导出名 -> 来源
+	indirectExports map[string]moduleImport
+	//export * from "m"
+	starExports []string
+	namespace   *JsValue
+	//执行时抛出的异常，再次导入时重新抛出
+	err interface{}
+	//通过import导入的CommonJS模块或JSON文件，只有default导出
+	commonJS bool
+}
+
+type moduleRequest struct {
+	specifier string
+	loc       logger.Loc
+	module    *Module
+}
+
+// 从specifier模块导入name，name为*时导入的是整个模块的命名空间对象
+type moduleImport struct {
+	specifier string
+	name      string
+	loc       logger.Loc
+}
+
+type ModuleLoader struct {
+	runtime *Runtime
+	global  *Scope
+	visitor Visitor
+	//绝对路径 -> 模块，同一个文件只会被加载一次
+	modules map[string]*Module
+	//模块顶层作用域 -> 模块，import()通过作用域链找到发起导入的模块
+	scopes map[*Scope]*Module
+	//CommonJS模块包装函数外层的作用域 -> 文件的绝对路径，CommonJS模块中的import()同样相对于文件所在的目录
+	filenames map[*Scope]string
+	//CommonJS模块的缓存：绝对路径 -> module对象
+	commonJS map[string]*JsValue
+}
+
+func NewModuleLoader(rt *Runtime, global *Scope, visitor Visitor) *ModuleLoader {
+	return &ModuleLoader{
+		runtime:   rt,
+		global:    global,
+		visitor:   visitor,
+		modules:   map[string]*Module{},
+		scopes:    map[*Scope]*Module{},
+		filenames: map[*Scope]string{},
+		commonJS:  map[string]*JsValue{},
+	}
+}
+
+/*
+解析模块路径，只支持相对路径和绝对路径，相对路径相对于导入方所在的目录，
+依次尝试path、path.js和path/index.js
+*/
+func (l *ModuleLoader) Resolve(specifier string, referrer string) (string, bool) {
+	if !strings.HasPrefix(specifier, "./") && !strings.HasPrefix(specifier, "../") && !filepath.IsAbs(specifier) {
+		return "", false
+	}
+	path := specifier
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(referrer), specifier)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for _, candidate := range []string{path, path + ".js", filepath.Join(path, "index.js")} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// import()以及入口模块：加载、链接并执行模块
+func (l *ModuleLoader) Import(specifier string, referrer string) *Module {
+	path, ok := l.Resolve(specifier, referrer)
+	if !ok {
+		panic(RuntimeError{msg: "Error: Cannot find module '" + specifier + "'"})
+	}
+	m := l.Load(path)
+	l.Link(m)
+	l.Evaluate(m)
+	return m
+}
+
+// 加载path对应的模块以及它依赖的所有模块
+func (l *ModuleLoader) Load(path string) *Module {
+	if m, has := l.modules[path]; has {
+		return m
+	}
+	if isCommonJSFile(path) {
+		return l.loadCommonJSAsModule(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(RuntimeError{msg: "Error: Cannot find module '" + path + "'"})
+	}
+	return l.load(path, string(data))
+}
+
+// path为空时是直接执行的一段代码，其中的相对路径相对于当前目录
+func (l *ModuleLoader) load(path string, code string) *Module {
+	p := ast_parser.NewParser(code)
+	p.IsModule = true
+	p.Log.File = path
+	ast, diagnostics := p.Parse()
+	diagnostics = append(diagnostics, analyze(&ast, true, l.runtime.Optimize, &l.runtime.names)...)
+	if len(diagnostics) > 0 {
+		p.Log.PrintDiagnostics(diagnostics)
+		panic(RuntimeError{msg: "SyntaxError: failed to parse module '" + path + "'"})
+	}
+
+	m := &Module{
+		Path:            path,
+		Status:          ModuleLoaded,
+		Scope:           NewScope(l.global),
+		Log:             p.Log,
+		ast:             ast,
+		imports:         map[string]moduleImport{},
+		localExports:    map[string]string{},
+		indirectExports: map[string]moduleImport{},
+	}
+	if path != "" {
+		l.modules[path] = m
+	}
+	l.scopes[m.Scope] = m
+	m.collectEntries(l)
+	m.hoist()
+
+	for i := range m.requests {
+		request := &m.requests[i]
+		resolved, ok := l.Resolve(request.specifier, path)
+		if !ok {
+			l.runtime.Log = m.Log
+			panic(RuntimeError{request.loc, "Error: Cannot find module '" + request.specifier + "'"})
+		}
+		request.module = l.Load(resolved)
+	}
+	return m
+}
+
+// 收集模块中的import和export声明
+func (m *Module) collectEntries(l *ModuleLoader) {
+	request := func(specifier string, loc logger.Loc) {
+		m.requests = append(m.requests, moduleRequest{specifier: specifier, loc: loc})
+	}
+	export := func(name string, loc logger.Loc) {
+		_, isLocal := m.localExports[name]
+		_, isIndirect := m.indirectExports[name]
+		if isLocal || isIndirect {
+			l.runtime.Log = m.Log
+			panic(RuntimeError{loc, "SyntaxError: Duplicate export of '" + name + "'"})
+		}
+	}
+
+	for _, stmt := range m.ast.Data.(*ast_parser.SProgram).Body {
+		loc := stmt.Loc
+		switch s := stmt.Data.(type) {
+		case *ast_parser.SImport:
+			request(s.Source, loc)
+			bind := func(local string, name string) {
+				m.imports[local] = moduleImport{specifier: s.Source, name: name, loc: loc}
+				m.importOrder = append(m.importOrder, local)
+			}
+			if s.Default != nil {
+				bind(s.Default.Value, "default")
+			}
+			if s.Namespace != nil {
+				bind(s.Namespace.Value, "*")
+			}
+			for _, specifier := range s.Specifiers {
+				bind(specifier.Local.Value, specifier.Imported)
+			}
+		case *ast_parser.SExportDecl:
+			if name := declaredName(s.Decl); name != "" {
+				export(name, loc)
+				m.localExports[name] = name
+			}
+		case *ast_parser.SExportDefault:
+			export("default", loc)
+			m.localExports["default"] = defaultExportName
+			if fn, ok := s.Expr.Data.(*ast_parser.EFunctionExpr); ok && fn.Id != nil {
+				m.localExports["default"] = fn.Id.Value
+			}
+		case *ast_parser.SExportNamed:
+			if s.Source != nil {
+				request(*s.Source, loc)
+			}
+			for _, specifier := range s.Specifiers {
+				export(specifier.Exported, loc)
+				if s.Source != nil {
+					m.indirectExports[specifier.Exported] = moduleImport{specifier: *s.Source, name: specifier.Local, loc: loc}
+				} else {
+					m.localExports[specifier.Exported] = specifier.Local
+				}
+			}
+		case *ast_parser.SExportAll:
+			request(s.Source, loc)
+			if s.Exported != nil {
+				export(*s.Exported, loc)
+				m.indirectExports[*s.Exported] = moduleImport{specifier: s.Source, name: "*", loc: loc}
+			} else {
+				m.starExports = append(m.starExports, s.Source)
+			}
+		}
+	}
+}
+
+// let/const/var、函数声明和class声明的名字
+func declaredName(decl *ast_parser.Stmt) string {
+	switch s := decl.Data.(type) {
+	case *ast_parser.SVarDecl:
+		return s.Id.Value
+	case *ast_parser.SClass:
+		return s.Id.Value
+	case *ast_parser.SExpr:
+		if fn, ok := s.Expr.Data.(*ast_parser.EFunctionExpr); ok && fn.Id != nil {
+			return fn.Id.Value
+		}
+	}
+	return ""
+}
+
+/*
+提前创建模块顶层声明的变量，函数声明在模块执行之前就已经可以调用，
+所以循环依赖中先执行的模块也能调用后执行的模块导出的函数
+*/
+func (m *Module) hoist() {
+	for _, stmt := range m.ast.Data.(*ast_parser.SProgram).Body {
+		decl := stmt
+		switch s := stmt.Data.(type) {
+		case *ast_parser.SExportDecl:
+			decl = s.Decl
+		case *ast_parser.SExportDefault:
+			cell := m.Scope.Hoist(m.localExports["default"])
+			if fn, ok := s.Expr.Data.(*ast_parser.EFunctionExpr); ok {
+				*cell = *m.newFunction(fn)
+			}
+			continue
+		}
+		name := declaredName(decl)
+		if name == "" {
+			continue
+		}
+		cell := m.Scope.Hoist(name)
+		switch s := decl.Data.(type) {
+		case *ast_parser.SExpr:
+			*cell = *m.newFunction(s.Expr.Data.(*ast_parser.EFunctionExpr))
+		case *ast_parser.SVarDecl:
+			if s.Kind() != ast_parser.VVar {
+				m.Scope.DeclareUninitialized(name, s.Kind() == ast_parser.VConst)
+			}
+		}
+	}
+}
+
+func (m *Module) newFunction(fn *ast_parser.EFunctionExpr) *JsValue {
+	return &JsValue{Value: &JsFunction{
+		Closure:   m.Scope,
+		Params:    fn.Params,
+		Body:      fn.Body,
+		Generator: fn.Generator,
+		Async:     fn.Async,
+	}, Type: Function}
+}
+
+func (m *Module) requested(specifier string) *Module {
+	for _, request := range m.requests {
+		if request.specifier == specifier {
+			return request.module
+		}
+	}
+	return nil
+}
+
+type resolveSet map[*Module]map[string]bool
+
+/*
+找到导出名对应的变量，没有这个导出时返回nil
+export *中同一个名字来自不同的变量时有歧义，也返回nil，resolveSet用来避免循环依赖中无限递归
+*/
+func (m *Module) ResolveExport(name string, visited resolveSet) *JsValue {
+	if visited[m] == nil {
+		visited[m] = map[string]bool{}
+	}
+	if visited[m][name] {
+		return nil
+	}
+	visited[m][name] = true
+
+	if local, has := m.localExports[name]; has {
+		if imported, isImport := m.imports[local]; isImport {
+			return m.resolveImport(imported, visited)
+		}
+		return m.Scope.Env[local]
+	}
+	if imported, has := m.indirectExports[name]; has {
+		return m.resolveImport(imported, visited)
+	}
+	if name == "default" {
+		return nil
+	}
+
+	var resolution *JsValue
+	for _, specifier := range m.starExports {
+		cell := m.requested(specifier).ResolveExport(name, visited)
+		if cell == nil {
+			continue
+		}
+		if resolution != nil && resolution != cell {
+			return nil
+		}
+		resolution = cell
+	}
+	return resolution
+}
+
+func (m *Module) resolveImport(imported moduleImport, visited resolveSet) *JsValue {
+	target := m.requested(imported.specifier)
+	if imported.name == "*" {
+		return target.Namespace()
+	}
+	return target.ResolveExport(imported.name, visited)
+}
+
+// 模块导出的所有名字，export *不会导出default
+func (m *Module) exportedNames(visited map[*Module]bool) []string {
+	if visited[m] {
+		return nil
+	}
+	visited[m] = true
+
+	names := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for name := range m.localExports {
+		add(name)
+	}
+	for name := range m.indirectExports {
+		add(name)
+	}
+	for _, specifier := range m.starExports {
+		for _, name := range m.requested(specifier).exportedNames(visited) {
+			if name != "default" {
+				add(name)
+			}
+		}
+	}
+	return names
+}
+
+/*
+import * as ns得到的命名空间对象，属性直接引用导出的变量，没有原型
+*/
+func (m *Module) Namespace() *JsValue {
+	if m.namespace != nil {
+		return m.namespace
+	}
+	namespace := &JsObject{}
+	m.namespace = &JsValue{Value: namespace, Type: Object}
+
+	names := m.exportedNames(map[*Module]bool{})
+	sort.Strings(names)
+	for _, name := range names {
+		if cell := m.ResolveExport(name, resolveSet{}); cell != nil {
+			namespace.Set(name, cell)
+		}
+	}
+	return m.namespace
+}
+
+// 把模块以及它依赖的模块中导入的名字绑定到导出模块的变量上
+func (l *ModuleLoader) Link(m *Module) {
+	if m.Status != ModuleLoaded {
+		return
+	}
+	m.Status = ModuleLinked
+	for _, request := range m.requests {
+		l.Link(request.module)
+	}
+
+	for _, local := range m.importOrder {
+		imported := m.imports[local]
+		cell := m.resolveImport(imported, resolveSet{})
+		if cell == nil {
+			l.runtime.Log = m.Log
+			panic(RuntimeError{imported.loc, "SyntaxError: The requested module '" + imported.specifier +
+				"' does not provide an export named '" + imported.name + "'"})
+		}
+		m.Scope.Set(local, cell)
+		//导入的名字和const一样不能赋值
+		m.Scope.SetConst(local, true)
+	}
+
+	for _, local := range m.localExports {
+		_, isImport := m.imports[local]
+		if _, declared := m.Scope.Env[local]; !declared && !isImport {
+			l.runtime.Log = m.Log
+			panic(RuntimeError{msg: "SyntaxError: Export '" + local + "' is not defined in module"})
+		}
+	}
+}
+
+/*
+深度优先执行模块，依赖先于导入方执行，循环依赖中正在执行的模块不会被重复执行
+模块中有顶层await时，一直执行微任务直到这个模块执行完成，再执行导入它的模块
+*/
+func (l *ModuleLoader) Evaluate(m *Module) {
+	switch m.Status {
+	case ModuleEvaluating:
+		return
+	case ModuleEvaluated:
+		if m.err != nil {
+			panic(m.err)
+		}
+		return
+	}
+	m.Status = ModuleEvaluating
+	defer func() {
+		if err := recover(); err != nil {
+			m.Status = ModuleEvaluated
+			m.err = err
+			panic(err)
+		}
+	}()
+
+	for _, request := range m.requests {
+		l.Evaluate(request.module)
+	}
+
+	if m.commonJS {
+		*m.Scope.Env[defaultExportName] = *l.Require(m.Path)
+		m.Status = ModuleEvaluated
+		return
+	}
+
+	rt := l.runtime
+	log := rt.Log
+	rt.Log = m.Log
+	stat := &InterpreterStat{
+		Program: &m.ast,
+		Scope:   m.Scope,
+		Runtime: rt,
+		Visitor: l.visitor,
+	}
+	promise := EvaluateModuleBody(&m.ast, stat).Value.(*JsPromise)
+	rt.drainMicrotasks(func() bool {
+		return promise.State != PromisePending
+	})
+	if promise.State == PromiseRejected {
+		promise.handled = true
+		panic(JsException{promise.Loc, promise.Value})
+	}
+	rt.Log = log
+	m.Status = ModuleEvaluated
+}
+
+// 找到作用域所在的模块，返回模块的路径，不在模块中时返回空字符串
+func (l *ModuleLoader) referrer(scope *Scope) string {
+	for s := scope; s != nil; s = s.Parent {
+		if m, has := l.scopes[s]; has {
+			return m.Path
+		}
+		if filename, has := l.filenames[s]; has {
+			return filename
+		}
+	}
+	return ""
+}
+
+/*
+import(source)：返回的promise以模块的命名空间对象完成，找不到模块或者模块执行出错时被reject
+模块在之后的微任务中加载并执行，import()之后的同步代码先执行
+*/
+func (v *IVisitor) VisitImportCall(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	importCall := e.Data.(*ast_parser.EImportCall)
+	source := EvaluateExpr(&importCall.Source, stat)
+	specifier := ToString(&source).Value.(string)
+	rt := stat.Runtime
+	referrer := rt.Loader.referrer(stat.Scope)
+	promise := rt.NewPromise()
+	p := promise.Value.(*JsPromise)
+
+	rt.EnqueueMicrotask(func() {
+		log := rt.Log
+		var m *Module
+		reason, _, thrown := rt.try(func() {
+			m = rt.Loader.Import(specifier, referrer)
+		})
+		rt.Log = log
+		if thrown {
+			rt.RejectPromise(p, reason, e.Loc)
+		} else {
+			rt.fulfill(p, *m.Namespace())
+		}
+	})
+	return *promise
+}
+
+// export声明在加载模块时已经处理过，执行时只需要执行其中的声明，或者计算default的值
+func (v *IVisitor) VisitExportStmt(s *ast_parser.Stmt, stat *InterpreterStat) Completion {
+	switch export := s.Data.(type) {
+	case *ast_parser.SExportDecl:
+		return EvaluateStmt(export.Decl, stat)
+	case *ast_parser.SExportDefault:
+		value := EvaluateExpr(&export.Expr, stat)
+		if fn, ok := export.Expr.Data.(*ast_parser.EFunctionExpr); ok && fn.Id != nil {
+			//有名字的函数已经声明在自己的名字上
+			return Completion{}
+		}
+		stat.Scope.Declare(defaultExportName, &value)
+	}
+	return Completion{}
+}
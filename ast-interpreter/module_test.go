@@ -0,0 +1,51 @@
+package ast_interpreter
+
+import (
+	"strings"
+	t "testing"
+)
+
+/*
+testdata/modules中的模块图：cycle_a和cycle_b互相导入，b执行时a中提升的函数已经可以调用，let仍处于TDZ；
+counter导出的变量被修改后导入方看到新的值；reexport包含export *和export { x as default }；
+tla使用顶层await，导入它的main等它执行完再执行；main还用import()动态导入dynamic，
+dynamic在import()之后的同步代码执行完才执行
+*/
+func TestModuleGraph(t *t.T) {
+	output := captureOutput(func() {
+		if err := RunFile("testdata/modules/main.mjs", false); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expected := []string{
+		"b: hoisted",
+		"b: ReferenceError: Cannot access 'late' before initialization",
+		"tla: waiting",
+		"tla: resumed",
+		"main: hoisted, from b",
+		"count 0",
+		"count 2 2",
+		"default x",
+		"tla done",
+		"main: after import()",
+		"dynamic: evaluated",
+		"dynamic loaded dynamic default",
+		"same namespace true",
+	}
+	if got := strings.TrimSuffix(output, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestMissingExport(t *t.T) {
+	output := captureOutput(func() {
+		RunFile("testdata/modules/missing_export.mjs", false)
+	})
+	if !strings.Contains(output, "2| import { nope } from \"./counter.mjs\"") ||
+		!strings.Contains(output, "SyntaxError: The requested module './counter.mjs' does not provide an export named 'nope'") {
+		t.Errorf("unexpected output\n%s", output)
+	}
+	if strings.Contains(output, "not reached") {
+		t.Error("a module with a missing import should not run")
+	}
+}
@@ -0,0 +1,310 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/analyzer"
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/lexer"
+	"math"
+	"strconv"
+)
+
+/*
+执行之前对语法树的优化(-O)：计算常量表达式、去掉不会执行的if分支和return等之后的语句、
+把值是字面量的const直接替换成字面量。化简后的表达式保留原来的位置，出错时仍然指向原来的代码
+常量表达式用解释器自己的运算计算，结果和执行时完全一样，运算会抛出异常的表达式不化简，留到执行时报错
+*/
+func optimize(program *ast_parser.Stmt, result *analyzer.Result) {
+	ast_parser.Walk(folder{}, program)
+	//const的初始值化简成字面量之后，引用它的const也可能变成字面量
+	for inlineConstants(program, result) {
+		ast_parser.Walk(folder{}, program)
+	}
+}
+
+/*
+Walk在访问完一个节点的所有子节点之后调用Visit(nil)，folder记住自己对应的节点，
+这时子节点都已经化简过了
+*/
+type folder struct {
+	node ast_parser.Node
+}
+
+func (f folder) Visit(node ast_parser.Node) ast_parser.NodeVisitor {
+	if node != nil {
+		return folder{node}
+	}
+	switch n := f.node.(type) {
+	case *ast_parser.Expr:
+		foldExpr(n)
+	case *ast_parser.Stmt:
+		switch s := n.Data.(type) {
+		case *ast_parser.SProgram:
+			s.Body = removeUnreachable(s.Body)
+		case *ast_parser.SBlock:
+			s.Data = removeUnreachable(s.Data)
+		case *ast_parser.SCondition:
+			foldCondition(n, s)
+		}
+	case *ast_parser.SBody:
+		n.Data.Data = removeUnreachable(n.Data.Data)
+	}
+	return nil
+}
+
+func foldExpr(e *ast_parser.Expr) {
+	switch x := e.Data.(type) {
+	case *ast_parser.EParen:
+		if _, isLiteral := literalValue(&x.Data); isLiteral {
+			*e = x.Data
+		}
+	case *ast_parser.EConditional:
+		if test, isLiteral := literalValue(&x.Test); isLiteral {
+			if IsTruthy(test) {
+				*e = x.Consequent
+			} else {
+				*e = x.Alternate
+			}
+		}
+	case *ast_parser.EUnary:
+		switch x.Op {
+		case ast_parser.EOp(lexer.TDelete), ast_parser.EOp(lexer.TPlusPlus), ast_parser.EOp(lexer.TMinusMinus):
+			return
+		}
+		if value, isLiteral := literalValue(&x.Value); isLiteral {
+			foldValue(e, func() JsValue { return UnaryOperation(x.Op, value, e.Loc) })
+		}
+	case *ast_parser.EBinary:
+		left, isLiteral := literalValue(&x.Left)
+		if !isLiteral {
+			return
+		}
+		//逻辑运算只需要左边是字面量，结果是左边或者右边的表达式
+		switch x.Op {
+		case ast_parser.EOp(lexer.TAmpersandAmpersand):
+			if IsTruthy(left) {
+				*e = x.Right
+			} else {
+				*e = x.Left
+			}
+			return
+		case ast_parser.EOp(lexer.TBarBar):
+			if IsTruthy(left) {
+				*e = x.Left
+			} else {
+				*e = x.Right
+			}
+			return
+		case ast_parser.EOp(lexer.TQuestionQuestion):
+			if left.Type == Null {
+				*e = x.Right
+			} else {
+				*e = x.Left
+			}
+			return
+		case ast_parser.EOp(lexer.TIn), ast_parser.EOp(lexer.TInstanceof):
+			return
+		}
+		if right, isLiteral := literalValue(&x.Right); isLiteral {
+			foldValue(e, func() JsValue { return BinaryOperation(x.Op, left, right, e.Loc, nil) })
+		}
+	}
+}
+
+// 计算出的值能写成字面量时替换e，计算出错时保留原来的表达式
+func foldValue(e *ast_parser.Expr, compute func() JsValue) {
+	defer func() {
+		if err := recover(); err != nil {
+			if _, isRuntimeError := err.(RuntimeError); !isRuntimeError {
+				panic(err)
+			}
+		}
+	}()
+	if literal := toLiteral(compute()); literal != nil {
+		e.Data = literal
+	}
+}
+
+// 字面量表达式的值，undefined不是字面量
+func literalValue(e *ast_parser.Expr) (JsValue, bool) {
+	switch x := e.Data.(type) {
+	case *ast_parser.ENumericLiteral:
+		if num, err := strconv.ParseFloat(x.Value, 64); err == nil {
+			return NumberValue(num), true
+		}
+	case *ast_parser.EStringLiteral:
+		return JsValue{Value: x.Value, Type: String}, true
+	case *ast_parser.EBoolLiteral:
+		return JsValue{Value: x.Value, Type: Boolean}, true
+	case *ast_parser.ENullLiteral:
+		return JsValue{Type: Null}, true
+	}
+	return JsValue{}, false
+}
+
+// -0写成字面量会变成0，不化简
+func toLiteral(v JsValue) ast_parser.E {
+	switch v.Type {
+	case Number:
+		if v.num == 0 && math.Signbit(v.num) {
+			return nil
+		}
+		return &ast_parser.ENumericLiteral{Value: NumberToString(v.num)}
+	case String:
+		return &ast_parser.EStringLiteral{Value: v.Str()}
+	case Boolean:
+		return &ast_parser.EBoolLiteral{Value: v.Value.(bool)}
+	case Null:
+		return &ast_parser.ENullLiteral{}
+	}
+	return nil
+}
+
+/*
+条件是字面量的if：条件为假的分支去掉，条件为真的分支变成else，之后的分支去掉，
+只剩下else时整个if变成这个块。分支中声明了var时保留这个分支，var会被提升，去掉它会改变外层的变量
+*/
+func foldCondition(stmt *ast_parser.Stmt, condition *ast_parser.SCondition) {
+	branches := []ast_parser.Branch{}
+	reached := false
+	for _, branch := range condition.Branches {
+		if reached {
+			if declaresVar(branch.Body) {
+				branches = append(branches, branch)
+			}
+			continue
+		}
+		if branch.Condition == nil {
+			branches = append(branches, branch)
+			reached = true
+			continue
+		}
+		test, isLiteral := literalValue(branch.Condition)
+		switch {
+		case !isLiteral:
+			branches = append(branches, branch)
+		case IsTruthy(test):
+			branches = append(branches, ast_parser.Branch{Body: branch.Body})
+			reached = true
+		case declaresVar(branch.Body):
+			branches = append(branches, branch)
+		}
+	}
+	switch {
+	case len(branches) == 0:
+		stmt.Data = &ast_parser.SBlock{}
+	case len(branches) == 1 && branches[0].Condition == nil:
+		stmt.Data = branches[0].Body.Data
+	default:
+		condition.Branches = branches
+	}
+}
+
+/*
+去掉return、throw、break、continue之后的语句，以及化简后剩下的空块
+声明语句即使不会执行也会在进入作用域时创建变量，所以保留下来
+*/
+func removeUnreachable(stmts []*ast_parser.Stmt) []*ast_parser.Stmt {
+	result := stmts[:0]
+	reachable := true
+	for _, stmt := range stmts {
+		if block, isBlock := stmt.Data.(*ast_parser.SBlock); isBlock && len(block.Data) == 0 {
+			continue
+		}
+		if reachable || isDeclaration(stmt) || declaresVar(stmt) {
+			result = append(result, stmt)
+		}
+		switch stmt.Data.(type) {
+		case *ast_parser.SReturn, *ast_parser.SThrow, *ast_parser.SBreak, *ast_parser.SContinue:
+			reachable = false
+		}
+	}
+	return result
+}
+
+func isDeclaration(stmt *ast_parser.Stmt) bool {
+	switch stmt.Data.(type) {
+	case *ast_parser.SVarDecl, *ast_parser.SFunctionDecl, *ast_parser.SClass,
+		*ast_parser.SImport, *ast_parser.SExportDecl, *ast_parser.SExportDefault,
+		*ast_parser.SExportNamed, *ast_parser.SExportAll:
+		return true
+	}
+	return isFunctionDeclaration(stmt)
+}
+
+// 不在内层函数中的var声明
+func declaresVar(node ast_parser.Node) bool {
+	found := false
+	ast_parser.Inspect(node, func(node ast_parser.Node) bool {
+		switch n := node.(type) {
+		case *ast_parser.Stmt:
+			if decl, isDecl := n.Data.(*ast_parser.SVarDecl); isDecl && decl.Kind() == ast_parser.VVar {
+				found = true
+			}
+		case *ast_parser.Expr:
+			switch n.Data.(type) {
+			case *ast_parser.EFunctionExpr, *ast_parser.EArrowFunction:
+				return false
+			}
+		case *ast_parser.ClassMember:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+/*
+const x = 字面量，之后在同一个函数中读取x的地方直接换成这个字面量
+只替换声明之后的读取：声明之前的读取处于TDZ，内层函数可能在声明执行之前被调用，这两种情况都要在执行时报错
+delete x的结果和delete 字面量不同，也不替换。声明本身保留，给const赋值仍然会报错
+*/
+func inlineConstants(program *ast_parser.Stmt, result *analyzer.Result) bool {
+	values := map[*ast_parser.EIdentifier]*ast_parser.Expr{}
+	deleted := map[*ast_parser.EIdentifier]bool{}
+	ast_parser.Inspect(program, func(node ast_parser.Node) bool {
+		switch n := node.(type) {
+		case *ast_parser.Stmt:
+			decl, isDecl := n.Data.(*ast_parser.SVarDecl)
+			if !isDecl || decl.Kind() != ast_parser.VConst || decl.Init == nil {
+				return true
+			}
+			symbol := result.SymbolOf(&decl.Id)
+			if _, isLiteral := literalValue(decl.Init); !isLiteral || symbol == nil {
+				return true
+			}
+			end := n.Loc.Offset + n.Loc.Len
+			for _, ref := range symbol.References {
+				if ref.Id != nil && !ref.Write && ref.Loc.Offset >= end &&
+					ref.Scope.FunctionScope() == symbol.Scope.FunctionScope() {
+					values[ref.Id] = decl.Init
+				}
+			}
+		case *ast_parser.Expr:
+			if unary, isUnary := n.Data.(*ast_parser.EUnary); isUnary && unary.Op == ast_parser.EOp(lexer.TDelete) {
+				if id, isId := unary.Value.Data.(*ast_parser.EIdentifier); isId {
+					deleted[id] = true
+				}
+			}
+		}
+		return true
+	})
+
+	changed := false
+	ast_parser.Inspect(program, func(node ast_parser.Node) bool {
+		if e, isExpr := node.(*ast_parser.Expr); isExpr {
+			if id, isId := e.Data.(*ast_parser.EIdentifier); isId && !deleted[id] {
+				if value, has := values[id]; has {
+					e.Data = toLiteral(mustLiteral(value))
+					changed = true
+				}
+			}
+		}
+		return true
+	})
+	return changed
+}
+
+func mustLiteral(e *ast_parser.Expr) JsValue {
+	value, _ := literalValue(e)
+	return value
+}
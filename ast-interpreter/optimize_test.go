@@ -0,0 +1,57 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/printer"
+	"strings"
+	t "testing"
+)
+
+func optimizeCode(code string) ast_parser.Stmt {
+	p := ast_parser.NewParser(code)
+	program, _ := p.Parse()
+	analyze(&program, false, true, nil)
+	return program
+}
+
+func TestOptimize(t *t.T) {
+	cases := []struct {
+		code     string
+		expected string
+	}{
+		{"let x = 1 + 2 * 3", "let x = 7;"},
+		{"let x = \"a\" + 1 + (2 + 3)", "let x = \"a15\";"},
+		{"let x = !0 && -(1 / 0)", "let x = -Infinity;"},
+		{"let x = null ?? 1\nlet y = 0 || 2 ? 3 : 4", "let x = 1;\nlet y = 3;"},
+		//-0和会抛出异常的运算保留原样
+		{"let x = -0\nlet y = 1 - {}", "let x = -0;\nlet y = 1 - {};"},
+		{"const a = 2\nconst b = a * a\nlet c = b + 1", "const a = 2;\nconst b = 4;\nlet c = 5;"},
+		//声明之前的读取和内层函数中的读取不替换
+		{"function f() { return a }\nconst a = 1", "function f() {\n  return a;\n}\nconst a = 1;"},
+		{"if (false) { f() } else { g() }", "{\n  g();\n}"},
+		{"if (1) { f() } else if (x) { g() }", "{\n  f();\n}"},
+		{"if (x) { f() } else if (0) { g() }", "if (x) {\n  f();\n}"},
+		{"if (0) { var v = 1 }", "if (0) {\n  var v = 1;\n}"},
+		{"function f() { return 1\n g()\n var v\n function h() {} }", "function f() {\n  return 1;\n  var v;\n  function h() {}\n}"},
+	}
+	for _, c := range cases {
+		program := optimizeCode(c.code)
+		if got := strings.TrimSpace(printer.Print(&program, printer.DefaultOptions)); got != c.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", c.code, c.expected, got)
+		}
+	}
+}
+
+func TestOptimizeLoc(t *t.T) {
+	code := "let x = 1\nlet y = (2 + 3) * x"
+	program := optimizeCode(code)
+	y := program.Data.(*ast_parser.SProgram).Body[1].Data.(*ast_parser.SVarDecl)
+	//2 + 3折叠成的字面量仍然指向原来的表达式
+	left := y.Init.Data.(*ast_parser.EBinary).Left
+	if _, isLiteral := left.Data.(*ast_parser.ENumericLiteral); !isLiteral {
+		t.Fatalf("expected a literal, got %T", left.Data)
+	}
+	if got := code[left.Loc.Offset : left.Loc.Offset+left.Loc.Len]; got != "2 + 3" {
+		t.Errorf("folded expression should keep its location, got %q", got)
+	}
+}
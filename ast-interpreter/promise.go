@@ -0,0 +1,499 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+)
+
+type PromiseState uint8
+
+const (
+	PromisePending PromiseState = iota
+	PromiseFulfilled
+	PromiseRejected
+)
+
+type JsPromise struct {
+	State PromiseState
+	Value JsValue
+	//被reject的位置，没有被处理的rejection会报告这个位置
+	Loc       logger.Loc
+	runtime   *Runtime
+	reactions []promiseReaction
+	//是否注册过处理函数，没有处理函数的rejection在清空微任务队列后会被报告
+	handled bool
+}
+
+type promiseReaction struct {
+	onFulfilled func(JsValue)
+	onRejected  func(JsValue, logger.Loc)
+}
+
+func (rt *Runtime) NewPromise() *JsValue {
+	return &JsValue{Value: &JsPromise{State: PromisePending, runtime: rt}, Type: Promise}
+}
+
+func (rt *Runtime) EnqueueMicrotask(task func()) {
+	rt.Microtasks = append(rt.Microtasks, task)
+}
+
+/*
+每个宏任务结束后调用，依次执行微任务直到队列为空，执行期间加入的微任务也会被执行
+最后报告所有没有被处理的rejection
+*/
+func (rt *Runtime) RunMicrotasks() {
+	rt.drainMicrotasks(func() bool { return false })
+
+	for _, p := range rt.rejections {
+		if p.handled {
+			continue
+		}
+		printError(rt.Log, p.Loc, "Uncaught (in promise) "+ToString(&p.Value).Value.(string))
+	}
+	rt.rejections = nil
+}
+
+//依次执行微任务，直到队列为空或者done返回true
+func (rt *Runtime) drainMicrotasks(done func() bool) {
+	for len(rt.Microtasks) > 0 && !done() {
+		task := rt.Microtasks[0]
+		rt.Microtasks = rt.Microtasks[1:]
+		task()
+	}
+}
+
+/*
+用value解决promise，value是promise或者带then方法的对象时跟随它的状态
+*/
+func (rt *Runtime) ResolvePromise(p *JsPromise, value JsValue) {
+	if p.State != PromisePending {
+		return
+	}
+	switch value.Type {
+	case Promise:
+		if value.Value.(*JsPromise) == p {
+			rt.RejectPromise(p, JsValue{Value: "TypeError: Chaining cycle detected for promise", Type: String}, p.Loc)
+			return
+		}
+		inner := value.Value.(*JsPromise)
+		rt.EnqueueMicrotask(func() {
+			rt.Then(inner, func(v JsValue) {
+				rt.fulfill(p, v)
+			}, func(reason JsValue, loc logger.Loc) {
+				rt.RejectPromise(p, reason, loc)
+			})
+		})
+		return
+	case Object:
+		var then *JsValue
+		if reason, loc, thrown := rt.try(func() {
+			then = rt.Current.GetProperty(&value, "then")
+		}); thrown {
+			rt.RejectPromise(p, reason, loc)
+			return
+		}
+		if then.Type == Function || then.Type == BuiltInFunction {
+			rt.EnqueueMicrotask(func() {
+				resolve, reject := rt.resolvingFunctions(p)
+				if reason, loc, thrown := rt.try(func() {
+					rt.Current.CallFunction(then, value, []JsValue{*resolve, *reject})
+				}); thrown {
+					rt.RejectPromise(p, reason, loc)
+				}
+			})
+			return
+		}
+	}
+	rt.fulfill(p, value)
+}
+
+func (rt *Runtime) fulfill(p *JsPromise, value JsValue) {
+	if p.State != PromisePending {
+		return
+	}
+	p.State = PromiseFulfilled
+	p.Value = value
+	reactions := p.reactions
+	p.reactions = nil
+	for _, reaction := range reactions {
+		rt.enqueueReaction(p, reaction)
+	}
+}
+
+func (rt *Runtime) RejectPromise(p *JsPromise, reason JsValue, loc logger.Loc) {
+	if p.State != PromisePending {
+		return
+	}
+	p.State = PromiseRejected
+	p.Value = reason
+	p.Loc = loc
+	if !p.handled {
+		rt.rejections = append(rt.rejections, p)
+	}
+	reactions := p.reactions
+	p.reactions = nil
+	for _, reaction := range reactions {
+		rt.enqueueReaction(p, reaction)
+	}
+}
+
+func (rt *Runtime) enqueueReaction(p *JsPromise, reaction promiseReaction) {
+	value, loc := p.Value, p.Loc
+	if p.State == PromiseFulfilled {
+		rt.EnqueueMicrotask(func() { reaction.onFulfilled(value) })
+	} else {
+		rt.EnqueueMicrotask(func() { reaction.onRejected(value, loc) })
+	}
+}
+
+/*
+在Go中注册promise的处理函数，promise已经确定状态时处理函数会作为微任务执行
+*/
+func (rt *Runtime) Then(p *JsPromise, onFulfilled func(JsValue), onRejected func(JsValue, logger.Loc)) {
+	p.handled = true
+	reaction := promiseReaction{onFulfilled, onRejected}
+	if p.State == PromisePending {
+		p.reactions = append(p.reactions, reaction)
+	} else {
+		rt.enqueueReaction(p, reaction)
+	}
+}
+
+//Promise.resolve(value)，value本身是promise时直接返回
+func (rt *Runtime) PromiseResolve(value JsValue) *JsPromise {
+	if value.Type == Promise {
+		return value.Value.(*JsPromise)
+	}
+	promise := rt.NewPromise().Value.(*JsPromise)
+	rt.ResolvePromise(promise, value)
+	return promise
+}
+
+/*
+promise.then(onFulfilled, onRejected)，返回一个新的promise
+处理函数不是函数时把结果原样传给新的promise
+*/
+func (rt *Runtime) promiseThen(p *JsPromise, onFulfilled JsValue, onRejected JsValue) *JsValue {
+	derived := rt.NewPromise()
+	d := derived.Value.(*JsPromise)
+	handle := func(handler JsValue, value JsValue) {
+		var result *JsValue
+		if reason, loc, thrown := rt.try(func() {
+			result = rt.Current.CallFunction(&handler, JsValue{Type: Undefined}, []JsValue{value})
+		}); thrown {
+			rt.RejectPromise(d, reason, loc)
+			return
+		}
+		rt.ResolvePromise(d, *result)
+	}
+	rt.Then(p, func(value JsValue) {
+		if isCallable(&onFulfilled) {
+			handle(onFulfilled, value)
+		} else {
+			rt.ResolvePromise(d, value)
+		}
+	}, func(reason JsValue, loc logger.Loc) {
+		if isCallable(&onRejected) {
+			handle(onRejected, reason)
+		} else {
+			rt.RejectPromise(d, reason, loc)
+		}
+	})
+	return derived
+}
+
+/*
+promise.finally(onFinally)，onFinally返回的promise完成后再传递原来的结果
+*/
+func (rt *Runtime) promiseFinally(p *JsPromise, onFinally JsValue) *JsValue {
+	if !isCallable(&onFinally) {
+		return rt.promiseThen(p, onFinally, onFinally)
+	}
+	derived := rt.NewPromise()
+	d := derived.Value.(*JsPromise)
+	after := func(settle func()) {
+		var result *JsValue
+		if reason, loc, thrown := rt.try(func() {
+			result = rt.Current.CallFunction(&onFinally, JsValue{Type: Undefined}, nil)
+		}); thrown {
+			rt.RejectPromise(d, reason, loc)
+			return
+		}
+		rt.Then(rt.PromiseResolve(*result), func(JsValue) {
+			settle()
+		}, func(reason JsValue, loc logger.Loc) {
+			rt.RejectPromise(d, reason, loc)
+		})
+	}
+	rt.Then(p, func(value JsValue) {
+		after(func() { rt.fulfill(d, value) })
+	}, func(reason JsValue, loc logger.Loc) {
+		after(func() { rt.RejectPromise(d, reason, loc) })
+	})
+	return derived
+}
+
+//executor中的resolve和reject，只有第一次调用有效
+func (rt *Runtime) resolvingFunctions(p *JsPromise) (*JsValue, *JsValue) {
+	alreadyResolved := false
+	resolve := NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+		if !alreadyResolved {
+			alreadyResolved = true
+			rt.ResolvePromise(p, argOrUndefined(args, 0))
+		}
+		return JsValue{Type: Undefined}
+	})
+	reject := NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+		if !alreadyResolved {
+			alreadyResolved = true
+			rt.RejectPromise(p, argOrUndefined(args, 0), rt.CallSite)
+		}
+		return JsValue{Type: Undefined}
+	})
+	return resolve, reject
+}
+
+/*
+执行fn，把其中抛出的JS异常转换成值返回，其余的panic继续向上传递
+*/
+func (rt *Runtime) try(fn func()) (value JsValue, loc logger.Loc, thrown bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			var isException bool
+			value, loc, isException = ThrownValue(err)
+			if !isException {
+				panic(err)
+			}
+			thrown = true
+		}
+	}()
+	fn()
+	return
+}
+
+func isCallable(v *JsValue) bool {
+	return v.Type == Function || v.Type == BuiltInFunction
+}
+
+/*
+调用async函数：函数体和generator一样在单独的goroutine中执行，await相当于yield出等待的值，
+等待的promise完成后再恢复执行，函数体执行完或者抛出异常时确定返回的promise的状态
+*/
+func (rt *Runtime) CallAsync(f *JsFunction, this JsValue, args []JsValue, stat *InterpreterStat) *JsValue {
+	return rt.runAsync(NewGenerator(f, this, args, stat).Value.(*JsGenerator))
+}
+
+//驱动一个还没有开始执行的generator，每次yield出的值都被await
+func (rt *Runtime) runAsync(g *JsGenerator) *JsValue {
+	promise := rt.NewPromise()
+	p := promise.Value.(*JsPromise)
+
+	var step func(signal generatorSignal)
+	step = func(signal generatorSignal) {
+		var result JsValue
+		var done bool
+		if reason, loc, thrown := rt.try(func() {
+			result, done = g.resumeRaw(signal)
+		}); thrown {
+			rt.RejectPromise(p, reason, loc)
+			return
+		}
+		if done {
+			rt.ResolvePromise(p, result)
+			return
+		}
+		rt.Then(rt.PromiseResolve(result), func(value JsValue) {
+			step(generatorSignal{kind: signalNext, value: value})
+		}, func(reason JsValue, loc logger.Loc) {
+			step(generatorSignal{kind: signalThrow, value: reason, loc: loc})
+		})
+	}
+	step(generatorSignal{kind: signalNext, value: JsValue{Type: Undefined}})
+	return promise
+}
+
+//then等方法会间接访问PromisePrototype自身，所以在init中赋值，避免包级变量的初始化循环
+var PromisePrototype = JsValue{Value: map[string]*JsValue{}, Type: BuiltInObject}
+
+func init() {
+	methods := PromisePrototype.Value.(map[string]*JsValue)
+	methods["then"] = NewBuiltIn(func(this JsValue, args ...JsValue) JsValue {
+		p := thisPromise(this, "then")
+		return *p.runtime.promiseThen(p, argOrUndefined(args, 0), argOrUndefined(args, 1))
+	})
+	methods["catch"] = NewBuiltIn(func(this JsValue, args ...JsValue) JsValue {
+		p := thisPromise(this, "catch")
+		return *p.runtime.promiseThen(p, JsValue{Type: Undefined}, argOrUndefined(args, 0))
+	})
+	methods["finally"] = NewBuiltIn(func(this JsValue, args ...JsValue) JsValue {
+		p := thisPromise(this, "finally")
+		return *p.runtime.promiseFinally(p, argOrUndefined(args, 0))
+	})
+}
+
+func thisPromise(this JsValue, method string) *JsPromise {
+	if this.Type != Promise {
+		panic(RuntimeError{msg: "TypeError: Method Promise.prototype." + method + " called on incompatible receiver " + ToString(&this).Value.(string)})
+	}
+	return this.Value.(*JsPromise)
+}
+
+/*
+全局的Promise构造函数以及静态方法
+*/
+func NewPromiseClass(rt *Runtime) *JsValue {
+	construct := func(args ...JsValue) JsValue {
+		executor := argOrUndefined(args, 0)
+		if !isCallable(&executor) {
+			panic(RuntimeError{msg: "TypeError: Promise resolver " + ToString(&executor).Value.(string) + " is not a function"})
+		}
+		promise := rt.NewPromise()
+		p := promise.Value.(*JsPromise)
+		resolve, reject := rt.resolvingFunctions(p)
+		if reason, loc, thrown := rt.try(func() {
+			rt.Current.CallFunction(&executor, JsValue{Type: Undefined}, []JsValue{*resolve, *reject})
+		}); thrown {
+			rt.RejectPromise(p, reason, loc)
+		}
+		return *promise
+	}
+
+	statics := map[string]*JsValue{
+		"resolve": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			return JsValue{Value: rt.PromiseResolve(argOrUndefined(args, 0)), Type: Promise}
+		}),
+		"reject": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			promise := rt.NewPromise()
+			rt.RejectPromise(promise.Value.(*JsPromise), argOrUndefined(args, 0), rt.CallSite)
+			return *promise
+		}),
+		"all": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			return *rt.combinePromises(argOrUndefined(args, 0), combineAll)
+		}),
+		"allSettled": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			return *rt.combinePromises(argOrUndefined(args, 0), combineAllSettled)
+		}),
+		"race": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			return *rt.combinePromises(argOrUndefined(args, 0), combineRace)
+		}),
+		"any": NewBuiltIn(func(_ JsValue, args ...JsValue) JsValue {
+			return *rt.combinePromises(argOrUndefined(args, 0), combineAny)
+		}),
+	}
+
+	return &JsValue{Value: &JsBuiltInClass{
+		Name:      "Promise",
+		Construct: construct,
+		Statics:   statics,
+	}, Type: BuiltInClass}
+}
+
+type combinator uint8
+
+const (
+	combineAll combinator = iota
+	combineAllSettled
+	combineRace
+	combineAny
+)
+
+/*
+Promise.all/allSettled/race/any，iterable中的每一项都先经过Promise.resolve
+*/
+func (rt *Runtime) combinePromises(iterable JsValue, kind combinator) *JsValue {
+	promise := rt.NewPromise()
+	p := promise.Value.(*JsPromise)
+
+	var items []JsValue
+	if reason, loc, thrown := rt.try(func() {
+		items = rt.Current.iterate(&iterable)
+	}); thrown {
+		rt.RejectPromise(p, reason, loc)
+		return promise
+	}
+
+	results := make([]*JsValue, len(items))
+	remaining := len(items)
+	finish := func() {
+		arr := &JsValue{Value: &JsArray{Arr: results, Length: uint(len(results))}, Type: Array}
+		if kind == combineAny {
+			rt.RejectPromise(p, *NewAggregateError(arr), logger.Loc{})
+		} else {
+			rt.fulfill(p, *arr)
+		}
+	}
+	if remaining == 0 && kind != combineRace {
+		finish()
+		return promise
+	}
+
+	for i, item := range items {
+		i := i
+		rt.Then(rt.PromiseResolve(item), func(value JsValue) {
+			switch kind {
+			case combineAll, combineAllSettled:
+				if kind == combineAllSettled {
+					value = *settledResult("fulfilled", "value", value)
+				}
+				results[i] = &value
+				remaining--
+				if remaining == 0 {
+					finish()
+				}
+			default:
+				rt.fulfill(p, value)
+			}
+		}, func(reason JsValue, loc logger.Loc) {
+			switch kind {
+			case combineAllSettled, combineAny:
+				if kind == combineAllSettled {
+					reason = *settledResult("rejected", "reason", reason)
+				}
+				results[i] = &reason
+				remaining--
+				if remaining == 0 {
+					finish()
+				}
+			default:
+				rt.RejectPromise(p, reason, loc)
+			}
+		})
+	}
+	return promise
+}
+
+//Promise.allSettled中每一项的结果 { status, value } 或 { status, reason }
+func settledResult(status string, key string, value JsValue) *JsValue {
+	return &JsValue{Value: NewObject(&ObjectPrototype, map[string]*JsValue{
+		"status": {Value: status, Type: String},
+		key:      &value,
+	}), Type: Object}
+}
+
+//Promise.any全部失败时的错误
+func NewAggregateError(errors *JsValue) *JsValue {
+	return &JsValue{Value: NewObject(&ObjectPrototype, map[string]*JsValue{
+		"name":    {Value: "AggregateError", Type: String},
+		"message": {Value: "All promises were rejected", Type: String},
+		"errors":  errors,
+	}), Type: Object}
+}
+
+//把可迭代的值展开成数组
+func (s *InterpreterStat) iterate(iterable *JsValue) []JsValue {
+	iterator := s.GetIterator(iterable)
+	items := []JsValue{}
+	for {
+		result, done := s.iteratorStep(iterator, "next", JsValue{Type: Undefined})
+		if done {
+			return items
+		}
+		items = append(items, *s.GetProperty(result, "value"))
+	}
+}
+
+func (v *IVisitor) VisitAwaitExpr(e *ast_parser.Expr, stat *InterpreterStat) JsValue {
+	defer fillLoc(e.Loc)
+	value := EvaluateExpr(&e.Data.(*ast_parser.EAwait).Value, stat)
+	return stat.Generator.Yield(value)
+}
@@ -0,0 +1,140 @@
+package ast_interpreter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	t "testing"
+)
+
+//用CodeRunner执行一段代码(包括微任务)，返回打印到标准输出的内容
+func runOutput(code string) string {
+	return captureOutput(func() {
+		runner := NewCodeRunner(nil)
+		runner.Run(code)
+	})
+}
+
+//执行fn，返回其中打印到标准输出的内容
+func captureOutput(fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		output <- b.String()
+	}()
+	fn()
+	os.Stdout = stdout
+	w.Close()
+	return <-output
+}
+
+func expectLines(t *t.T, code string, expected ...string) {
+	t.Helper()
+	if got := runOutput(code); got != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+//then/catch/finally的回调都在同步代码执行完之后按注册的顺序执行
+func TestPromiseOrdering(t *t.T) {
+	expectLines(t, `
+console.log("sync 1")
+Promise.resolve(1).then((v) => console.log("then " + v))
+Promise.reject("e").catch((e) => console.log("catch " + e))
+Promise.resolve(2).finally(() => console.log("finally")).then((v) => console.log("after finally " + v))
+new Promise((resolve) => {
+	console.log("executor")
+	resolve()
+})
+const order = async () => {
+	console.log("async start")
+	await null
+	console.log("async resumed")
+}
+order()
+console.log("sync 2")
+`, "sync 1", "executor", "async start", "sync 2", "then 1", "catch e", "finally", "async resumed", "after finally 2")
+}
+
+//各个组合的结果需要的微任务数不同，只比较结果，不比较它们之间的顺序
+func TestPromiseCombinators(t *t.T) {
+	output := runOutput(`
+Promise.all([1, Promise.resolve(2), new Promise((r) => r(3))]).then((v) => console.log("all " + v[0] + v[1] + v[2]))
+Promise.all([1, Promise.reject("bad"), Promise.reject("worse")]).catch((e) => console.log("all rejected " + e))
+Promise.allSettled([Promise.resolve(1), Promise.reject("no")]).then((rs) => {
+	console.log("allSettled " + rs[0].status + " " + rs[0].value + ", " + rs[1].status + " " + rs[1].reason)
+})
+Promise.race([new Promise(() => {}), Promise.resolve("fast")]).then((v) => console.log("race " + v))
+Promise.any([Promise.reject(1), Promise.resolve("ok")]).then((v) => console.log("any " + v))
+Promise.any([Promise.reject("a"), Promise.reject("b")]).catch((e) => {
+	console.log(e.name + ": " + e.message + " " + e.errors[0] + e.errors[1])
+})
+`)
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	sort.Strings(lines)
+	expected := []string{
+		"AggregateError: All promises were rejected ab", "all 123", "all rejected bad",
+		"allSettled fulfilled 1, rejected no", "any ok", "race fast",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), output)
+	}
+}
+
+func TestAsyncFunctions(t *t.T) {
+	expectLines(t, `
+const double = async (x) => (await x) * 2
+double(Promise.resolve(21)).then((v) => console.log("arrow " + v))
+async function guarded() {
+	try {
+		await Promise.reject("nope")
+		return "unreachable"
+	} catch (e) {
+		return "caught " + e
+	} finally {
+		console.log("finally")
+	}
+}
+guarded().then((v) => console.log(v))
+async function fails() {
+	await null
+	throw "async error"
+}
+fails().catch((e) => console.log("rejected with " + e))
+`, "finally", "arrow 42", "caught nope", "rejected with async error")
+}
+
+//没有被处理的rejection在微任务执行完之后报告，位置是reject发生的地方
+func TestUnhandledRejection(t *t.T) {
+	output := runOutput(`let x = 1
+Promise.reject("lost")
+new Promise((_, reject) => reject("handled")).catch(() => {})
+async function f() { throw "from async" }
+f()
+console.log("end")
+`)
+	lines := strings.Split(output, "\n")
+	if lines[0] != "end" {
+		t.Errorf("rejections should be reported after the script finishes, got\n%s", output)
+	}
+	for _, expected := range []string{
+		"2| Promise.reject(\"lost\")", "Uncaught (in promise) lost",
+		"4| async function f() { throw \"from async\" }", "Uncaught (in promise) from async",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "handled") {
+		t.Errorf("handled rejections should not be reported, got\n%s", output)
+	}
+}
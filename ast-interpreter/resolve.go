@@ -0,0 +1,162 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/analyzer"
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+)
+
+/*
+作用域分析：报告重复声明之类的提前错误，没有错误时把分析的结果写进语法树，
+执行时函数和块级作用域中的变量按位置存放在数组中，标识符直接按(Depth, Index)找到变量，
+不再沿着作用域链逐个查找map。标识符和属性名同时被驻留到names中，names为nil时不驻留
+optimizeAST为true时先优化语法树(见optimize)
+*/
+func analyze(ast *ast_parser.Stmt, module bool, optimizeAST bool, names *InternTable) []logger.Diagnostic {
+	result, diagnostics := analyzer.Analyze(ast, module)
+	if len(diagnostics) == 0 && optimizeAST {
+		optimize(ast, result)
+		//优化删掉了一些声明和引用，重新分析之后再分配位置
+		result, _ = analyzer.Analyze(ast, module)
+	}
+	if len(diagnostics) == 0 {
+		resolveSlots(result, ast, names)
+	}
+	return diagnostics
+}
+
+/*
+程序顶层(全局和模块)的变量仍然按名字存放：REPL中多次执行的代码共享它们，模块的导入导出也按名字链接，
+没有声明的名字同样在运行时按名字查找全局对象
+没有声明变量的块不创建作用域，计算Depth时跳过这些块；函数的作用域存放this，总是会创建
+*/
+func resolveSlots(result *analyzer.Result, program *ast_parser.Stmt, names *InternTable) {
+	r := slotResolver{
+		result:  result,
+		names:   names,
+		slots:   map[*analyzer.Symbol]int{},
+		methods: map[*analyzer.Scope]bool{},
+	}
+	for node, scope := range result.Scopes {
+		if scope.Parent == nil {
+			continue
+		}
+		layout := &ast_parser.ScopeLayout{}
+		for i, symbol := range scope.Declared {
+			r.slots[symbol] = i
+			layout.Names = append(layout.Names, symbol.Name)
+			layout.Kinds = append(layout.Kinds, slotKind(symbol.Kind))
+		}
+		if field := layoutField(node); field != nil {
+			*field = layout
+		}
+	}
+	ast_parser.Walk(r, program)
+}
+
+func slotKind(kind analyzer.SymbolKind) ast_parser.VarKind {
+	switch kind {
+	case analyzer.SymbolLet, analyzer.SymbolClass, analyzer.SymbolImport:
+		return ast_parser.VLet
+	case analyzer.SymbolConst:
+		return ast_parser.VConst
+	default:
+		return ast_parser.VVar
+	}
+}
+
+/*
+作用域的布局记录在执行时创建这个作用域的地方：函数体、catch块和其他语句块记录在SBlock中，
+for头部的作用域记录在SFor中。类还不能执行，它的成员没有记录的位置
+*/
+func layoutField(node ast_parser.Node) **ast_parser.ScopeLayout {
+	switch n := node.(type) {
+	case *ast_parser.Stmt:
+		switch s := n.Data.(type) {
+		case *ast_parser.SBlock:
+			return &s.Layout
+		case *ast_parser.SFor:
+			return &s.Layout
+		case *ast_parser.STry:
+			return &s.Handler.Data.Layout
+		case *ast_parser.SFunctionDecl:
+			return &s.Body.Data.Layout
+		}
+	case *ast_parser.Expr:
+		switch e := n.Data.(type) {
+		case *ast_parser.EFunctionExpr:
+			return &e.Body.Data.Layout
+		case *ast_parser.EArrowFunction:
+			return &e.Body.Data.Layout
+		}
+	case *ast_parser.SBody:
+		return &n.Data.Layout
+	}
+	return nil
+}
+
+type slotResolver struct {
+	result *analyzer.Result
+	slots  map[*analyzer.Symbol]int
+	//对象字面量中方法的作用域，方法名不会绑定到方法内部
+	methods map[*analyzer.Scope]bool
+	scope   *analyzer.Scope
+	names   *InternTable
+}
+
+func (r slotResolver) Visit(node ast_parser.Node) ast_parser.NodeVisitor {
+	if scope, has := r.result.Scopes[node]; has {
+		r.scope = scope
+	}
+	switch n := node.(type) {
+	case *ast_parser.Property:
+		switch n.Kind {
+		case ast_parser.PropertyMethod, ast_parser.PropertyGet, ast_parser.PropertySet:
+			r.methods[r.result.Scopes[&n.Value]] = true
+		}
+		r.internKey(&n.Key)
+	case *ast_parser.Expr:
+		switch e := n.Data.(type) {
+		case *ast_parser.EIdentifier:
+			e.Value = r.names.Intern(e.Value)
+			r.resolve(e)
+		case *ast_parser.EIndex:
+			r.internKey(&e.Idx)
+		}
+	case *ast_parser.EIdentifier:
+		n.Value = r.names.Intern(n.Value)
+		r.resolve(n)
+	}
+	return r
+}
+
+// 用作属性名的字符串字面量：{"key": 1}和obj["key"]
+func (r slotResolver) internKey(key *ast_parser.Expr) {
+	if literal, isLiteral := key.Data.(*ast_parser.EStringLiteral); isLiteral {
+		literal.Value = r.names.Intern(literal.Value)
+	}
+}
+
+func (r slotResolver) resolve(id *ast_parser.EIdentifier) {
+	id.Resolved = false
+	symbol := r.result.SymbolOf(id)
+	//方法名在方法内部不可见，引用的是外层的同名变量
+	for symbol != nil && symbol.Kind == analyzer.SymbolFunctionName && r.methods[symbol.Scope] {
+		symbol = symbol.Scope.Parent.Lookup(symbol.Name)
+	}
+	if symbol == nil || symbol.Scope.Parent == nil {
+		return
+	}
+	//被参数或var覆盖的具名函数表达式的名字已经不在作用域中
+	index, has := r.slots[symbol]
+	if !has {
+		return
+	}
+	depth := 0
+	for scope := r.scope; scope != symbol.Scope; scope = scope.Parent {
+		if scope.Kind == analyzer.ScopeFunction || len(scope.Declared) > 0 {
+			depth++
+		}
+	}
+	id.Resolved, id.Depth, id.Index = true, depth, index
+}
@@ -0,0 +1,244 @@
+package ast_interpreter
+
+import (
+	"strings"
+	"unsafe"
+)
+
+/*
+拼接得到的字符串：拼接时只记录左右两部分，第一次需要完整内容(下标访问、比较、打印等)时才拼接出来，
+之后保存拼接的结果并丢掉两边。s = s + x的循环中每次拼接都是O(1)的，不需要每次复制整个字符串
+类型为String的JsValue的Value是string或者*JsRope，读取内容使用Str()，rope不会是空字符串
+*/
+type JsRope struct {
+	//string或*JsRope，拼接之后为nil
+	left, right interface{}
+	//字节数
+	length int
+	flat   string
+	//拼接之后第一次读取length或者下标时创建
+	index *stringIndex
+}
+
+// 比这短的结果直接拼接，创建rope并不比复制更快
+const minRopeLength = 64
+
+// 字符串的最大字节数，s = s + s只创建rope节点，不检查时几十次之后长度就会溢出
+const maxStringLength = 1<<29 - 24
+
+// 拼接两个字符串，a和b是string或*JsRope
+func concatStrings(a interface{}, b interface{}) JsValue {
+	la, lb := stringPartLength(a), stringPartLength(b)
+	if la+lb > maxStringLength {
+		panic(RuntimeError{msg: "RangeError: Invalid string length"})
+	}
+	switch {
+	case la == 0:
+		return JsValue{Value: b, Type: String}
+	case lb == 0:
+		return JsValue{Value: a, Type: String}
+	case la+lb < minRopeLength:
+		return JsValue{Value: stringPart(a) + stringPart(b), Type: String}
+	}
+	return JsValue{Value: &JsRope{left: a, right: b, length: la + lb}, Type: String}
+}
+
+func stringPartLength(part interface{}) int {
+	if rope, isRope := part.(*JsRope); isRope {
+		return rope.length
+	}
+	return len(part.(string))
+}
+
+func stringPart(part interface{}) string {
+	if rope, isRope := part.(*JsRope); isRope {
+		return rope.String()
+	}
+	return part.(string)
+}
+
+// 拼接出完整的字符串，不递归，左边很深的rope也不会耗尽栈
+func (r *JsRope) String() string {
+	if r.left == nil {
+		return r.flat
+	}
+	var b strings.Builder
+	b.Grow(r.length)
+	stack := []interface{}{r}
+	for len(stack) > 0 {
+		part := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch p := part.(type) {
+		case string:
+			b.WriteString(p)
+		case *JsRope:
+			if p.left == nil {
+				b.WriteString(p.flat)
+			} else {
+				stack = append(stack, p.right, p.left)
+			}
+		}
+	}
+	r.flat, r.left, r.right = b.String(), nil, nil
+	return r.flat
+}
+
+// 字符串的内容，只对String有意义
+func (v *JsValue) Str() string {
+	return stringPart(v.Value)
+}
+
+// 字符串的长度和下标按UTF-16码元计算
+func stringLength(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// 第index个UTF-16码元组成的字符串，代理对中的单独一半用U+FFFD代替
+func stringAt(s string, index int) (string, bool) {
+	for _, r := range s {
+		if r < 0x10000 {
+			if index == 0 {
+				return string(r), true
+			}
+			index--
+			continue
+		}
+		if index <= 1 {
+			return string('\uFFFD'), true
+		}
+		index -= 2
+	}
+	return "", false
+}
+
+/*
+字符串的UTF-16长度，非ASCII的长字符串还记录每隔stringBlockSize个码元所在的位置，
+下标访问时从最近的位置开始找，for循环逐个读取字符时不需要每次从头扫描整个字符串
+*/
+type stringIndex struct {
+	length int
+	ascii  bool
+	blocks []stringBlock
+}
+
+// 第k个block是包含第k*stringBlockSize个码元的字符，它的字节位置和第一个码元的下标
+type stringBlock struct{ offset, unit int }
+
+const stringBlockSize = 64
+
+func newStringIndex(s string) stringIndex {
+	index := stringIndex{ascii: true}
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			index.ascii = false
+			break
+		}
+	}
+	if index.ascii {
+		index.length = len(s)
+		return index
+	}
+	if len(s) <= stringBlockSize {
+		index.length = stringLength(s)
+		return index
+	}
+	for offset, r := range s {
+		width := 1
+		if r >= 0x10000 {
+			width = 2
+		}
+		if next := len(index.blocks) * stringBlockSize; next < index.length+width {
+			index.blocks = append(index.blocks, stringBlock{offset, index.length})
+		}
+		index.length += width
+	}
+	return index
+}
+
+func (index *stringIndex) at(s string, i int) (string, bool) {
+	switch {
+	case i < 0 || i >= index.length:
+		return "", false
+	case index.ascii:
+		return s[i : i+1], true
+	case index.blocks != nil:
+		block := index.blocks[i/stringBlockSize]
+		return stringAt(s[block.offset:], i-block.unit)
+	}
+	return stringAt(s, i)
+}
+
+/*
+最近读取过length或下标的几个长字符串的stringIndex，string本身没有地方保存它，
+按数据指针判断是否是同一个字符串，缓存引用着字符串，指针不会被其他字符串重新使用
+*/
+type stringIndexCache struct {
+	entries [4]struct {
+		s     string
+		index stringIndex
+	}
+	next int
+}
+
+func (c *stringIndexCache) get(s string) stringIndex {
+	for i := range c.entries {
+		if entry := &c.entries[i]; len(entry.s) == len(s) && unsafe.StringData(entry.s) == unsafe.StringData(s) {
+			return entry.index
+		}
+	}
+	index := newStringIndex(s)
+	c.entries[c.next].s, c.entries[c.next].index = s, index
+	c.next = (c.next + 1) % len(c.entries)
+	return index
+}
+
+// 字符串值的内容和它的stringIndex，短字符串直接计算
+func (s *InterpreterStat) stringIndex(v *JsValue) (string, stringIndex) {
+	if rope, isRope := v.Value.(*JsRope); isRope {
+		str := rope.String()
+		if rope.index == nil {
+			index := newStringIndex(str)
+			rope.index = &index
+		}
+		return str, *rope.index
+	}
+	str := v.Value.(string)
+	if len(str) < minRopeLength || s.Runtime == nil {
+		return str, newStringIndex(str)
+	}
+	return str, s.Runtime.stringIndexes.get(str)
+}
+
+/*
+字符串驻留：相同内容的名字共享同一份字符串，作用域分析时把标识符和属性名驻留，
+属性名相同时两个字符串的数据指针相同，比较时不需要逐个字节比较
+字符串字面量只有用作属性名时才驻留，每个Runtime有自己的表，Runtime不再使用时一起释放
+*/
+type InternTable struct {
+	names map[string]string
+}
+
+// t为nil时不驻留，原样返回s
+func (t *InternTable) Intern(s string) string {
+	if t == nil {
+		return s
+	}
+	if v, has := t.names[s]; has {
+		return v
+	}
+	if t.names == nil {
+		t.names = map[string]string{}
+	}
+	//复制一份，s可能是源代码的一部分，不能让驻留表引用整个源代码
+	v := string([]byte(s))
+	t.names[v] = v
+	return v
+}
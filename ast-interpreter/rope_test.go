@@ -0,0 +1,145 @@
+package ast_interpreter
+
+import (
+	"jsInterpreter/ast_parser"
+	"strconv"
+	"strings"
+	t "testing"
+	"unsafe"
+)
+
+func TestRope(t *t.T) {
+	stat, err := evaluateAST(`
+let s = ""
+for (let i = 0; i < 1000; i++) {
+	s = s + "ab"
+}
+let first = s[0] + s[1]
+let last = s[1999]
+let length = s.length
+`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stat.Scope.Get("first").Export(); got != "ab" {
+		t.Errorf("expected ab, got %v", got)
+	}
+	if got := stat.Scope.Get("last").Export(); got != "b" {
+		t.Errorf("expected b, got %v", got)
+	}
+	if got := stat.Scope.Get("length").Export(); got != 2000.0 {
+		t.Errorf("expected 2000, got %v", got)
+	}
+
+	//很深的rope拼接时不会递归
+	value := JsValue{Value: "", Type: String}
+	for i := 0; i < 100000; i++ {
+		value = concatStrings(value.Value, "x")
+	}
+	if _, isRope := value.Value.(*JsRope); !isRope {
+		t.Fatal("long concatenations should build a rope")
+	}
+	if got := value.Str(); got != strings.Repeat("x", 100000) {
+		t.Errorf("flattened rope has length %d", len(got))
+	}
+	other := concatStrings(strings.Repeat("x", 99999), "x")
+	if !StrictEquals(&value, &other) {
+		t.Error("a rope should equal a string with the same content")
+	}
+
+	_, err = evaluate("let s = 'x'\nfor (;;) { s = s + s }")
+	if got := errorMessage(err); got != "RangeError: Invalid string length" {
+		t.Errorf("doubling a string forever: expected RangeError, got %v", err)
+	}
+}
+
+func TestStringIndex(t *t.T) {
+	s := "aé😀b"
+	if n := stringLength(s); n != 5 {
+		t.Errorf("expected UTF-16 length 5, got %d", n)
+	}
+	for i, expected := range []string{"a", "é", "�", "�", "b"} {
+		if got, _ := stringAt(s, i); got != expected {
+			t.Errorf("%d: expected %q, got %q", i, expected, got)
+		}
+	}
+	if _, has := stringAt(s, 5); has {
+		t.Error("index out of range")
+	}
+
+	//跨过多个block、代理对正好落在block边界上的长字符串，结果和从头扫描一样
+	long := strings.Repeat("a", stringBlockSize-1) + strings.Repeat("é😀x", 100)
+	index := newStringIndex(long)
+	if index.ascii || index.blocks == nil || index.length != stringLength(long) {
+		t.Fatalf("unexpected index %+v", index)
+	}
+	for i := -1; i <= index.length; i++ {
+		expected, expectedHas := stringAt(long, i)
+		if i < 0 {
+			expected, expectedHas = "", false
+		}
+		if got, has := index.at(long, i); got != expected || has != expectedHas {
+			t.Errorf("%d: expected %q, got %q", i, expected, got)
+		}
+	}
+	if ascii := newStringIndex(strings.Repeat("ab", 100)); !ascii.ascii || ascii.blocks != nil || ascii.length != 200 {
+		t.Errorf("unexpected ASCII index %+v", ascii)
+	}
+}
+
+func TestIntern(t *t.T) {
+	source := "key + obj.key"
+	names := &InternTable{}
+	a, b := names.Intern(source[:3]), names.Intern(source[10:])
+	if a != "key" || unsafe.StringData(a) != unsafe.StringData(b) {
+		t.Error("interned strings with the same content should share their data")
+	}
+	if unsafe.StringData(a) == unsafe.StringData(source) {
+		t.Error("interned strings should not keep the source alive")
+	}
+
+	//字符串字面量只有用作属性名时才驻留，每个Runtime的表互不影响
+	stat := InitInterpreterStat(nil, &IVisitor{})
+	p := ast_parser.NewParser("let o = { 'quoted': 1 }\nlet v = o['quoted'] + 'just a value' + ident")
+	program, _ := p.Parse()
+	analyze(&program, false, false, &stat.Runtime.names)
+	for _, name := range []string{"o", "v", "ident", "quoted"} {
+		if _, has := stat.Runtime.names.names[name]; !has {
+			t.Errorf("%s should be interned", name)
+		}
+	}
+	if _, has := stat.Runtime.names.names["just a value"]; has {
+		t.Error("string literals that are not property keys should not be interned")
+	}
+	if other := InitInterpreterStat(nil, &IVisitor{}); other.Runtime.names.names != nil {
+		t.Error("each runtime should have its own intern table")
+	}
+}
+
+/*
+逐个读取长的非ASCII字符串的字符：每次下标访问都从头扫描时总时间和长度的平方成正比，
+n从1万变成10万时每个字符的耗时应该基本不变
+*/
+func BenchmarkStringIndex(b *t.B) {
+	for _, n := range []int{10000, 100000} {
+		b.Run(strconv.Itoa(n), func(b *t.B) {
+			stat, _ := evaluateAST("let s = '"+strings.Repeat("é", n)+"'\nlet count = 0", true)
+			p := ast_parser.NewParser("for (let i = 0; i < s.length; i++) { if (s[i] == 'é') { count++ } }")
+			program, _ := p.Parse()
+			loop := program.Data.(*ast_parser.SProgram).Body[0]
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				EvaluateStmt(loop, stat)
+			}
+		})
+	}
+}
+
+func BenchmarkConcat(b *t.B) {
+	stat, _ := evaluate("let s = \"\"\nlet x = \"abcdefgh\"")
+	expr := parseExpr("s = s + x")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EvaluateExpr(expr, stat)
+	}
+}
@@ -0,0 +1,192 @@
+package ast_interpreter
+
+import (
+	"sort"
+	"sync"
+)
+
+/*
+隐藏类：记录对象有哪些属性以及每个属性在slots中的位置
+对象从空的shape开始，每添加一个属性转换到下一个shape，以相同顺序添加相同属性的对象共享同一个shape，
+所以shape相同的对象，同名属性一定在相同的位置，属性读取可以按shape缓存位置
+*/
+type Shape struct {
+	keys []string
+	//属性较多时按名字索引位置，属性少时直接在keys中查找，驻留的属性名比较时只需要比较指针
+	index map[string]int
+	//添加一个属性之后的shape，第一次添加时创建，之后复用
+	transitions map[string]*Shape
+}
+
+// 属性超过这个数量，或者删除过属性的对象变成字典模式，不再使用shape
+const maxShapeProperties = 32
+
+var emptyShape = &Shape{}
+
+// 属性不超过这个数量的shape不建立索引
+const maxLinearShape = 8
+
+// generator和async函数在其他goroutine中执行，修改转换表时需要加锁
+var transitionLock sync.Mutex
+
+func (s *Shape) Lookup(key string) (int, bool) {
+	if s.index == nil {
+		for i, k := range s.keys {
+			if k == key {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	index, has := s.index[key]
+	return index, has
+}
+
+func (s *Shape) withProperty(key string) *Shape {
+	transitionLock.Lock()
+	defer transitionLock.Unlock()
+	if next, has := s.transitions[key]; has {
+		return next
+	}
+	next := &Shape{keys: append(s.keys[:len(s.keys):len(s.keys)], key)}
+	if len(next.keys) > maxLinearShape {
+		next.index = make(map[string]int, len(next.keys))
+		for i, k := range next.keys {
+			next.index[k] = i
+		}
+	}
+	if s.transitions == nil {
+		s.transitions = map[string]*Shape{}
+	}
+	s.transitions[key] = next
+	return next
+}
+
+// 创建对象，properties中的属性按名字排序后添加，内置代码创建的同类对象共享shape
+func NewObject(proto *JsValue, properties map[string]*JsValue) *JsObject {
+	obj := &JsObject{Proto: proto}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		obj.Set(key, properties[key])
+	}
+	return obj
+}
+
+// 自身的属性，返回的是存放属性值的位置
+func (o *JsObject) Get(key string) (*JsValue, bool) {
+	if o.dict != nil {
+		cell, has := o.dict[key]
+		return cell, has
+	}
+	if o.shape == nil {
+		return nil, false
+	}
+	if index, has := o.shape.Lookup(key); has {
+		return o.slots[index], true
+	}
+	return nil, false
+}
+
+// 在对象自身上定义属性，已有的属性直接替换存放的位置，没有时转换到新的shape
+func (o *JsObject) Set(key string, cell *JsValue) {
+	if o.dict != nil {
+		o.dict[key] = cell
+		return
+	}
+	if o.shape == nil {
+		o.shape = emptyShape
+	}
+	if index, has := o.shape.Lookup(key); has {
+		o.slots[index] = cell
+		return
+	}
+	if len(o.slots) >= maxShapeProperties {
+		o.toDictionary()
+		o.dict[key] = cell
+		return
+	}
+	o.shape = o.shape.withProperty(key)
+	o.slots = append(o.slots, cell)
+}
+
+// 定义不能赋值也不能删除的属性
+func (o *JsObject) SetReadOnly(key string, cell *JsValue) {
+	o.Set(key, cell)
+	if o.readOnly == nil {
+		o.readOnly = map[string]bool{}
+	}
+	o.readOnly[key] = true
+}
+
+// 删除属性之后对象变成字典模式，缓存了原来shape的内联缓存不会再命中这个对象
+func (o *JsObject) Delete(key string) {
+	if _, has := o.Get(key); !has {
+		return
+	}
+	if o.dict == nil {
+		o.toDictionary()
+	}
+	delete(o.dict, key)
+}
+
+// 字典模式下shape为nil
+func (o *JsObject) Shape() *Shape {
+	return o.shape
+}
+
+func (o *JsObject) toDictionary() {
+	o.dict = make(map[string]*JsValue, len(o.slots))
+	if o.shape != nil {
+		for i, key := range o.shape.keys {
+			o.dict[key] = o.slots[i]
+		}
+	}
+	o.shape, o.slots = nil, nil
+}
+
+/*
+属性读取的内联缓存，每个obj.key表达式一个
+记录见过的shape和属性在这个shape中的位置，只见过一种shape时是单态的，最多记录maxCacheEntries种(多态)，
+再多时不再缓存(超态)，直接查找属性。对象添加或删除属性之后shape改变，原来的记录不会再命中
+只缓存对象自身的数据属性，原型链上的属性和访问器属性仍然通过GetProperty读取
+*/
+type propertyCache struct {
+	shapes      [maxCacheEntries]*Shape
+	indexes     [maxCacheEntries]int
+	count       int
+	megamorphic bool
+}
+
+const maxCacheEntries = 4
+
+func (c *propertyCache) lookup(o *JsObject) *JsValue {
+	if o.shape == nil {
+		return nil
+	}
+	for i := 0; i < c.count; i++ {
+		if c.shapes[i] == o.shape {
+			return o.slots[c.indexes[i]]
+		}
+	}
+	return nil
+}
+
+func (c *propertyCache) update(o *JsObject, key string) {
+	if c.megamorphic || o.shape == nil {
+		return
+	}
+	index, has := o.shape.Lookup(key)
+	if !has {
+		return
+	}
+	if c.count == maxCacheEntries {
+		c.megamorphic = true
+		return
+	}
+	c.shapes[c.count], c.indexes[c.count] = o.shape, index
+	c.count++
+}
@@ -0,0 +1,88 @@
+package ast_interpreter
+
+import t "testing"
+
+func TestShapeTransitions(t *t.T) {
+	stat, err := evaluate(`
+let a = {x: 1, y: 2}
+let b = {x: 3, y: 4}
+let c = {y: 5, x: 6}
+let d = {x: 7}
+d.y = 8
+let e = {x: 9, y: 10}
+delete e.y
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shape := func(name string) *Shape {
+		return stat.Scope.Get(name).Value.(*JsObject).Shape()
+	}
+	if shape("a") != shape("b") {
+		t.Error("objects with the same properties in the same order should share a shape")
+	}
+	if shape("a") == shape("c") {
+		t.Error("properties added in a different order should give a different shape")
+	}
+	if shape("a") != shape("d") {
+		t.Error("adding a property should follow the same transition as the literal")
+	}
+	if shape("e") != nil {
+		t.Error("deleting a property should switch the object to dictionary mode")
+	}
+	if x, _ := stat.Scope.Get("e").Value.(*JsObject).Get("x"); x.Export() != 9.0 {
+		t.Errorf("dictionary mode lost a property, got %v", x.Export())
+	}
+}
+
+func TestInlineCache(t *t.T) {
+	stat, err := evaluate(`
+function getX(p) { return p.x }
+let o = {x: 1}
+let results = [getX(o)]
+o.y = 2
+results.push(getX(o))
+o.x = 3
+results.push(getX(o))
+delete o.y
+results.push(getX(o))
+results.push(getX({get x() { return 5 }}))
+results.push(getX({__proto__: {x: 6}}))
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := stat.Scope.Get("results").Value.(*JsArray).Arr
+	for i, expected := range []float64{1, 1, 3, 3, 5, 6} {
+		if got := results[i].Export(); got != expected {
+			t.Errorf("read %d: expected %v, got %v", i, expected, got)
+		}
+	}
+
+	var cache propertyCache
+	objects := []*JsObject{}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		objects = append(objects, NewObject(nil, map[string]*JsValue{key: {Type: Null}, "x": {Type: Undefined}}))
+	}
+	for i, obj := range objects {
+		if cache.lookup(obj) != nil {
+			t.Errorf("object %d: unexpected cache hit", i)
+		}
+		cache.update(obj, "x")
+		if hit := cache.lookup(obj) != nil; hit != (i < maxCacheEntries) {
+			t.Errorf("object %d: expected hit %v", i, i < maxCacheEntries)
+		}
+	}
+	if !cache.megamorphic {
+		t.Error("cache should stop recording after too many shapes")
+	}
+}
+
+func BenchmarkMemberExpr(b *t.B) {
+	stat, _ := evaluate("let o = {a: 1, b: 2, c: 3}")
+	expr := parseExpr("o.c")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EvaluateExpr(expr, stat)
+	}
+}
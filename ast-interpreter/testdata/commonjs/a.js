@@ -0,0 +1,4 @@
+exports.early = "early"
+const b = require("./b")
+exports.partialB = b.sawA
+exports.late = "late"
@@ -0,0 +1,4 @@
+const a = require("./a")
+console.log("cycle " + a.partialB + ", " + a.late)
+import("./lib/esm.mjs").then((ns) => console.log("import " + ns.name))
+import("./missing.mjs").catch((e) => console.log(e))
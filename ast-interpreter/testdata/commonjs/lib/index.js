@@ -0,0 +1,2 @@
+console.log("lib loaded")
+module.exports = { name: "lib" }
@@ -0,0 +1,13 @@
+const lib = require("./lib")
+const config = require("./config.json")
+const a = require("./a")
+console.log(lib.name + " " + config.name + " " + config.items[1] + " " + config.nested.ok)
+console.log("same " + (require("./lib") === lib) + " " + (require("./lib/index.js") === lib) + " " + (require("./config") === config))
+console.log("cycle " + a.partialB + ", " + a.late)
+console.log(__filename)
+console.log(__dirname)
+try {
+	require("./missing")
+} catch (e) {
+	console.log(e)
+}
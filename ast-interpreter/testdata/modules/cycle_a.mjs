@@ -0,0 +1,7 @@
+import { fromB } from "./cycle_b.mjs"
+
+export function hoisted() {
+	return "hoisted"
+}
+export let late = "late"
+export const seenByB = fromB
@@ -0,0 +1,11 @@
+import { hoisted, late } from "./cycle_a.mjs"
+
+console.log("b: " + hoisted())
+let state
+try {
+	state = late
+} catch (e) {
+	state = e
+}
+console.log("b: " + state)
+export const fromB = "from b"
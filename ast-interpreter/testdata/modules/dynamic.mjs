@@ -0,0 +1,3 @@
+console.log("dynamic: evaluated")
+export const value = "loaded"
+export default "dynamic default"
@@ -0,0 +1,17 @@
+import { hoisted, seenByB } from "./cycle_a.mjs"
+import { count, increment } from "./counter.mjs"
+import value, { count as reexported, increment as add } from "./reexport.mjs"
+import { waited } from "./tla.mjs"
+
+console.log("main: " + hoisted() + ", " + seenByB)
+console.log("count " + count)
+increment()
+add()
+console.log("count " + count + " " + reexported)
+console.log("default " + value)
+console.log("tla " + waited)
+const pending = import("./dynamic.mjs")
+console.log("main: after import()")
+const dynamic = await pending
+console.log("dynamic " + dynamic.value + " " + dynamic.default)
+import("./dynamic.mjs").then((ns) => console.log("same namespace " + (ns === dynamic)))
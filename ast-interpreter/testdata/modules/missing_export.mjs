@@ -0,0 +1,3 @@
+import { count } from "./counter.mjs"
+import { nope } from "./counter.mjs"
+console.log("not reached")
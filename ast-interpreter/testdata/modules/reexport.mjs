@@ -0,0 +1,3 @@
+export * from "./counter.mjs"
+const x = "x"
+export { x as default }
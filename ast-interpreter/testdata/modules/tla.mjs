@@ -0,0 +1,3 @@
+console.log("tla: waiting")
+export const waited = await Promise.resolve("done")
+console.log("tla: resumed")
@@ -14,11 +14,21 @@ type Expr struct {
 
 type EOp lexer.T
 
+/*
+a = b的Op为0，复合赋值a += b的Op是对应的二元运算符(+)
+逻辑赋值a &&= b、a ||= b、a ??= b短路，不需要时不计算右侧也不赋值
+*/
 type EAssign struct {
+	Op         EOp
 	Target     *Expr
 	Assignment *Expr
 }
 
+//a, b, c依次求值，结果是最后一个表达式的值
+type ESequence struct {
+	Exprs []Expr
+}
+
 type EBinary struct {
 	Op    EOp
 	Left  Expr
@@ -33,6 +43,13 @@ const (
 	AssociationRight
 )
 
+//test ? consequent : alternate
+type EConditional struct {
+	Test       Expr
+	Consequent Expr
+	Alternate  Expr
+}
+
 type EUnary struct {
 	Op    EOp
 	Value Expr
@@ -55,6 +72,8 @@ Property: c
 type EMemberExpr struct {
 	Obj      Expr
 	Property EIdentifier
+	//解释器记录的内联缓存
+	Cache interface{}
 }
 
 type EParen struct {
@@ -71,18 +90,51 @@ type ENumericLiteral struct {
 
 type EIdentifier struct {
 	Value string
+	//作用域分析之后填写：Resolved为true时变量在外面第Depth层作用域的第Index个位置，否则按名字查找
+	Resolved bool
+	Depth    int
+	Index    int
 }
 
+/*
+(a, b) => a + b 或 async x => { }
+函数体是表达式时会被包装成只有一条return语句的Body，Expression记录原来的写法
+*/
 type EArrowFunction struct {
-	Id     EIdentifier
-	Params []EIdentifier
-	Body   SBlock
+	Params     []EIdentifier
+	Body       *SBody
+	Async      bool
+	Expression bool
 }
 
 type EFunctionExpr struct {
-	Id     *EIdentifier
-	Params []EIdentifier
-	Body   *SBody
+	Id        *EIdentifier
+	Params    []EIdentifier
+	Body      *SBody
+	Generator bool
+	Async     bool
+}
+
+//await value，只能出现在async函数中
+type EAwait struct {
+	Value Expr
+}
+
+//import(source)，动态加载模块，返回一个promise
+type EImportCall struct {
+	Source Expr
+}
+
+//new Callee(args)
+type ENew struct {
+	Callee Expr
+	Args   []*Expr
+}
+
+//yield value，Delegate为true时是yield* iterable
+type EYield struct {
+	Argument *Expr
+	Delegate bool
 }
 
 type EBoolLiteral struct {
@@ -99,10 +151,36 @@ type EArrayLiteral struct {
 	Length uint
 }
 
+type ENullLiteral struct{}
+
+type EThis struct{}
+
+type PropertyKind uint8
+
+const (
+	PropertyInit PropertyKind = iota
+	PropertyMethod
+	PropertyGet
+	PropertySet
+	//__proto__: value，设置对象原型而不是定义属性
+	PropertyProto
+)
+
+/*
+{ a: 1, b, [c]: 2, m() {}, get x() {}, set x(v) {}, __proto__: p }
+非计算属性的Key为EStringLiteral或ENumericLiteral，计算属性的Key为任意表达式
+*/
+type Property struct {
+	Kind      PropertyKind
+	Loc       logger.Loc
+	Key       Expr
+	Value     Expr
+	Computed  bool
+	Shorthand bool
+}
+
 type EObjectLiteral struct {
-	Proto       *EIdentifier
-	Constructor *EIdentifier
-	Properties  []*Expr
+	Properties []Property
 }
 
 func (e *EOp) IsExpr()             {}
@@ -110,6 +188,7 @@ func (e *EBinary) IsExpr()         {}
 func (e *EParen) IsExpr()          {}
 func (e *EUnary) IsExpr()          {}
 func (e *EAssign) IsExpr()         {}
+func (e *ESequence) IsExpr()       {}
 func (e *EStringLiteral) IsExpr()  {}
 func (e *ENumericLiteral) IsExpr() {}
 func (e *EIdentifier) IsExpr()     {}
@@ -121,3 +200,10 @@ func (e *ECallExpr) IsExpr()       {}
 func (e *EArrayLiteral) IsExpr()   {}
 func (e *EObjectLiteral) IsExpr()  {}
 func (e *EIndex) IsExpr()          {}
+func (e *EThis) IsExpr()           {}
+func (e *ENullLiteral) IsExpr()    {}
+func (e *EYield) IsExpr()          {}
+func (e *EAwait) IsExpr()          {}
+func (e *ENew) IsExpr()            {}
+func (e *EImportCall) IsExpr()     {}
+func (e *EConditional) IsExpr()    {}
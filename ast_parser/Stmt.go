@@ -23,6 +23,10 @@ type SVarDecl struct {
 	Init *Expr
 }
 
+func (s *SVarDecl) Kind() VarKind {
+	return s.kind
+}
+
 type SExpr struct{ Expr }
 
 type ClassMemberKind uint8
@@ -34,18 +38,41 @@ const (
 
 type SProgram struct {
 	Body []*Stmt
+	//模块或者以"use strict"开头的脚本
+	Strict bool
 }
 
 type SBlock struct {
 	Data []*Stmt
+	//作用域分析之后填写，为nil时块中的变量按名字存放
+	Layout *ScopeLayout
+}
+
+/*
+作用域中按位置存放的变量，顺序和声明的顺序一致
+Kinds决定变量的初始值和能否赋值：VLet、VConst在声明之前处于TDZ，VConst不能赋值，
+var、参数和函数声明都记为VVar，初始值是undefined
+*/
+type ScopeLayout struct {
+	Names []string
+	Kinds []VarKind
 }
 
-type SBreak struct{}
-type SContinue struct{}
+//break和continue后面可以跟一个标签，没有标签时Label为空字符串
+type SBreak struct{ Label string }
+type SContinue struct{ Label string }
+
+//label: body
+type SLabeled struct {
+	Label string
+	Body  *Stmt
+}
 
 type SBody struct {
 	Loc  logger.Loc
 	Data *SBlock
+	//只对函数体有意义：函数是否是严格模式
+	Strict bool
 }
 
 //for loop
@@ -54,6 +81,8 @@ type SFor struct {
 	Condition   *Expr
 	Reset       *Stmt
 	Body        *SBody
+	//for头部的作用域，作用域分析之后填写
+	Layout *ScopeLayout
 }
 
 //while loop
@@ -73,15 +102,83 @@ type Branch struct {
 
 //function
 type SFunctionDecl struct {
-	Id     *EIdentifier
-	Params []EIdentifier
-	Body   *SBody
+	Id        *EIdentifier
+	Params    []EIdentifier
+	Body      *SBody
+	Generator bool
+	Async     bool
 }
 
 type SReturn struct {
 	Expr
+	//严格模式的普通函数中不在try里的return，返回值是函数调用时进行尾调用，不保留当前函数的调用
+	Tail bool
+}
+
+type SThrow struct {
+	Expr
+}
+
+/*
+try { } catch (e) { } finally { }
+catch和finally至少有一个，catch (e)中的参数可以省略
+*/
+type STry struct {
+	Block     *SBody
+	Param     *EIdentifier
+	Handler   *SBody
+	Finalizer *SBody
+}
+
+/*
+import "m"
+import d, { a, b as c } from "m"
+import * as ns from "m"
+*/
+type SImport struct {
+	Source     string
+	Default    *EIdentifier
+	Namespace  *EIdentifier
+	Specifiers []ImportSpecifier
 }
 
+//{ imported as local }，imported可以是default
+type ImportSpecifier struct {
+	Imported string
+	Local    EIdentifier
+}
+
+//export let a = 1 / export function f() { } / export class A { }
+type SExportDecl struct {
+	Decl *Stmt
+}
+
+//export default expr，有名字的函数同时在模块中声明这个名字
+type SExportDefault struct {
+	Expr Expr
+}
+
+//export { a, b as c } 或 export { a } from "m"，没有from时Source为nil
+type SExportNamed struct {
+	Specifiers []ExportSpecifier
+	Source     *string
+}
+
+//{ local as exported }
+type ExportSpecifier struct {
+	Local    string
+	Exported string
+}
+
+//export * from "m" 或 export * as ns from "m"
+type SExportAll struct {
+	Exported *string
+	Source   string
+}
+
+//解析出错的语句，错误信息在Parse返回的Diagnostic中
+type SError struct{}
+
 //class
 type SClass struct {
 	SuperClass *Expr
@@ -101,16 +198,25 @@ type ClassMemberValue interface{ IsClassMemberValue() }
 func (s *SFunctionDecl) IsClassMemberValue() {}
 func (p *SVarDecl) IsClassMemberValue()      {}
 
-func (s *SVarDecl) IsStmt()      {}
-func (s *SExpr) IsStmt()         {}
-func (s *SClass) IsStmt()        {}
-func (s *SFunctionDecl) IsStmt() {}
-func (s *SBlock) IsStmt()        {}
-func (s *SProgram) IsStmt()      {}
-func (s *SFor) IsStmt()          {}
-func (s *SWhile) IsStmt()        {}
-func (s *SBody) IsStmt()         {}
-func (s *SCondition) IsStmt()    {}
-func (s *SReturn) IsStmt()       {}
-func (s *SBreak) IsStmt()        {}
-func (s *SContinue) IsStmt()     {}
+func (s *SVarDecl) IsStmt()       {}
+func (s *SExpr) IsStmt()          {}
+func (s *SClass) IsStmt()         {}
+func (s *SFunctionDecl) IsStmt()  {}
+func (s *SBlock) IsStmt()         {}
+func (s *SProgram) IsStmt()       {}
+func (s *SFor) IsStmt()           {}
+func (s *SWhile) IsStmt()         {}
+func (s *SBody) IsStmt()          {}
+func (s *SCondition) IsStmt()     {}
+func (s *SReturn) IsStmt()        {}
+func (s *SBreak) IsStmt()         {}
+func (s *SContinue) IsStmt()      {}
+func (s *SLabeled) IsStmt()       {}
+func (s *SThrow) IsStmt()         {}
+func (s *STry) IsStmt()           {}
+func (s *SImport) IsStmt()        {}
+func (s *SExportDecl) IsStmt()    {}
+func (s *SExportDefault) IsStmt() {}
+func (s *SExportNamed) IsStmt()   {}
+func (s *SExportAll) IsStmt()     {}
+func (s *SError) IsStmt()         {}
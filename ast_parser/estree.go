@@ -0,0 +1,659 @@
+package ast_parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"jsInterpreter/lexer"
+	"jsInterpreter/logger"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ESTree格式的节点，字段按照添加的顺序输出，type总是第一个字段
+https://github.com/estree/estree
+*/
+type ESNode struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newESNode(t string) *ESNode {
+	node := &ESNode{values: map[string]interface{}{}}
+	node.Set("type", t)
+	return node
+}
+
+func (n *ESNode) Set(key string, value interface{}) *ESNode {
+	if _, has := n.values[key]; !has {
+		n.keys = append(n.keys, key)
+	}
+	n.values[key] = value
+	return n
+}
+
+func (n *ESNode) Get(key string) interface{} {
+	return n.values[key]
+}
+
+func (n *ESNode) Type() string {
+	return n.values["type"].(string)
+}
+
+func (n *ESNode) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range n.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(n.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+/*
+把语法树转换成ESTree，和acorn一样:
+start/end/range是UTF-16的偏移，loc中line从1开始，column从0开始
+括号不会产生节点，没有位置信息的节点(例如函数参数)不输出位置
+*/
+func ToESTree(program *Stmt, source string, module bool) *ESNode {
+	c := newESTreeConverter(source)
+	node := c.stmt(program)
+	if module {
+		node.Set("sourceType", "module")
+	} else {
+		node.Set("sourceType", "script")
+	}
+	return node
+}
+
+//ESTree的JSON文本，indent为空时不换行
+func MarshalESTree(program *Stmt, source string, module bool, indent string) ([]byte, error) {
+	node := ToESTree(program, source, module)
+	if indent == "" {
+		return json.Marshal(node)
+	}
+	return json.MarshalIndent(node, "", indent)
+}
+
+type esTreeConverter struct {
+	source string
+	//每一行开头的字节偏移
+	lineStarts []int
+}
+
+func newESTreeConverter(source string) *esTreeConverter {
+	lineStarts := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return &esTreeConverter{source: source, lineStarts: lineStarts}
+}
+
+//字节偏移转换成UTF-16偏移
+func (c *esTreeConverter) utf16Offset(from int, to int) int {
+	n := 0
+	for _, r := range c.source[from:to] {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *esTreeConverter) position(offset int) *ESNode {
+	line := sort.Search(len(c.lineStarts), func(i int) bool { return c.lineStarts[i] > offset }) - 1
+	position := &ESNode{values: map[string]interface{}{}}
+	return position.
+		Set("line", line+1).
+		Set("column", c.utf16Offset(c.lineStarts[line], offset))
+}
+
+func (c *esTreeConverter) withLoc(node *ESNode, loc logger.Loc) *ESNode {
+	if loc.Line == 0 && loc.Offset == 0 && loc.Len == 0 {
+		return node
+	}
+	startOffset, endOffset := loc.Offset, loc.Offset+loc.Len
+	if endOffset > len(c.source) {
+		endOffset = len(c.source)
+	}
+	if endOffset < startOffset {
+		endOffset = startOffset
+	}
+	start := c.utf16Offset(0, startOffset)
+	end := start + c.utf16Offset(startOffset, endOffset)
+	location := &ESNode{values: map[string]interface{}{}}
+	location.Set("start", c.position(startOffset)).Set("end", c.position(endOffset))
+	return node.
+		Set("start", start).
+		Set("end", end).
+		Set("loc", location).
+		Set("range", []int{start, end})
+}
+
+/*
+以分号结束的语句(变量声明、表达式语句、return等)，和acorn一样位置包括后面的分号
+语法树中语句的位置不包括分号，这里跳过空白看后面是不是分号
+*/
+func (c *esTreeConverter) semicolon(loc logger.Loc) logger.Loc {
+	i := loc.Offset + loc.Len
+	for i < len(c.source) && strings.IndexByte(" \t\r\n", c.source[i]) >= 0 {
+		i++
+	}
+	if i < len(c.source) && c.source[i] == ';' {
+		loc.Len = i + 1 - loc.Offset
+	}
+	return loc
+}
+
+//VariableDeclarator从变量名开始，不包括前面的let/const/var
+func (c *esTreeConverter) declarator(loc logger.Loc, kind string) logger.Loc {
+	end := loc.Offset + loc.Len
+	if end > len(c.source) || !strings.HasPrefix(c.source[loc.Offset:end], kind) {
+		return loc
+	}
+	start := loc.Offset + len(kind)
+	for start < end && strings.IndexByte(" \t\r\n", c.source[start]) >= 0 {
+		start++
+	}
+	return logger.Loc{Offset: start, Len: end - start, Line: loc.Line}
+}
+
+//语句是否以分号结束，函数声明、类声明以及块语句之后的分号是单独的空语句
+func terminated(stmt *Stmt) bool {
+	switch s := stmt.Data.(type) {
+	case *SVarDecl, *SBreak, *SContinue, *SReturn, *SThrow, *SImport, *SExportNamed, *SExportAll:
+		return true
+	case *SExpr:
+		fn, isFn := s.Data.(*EFunctionExpr)
+		return !isFn || fn.Id == nil
+	case *SExportDefault:
+		_, isFn := s.Expr.Data.(*EFunctionExpr)
+		return !isFn
+	case *SExportDecl:
+		return terminated(s.Decl)
+	case *SLabeled:
+		return terminated(s.Body)
+	}
+	return false
+}
+
+func (c *esTreeConverter) node(t string, loc logger.Loc) *ESNode {
+	return c.withLoc(newESNode(t), loc)
+}
+
+func (c *esTreeConverter) identifier(name string, loc logger.Loc) *ESNode {
+	return c.node("Identifier", loc).Set("name", name)
+}
+
+func (c *esTreeConverter) identifiers(ids []EIdentifier) []*ESNode {
+	nodes := []*ESNode{}
+	for _, id := range ids {
+		nodes = append(nodes, c.identifier(id.Value, logger.Loc{}))
+	}
+	return nodes
+}
+
+//break和continue没有标签时label为null
+func (c *esTreeConverter) label(name string) interface{} {
+	if name == "" {
+		return nil
+	}
+	return c.identifier(name, logger.Loc{})
+}
+
+func (c *esTreeConverter) stringLiteral(value string) *ESNode {
+	raw, _ := json.Marshal(value)
+	return newESNode("Literal").Set("value", value).Set("raw", string(raw))
+}
+
+//import/export中的名字，不是合法标识符时是字符串
+func (c *esTreeConverter) moduleExportName(name string) *ESNode {
+	if name == "" {
+		return c.stringLiteral(name)
+	}
+	for i, r := range name {
+		isLetter := r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return c.stringLiteral(name)
+		}
+	}
+	return c.identifier(name, logger.Loc{})
+}
+
+func (c *esTreeConverter) stmts(stmts []*Stmt) []*ESNode {
+	nodes := []*ESNode{}
+	for _, stmt := range stmts {
+		nodes = append(nodes, c.stmt(stmt))
+	}
+	return nodes
+}
+
+func (c *esTreeConverter) body(body *SBody) *ESNode {
+	if body == nil {
+		return nil
+	}
+	return c.node("BlockStatement", body.Loc).Set("body", c.stmts(body.Data.Data))
+}
+
+func (c *esTreeConverter) optionalExpr(expr *Expr) interface{} {
+	if expr == nil || expr.Data == nil {
+		return nil
+	}
+	return c.expr(expr)
+}
+
+//for循环的初始化和更新部分，表达式语句只保留表达式
+func (c *esTreeConverter) forClause(stmt *Stmt) interface{} {
+	if stmt == nil || stmt.Data == nil {
+		return nil
+	}
+	if e, isExpr := stmt.Data.(*SExpr); isExpr {
+		return c.optionalExpr(&e.Expr)
+	}
+	//for (let i = 0; ...)中的分号不属于变量声明
+	return c.withLoc(c.stmt(stmt), stmt.Loc)
+}
+
+func (c *esTreeConverter) function(t string, loc logger.Loc, id *EIdentifier, params []EIdentifier, body *SBody, generator bool, async bool) *ESNode {
+	var idNode interface{}
+	if id != nil {
+		idNode = c.identifier(id.Value, logger.Loc{})
+	}
+	return c.node(t, loc).
+		Set("id", idNode).
+		Set("expression", false).
+		Set("generator", generator).
+		Set("async", async).
+		Set("params", c.identifiers(params)).
+		Set("body", c.body(body))
+}
+
+func varKind(kind VarKind) string {
+	switch kind {
+	case VConst:
+		return "const"
+	case VVar:
+		return "var"
+	default:
+		return "let"
+	}
+}
+
+func (c *esTreeConverter) stmt(stmt *Stmt) *ESNode {
+	loc := stmt.Loc
+	if terminated(stmt) {
+		loc = c.semicolon(loc)
+	}
+	switch s := stmt.Data.(type) {
+	case nil:
+		return c.node("EmptyStatement", loc)
+	case *SError:
+		//出错的语句没有对应的ESTree节点，错误信息在Parse返回的Diagnostic中
+		return c.node("EmptyStatement", loc)
+	case *SProgram:
+		//和acorn一样Program包括整个源码，开头和结尾的空白也在里面
+		loc = logger.Loc{Offset: 0, Len: len(c.source), Line: 1}
+		return c.node("Program", loc).Set("body", c.stmts(s.Body))
+	case *SVarDecl:
+		declarator := c.node("VariableDeclarator", c.declarator(stmt.Loc, varKind(s.kind))).
+			Set("id", c.identifier(s.Id.Value, logger.Loc{})).
+			Set("init", c.optionalExpr(s.Init))
+		return c.node("VariableDeclaration", loc).
+			Set("declarations", []*ESNode{declarator}).
+			Set("kind", varKind(s.kind))
+	case *SExpr:
+		//语句开头的具名function是函数声明
+		if fn, isFn := s.Data.(*EFunctionExpr); isFn && fn.Id != nil {
+			return c.function("FunctionDeclaration", loc, fn.Id, fn.Params, fn.Body, fn.Generator, fn.Async)
+		}
+		return c.node("ExpressionStatement", loc).Set("expression", c.expr(&s.Expr))
+	case *SBlock:
+		return c.node("BlockStatement", loc).Set("body", c.stmts(s.Data))
+	case *SBody:
+		return c.body(s)
+	case *SBreak:
+		return c.node("BreakStatement", loc).Set("label", c.label(s.Label))
+	case *SContinue:
+		return c.node("ContinueStatement", loc).Set("label", c.label(s.Label))
+	case *SLabeled:
+		return c.node("LabeledStatement", loc).
+			Set("label", c.identifier(s.Label, logger.Loc{})).
+			Set("body", c.stmt(s.Body))
+	case *SFor:
+		return c.node("ForStatement", loc).
+			Set("init", c.forClause(s.Initializer)).
+			Set("test", c.optionalExpr(s.Condition)).
+			Set("update", c.forClause(s.Reset)).
+			Set("body", c.body(s.Body))
+	case *SWhile:
+		var test interface{}
+		if e, isExpr := s.Condition.Data.(*SExpr); isExpr {
+			test = c.expr(&e.Expr)
+		}
+		return c.node("WhileStatement", loc).
+			Set("test", test).
+			Set("body", c.body(&s.Body))
+	case *SCondition:
+		//if/else if/else从最后一个分支开始嵌套成IfStatement，else if没有单独的位置
+		var alternate interface{}
+		for i := len(s.Branches) - 1; i >= 0; i-- {
+			branch := s.Branches[i]
+			if branch.Condition == nil {
+				alternate = c.body(branch.Body)
+				continue
+			}
+			node := newESNode("IfStatement")
+			if i == 0 {
+				node = c.node("IfStatement", loc)
+			}
+			alternate = node.
+				Set("test", c.expr(branch.Condition)).
+				Set("consequent", c.body(branch.Body)).
+				Set("alternate", alternate)
+		}
+		return alternate.(*ESNode)
+	case *SFunctionDecl:
+		return c.function("FunctionDeclaration", loc, s.Id, s.Params, s.Body, s.Generator, s.Async)
+	case *SReturn:
+		return c.node("ReturnStatement", loc).Set("argument", c.optionalExpr(&s.Expr))
+	case *SThrow:
+		return c.node("ThrowStatement", loc).Set("argument", c.expr(&s.Expr))
+	case *STry:
+		var handler interface{}
+		if s.Handler != nil {
+			var param interface{}
+			if s.Param != nil {
+				param = c.identifier(s.Param.Value, logger.Loc{})
+			}
+			handler = c.node("CatchClause", logger.Loc{}).
+				Set("param", param).
+				Set("body", c.body(s.Handler))
+		}
+		var finalizer interface{}
+		if s.Finalizer != nil {
+			finalizer = c.body(s.Finalizer)
+		}
+		return c.node("TryStatement", loc).
+			Set("block", c.body(s.Block)).
+			Set("handler", handler).
+			Set("finalizer", finalizer)
+	case *SClass:
+		var superClass interface{}
+		if s.SuperClass != nil {
+			superClass = c.expr(s.SuperClass)
+		}
+		members := []*ESNode{}
+		for _, member := range s.Body {
+			members = append(members, c.classMember(member))
+		}
+		return c.node("ClassDeclaration", loc).
+			Set("id", c.identifier(s.Id.Value, logger.Loc{})).
+			Set("superClass", superClass).
+			Set("body", newESNode("ClassBody").Set("body", members))
+	case *SImport:
+		specifiers := []*ESNode{}
+		if s.Default != nil {
+			specifiers = append(specifiers, newESNode("ImportDefaultSpecifier").
+				Set("local", c.identifier(s.Default.Value, logger.Loc{})))
+		}
+		if s.Namespace != nil {
+			specifiers = append(specifiers, newESNode("ImportNamespaceSpecifier").
+				Set("local", c.identifier(s.Namespace.Value, logger.Loc{})))
+		}
+		for _, specifier := range s.Specifiers {
+			specifiers = append(specifiers, newESNode("ImportSpecifier").
+				Set("imported", c.moduleExportName(specifier.Imported)).
+				Set("local", c.identifier(specifier.Local.Value, logger.Loc{})))
+		}
+		return c.node("ImportDeclaration", loc).
+			Set("specifiers", specifiers).
+			Set("source", c.stringLiteral(s.Source))
+	case *SExportDecl:
+		return c.node("ExportNamedDeclaration", loc).
+			Set("declaration", c.stmt(s.Decl)).
+			Set("specifiers", []*ESNode{}).
+			Set("source", nil)
+	case *SExportDefault:
+		var declaration *ESNode
+		switch e := s.Expr.Data.(type) {
+		case *EFunctionExpr:
+			declaration = c.function("FunctionDeclaration", s.Expr.Loc, e.Id, e.Params, e.Body, e.Generator, e.Async)
+		default:
+			declaration = c.expr(&s.Expr)
+		}
+		return c.node("ExportDefaultDeclaration", loc).Set("declaration", declaration)
+	case *SExportNamed:
+		specifiers := []*ESNode{}
+		for _, specifier := range s.Specifiers {
+			specifiers = append(specifiers, newESNode("ExportSpecifier").
+				Set("local", c.moduleExportName(specifier.Local)).
+				Set("exported", c.moduleExportName(specifier.Exported)))
+		}
+		var source interface{}
+		if s.Source != nil {
+			source = c.stringLiteral(*s.Source)
+		}
+		return c.node("ExportNamedDeclaration", loc).
+			Set("declaration", nil).
+			Set("specifiers", specifiers).
+			Set("source", source)
+	case *SExportAll:
+		var exported interface{}
+		if s.Exported != nil {
+			exported = c.moduleExportName(*s.Exported)
+		}
+		return c.node("ExportAllDeclaration", loc).
+			Set("exported", exported).
+			Set("source", c.stringLiteral(s.Source))
+	default:
+		return c.node("Unknown", loc)
+	}
+}
+
+func (c *esTreeConverter) classMember(member ClassMember) *ESNode {
+	key := c.identifier(member.Key.Value, logger.Loc{})
+	switch value := member.Value.(type) {
+	case *SFunctionDecl:
+		kind := "method"
+		if member.Key.Value == "constructor" {
+			kind = "constructor"
+		}
+		return c.node("MethodDefinition", member.Loc).
+			Set("static", false).
+			Set("computed", false).
+			Set("key", key).
+			Set("kind", kind).
+			Set("value", c.function("FunctionExpression", logger.Loc{}, nil, value.Params, value.Body, value.Generator, value.Async))
+	case *SVarDecl:
+		return c.node("PropertyDefinition", member.Loc).
+			Set("static", false).
+			Set("computed", false).
+			Set("key", key).
+			Set("value", c.optionalExpr(value.Init))
+	default:
+		return c.node("Unknown", member.Loc)
+	}
+}
+
+func (c *esTreeConverter) exprs(exprs []*Expr) []*ESNode {
+	nodes := []*ESNode{}
+	for _, expr := range exprs {
+		nodes = append(nodes, c.expr(expr))
+	}
+	return nodes
+}
+
+func (c *esTreeConverter) raw(loc logger.Loc) string {
+	if loc.Offset+loc.Len > len(c.source) {
+		return ""
+	}
+	return c.source[loc.Offset : loc.Offset+loc.Len]
+}
+
+func isLogical(op EOp) bool {
+	t := lexer.T(op)
+	return t == lexer.TAmpersandAmpersand || t == lexer.TBarBar || t == lexer.TQuestionQuestion
+}
+
+func (c *esTreeConverter) expr(expr *Expr) *ESNode {
+	loc := expr.Loc
+	switch e := expr.Data.(type) {
+	case nil:
+		return nil
+	case *EParen:
+		return c.expr(&e.Data)
+	case *EIdentifier:
+		return c.identifier(e.Value, loc)
+	case *EThis:
+		return c.node("ThisExpression", loc)
+	case *ENumericLiteral:
+		value, _ := strconv.ParseFloat(e.Value, 64)
+		return c.node("Literal", loc).Set("value", value).Set("raw", e.Value)
+	case *EStringLiteral:
+		return c.node("Literal", loc).Set("value", e.Value).Set("raw", c.raw(loc))
+	case *EBoolLiteral:
+		return c.node("Literal", loc).Set("value", e.Value).Set("raw", strconv.FormatBool(e.Value))
+	case *ENullLiteral:
+		return c.node("Literal", loc).Set("value", nil).Set("raw", "null")
+	case *EArrayLiteral:
+		return c.node("ArrayExpression", loc).Set("elements", c.exprs(e.Arr))
+	case *EObjectLiteral:
+		properties := []*ESNode{}
+		for _, property := range e.Properties {
+			properties = append(properties, c.property(property))
+		}
+		return c.node("ObjectExpression", loc).Set("properties", properties)
+	case *EAssign:
+		return c.node("AssignmentExpression", loc).
+			Set("operator", AssignOperator(e.Op)).
+			Set("left", c.expr(e.Target)).
+			Set("right", c.expr(e.Assignment))
+	case *ESequence:
+		expressions := []*ESNode{}
+		for i := range e.Exprs {
+			expressions = append(expressions, c.expr(&e.Exprs[i]))
+		}
+		return c.node("SequenceExpression", loc).Set("expressions", expressions)
+	case *EBinary:
+		t := "BinaryExpression"
+		if isLogical(e.Op) {
+			t = "LogicalExpression"
+		}
+		return c.node(t, loc).
+			Set("left", c.expr(&e.Left)).
+			Set("operator", lexer.Token2StringMap[lexer.T(e.Op)]).
+			Set("right", c.expr(&e.Right))
+	case *EConditional:
+		return c.node("ConditionalExpression", loc).
+			Set("test", c.expr(&e.Test)).
+			Set("consequent", c.expr(&e.Consequent)).
+			Set("alternate", c.expr(&e.Alternate))
+	case *EUnary:
+		t := "UnaryExpression"
+		if e.Op == EOp(lexer.TPlusPlus) || e.Op == EOp(lexer.TMinusMinus) {
+			t = "UpdateExpression"
+		}
+		return c.node(t, loc).
+			Set("operator", lexer.Token2StringMap[lexer.T(e.Op)]).
+			Set("prefix", e.Association == AssociationLeft).
+			Set("argument", c.expr(&e.Value))
+	case *EMemberExpr:
+		//属性名在表达式的结尾
+		name := e.Property.Value
+		propertyLoc := logger.Loc{Offset: loc.Offset + loc.Len - len(name), Len: len(name), Line: loc.Line}
+		if !strings.HasSuffix(c.raw(loc), name) {
+			propertyLoc = logger.Loc{}
+		}
+		return c.node("MemberExpression", loc).
+			Set("object", c.expr(&e.Obj)).
+			Set("property", c.identifier(name, propertyLoc)).
+			Set("computed", false).
+			Set("optional", false)
+	case *EIndex:
+		return c.node("MemberExpression", loc).
+			Set("object", c.expr(&e.Target)).
+			Set("property", c.expr(&e.Idx)).
+			Set("computed", true).
+			Set("optional", false)
+	case *ECallExpr:
+		return c.node("CallExpression", loc).
+			Set("callee", c.expr(&e.Callee)).
+			Set("arguments", c.exprs(e.Args)).
+			Set("optional", false)
+	case *ENew:
+		return c.node("NewExpression", loc).
+			Set("callee", c.expr(&e.Callee)).
+			Set("arguments", c.exprs(e.Args))
+	case *EFunctionExpr:
+		return c.function("FunctionExpression", loc, e.Id, e.Params, e.Body, e.Generator, e.Async)
+	case *EArrowFunction:
+		node := c.function("ArrowFunctionExpression", loc, nil, e.Params, e.Body, false, e.Async)
+		if e.Expression {
+			//表达式形式的函数体被包装成了return语句，还原成表达式
+			if ret, isRet := e.Body.Data.Data[0].Data.(*SReturn); isRet && len(e.Body.Data.Data) == 1 {
+				node.Set("expression", true).Set("body", c.expr(&ret.Expr))
+			}
+		}
+		return node
+	case *EAwait:
+		return c.node("AwaitExpression", loc).Set("argument", c.expr(&e.Value))
+	case *EYield:
+		return c.node("YieldExpression", loc).
+			Set("delegate", e.Delegate).
+			Set("argument", c.optionalExpr(e.Argument))
+	case *EImportCall:
+		return c.node("ImportExpression", loc).Set("source", c.expr(&e.Source))
+	default:
+		return c.node("Unknown", loc)
+	}
+}
+
+func (c *esTreeConverter) property(property Property) *ESNode {
+	node := c.node("Property", property.Loc)
+	var key *ESNode
+	switch k := property.Key.Data.(type) {
+	case *EStringLiteral:
+		//非计算属性名是标识符时输出Identifier
+		if raw := c.raw(property.Key.Loc); raw != "" && !strings.HasPrefix(raw, "\"") && !strings.HasPrefix(raw, "'") {
+			key = c.identifier(k.Value, property.Key.Loc)
+		} else {
+			key = c.expr(&property.Key)
+		}
+	default:
+		key = c.expr(&property.Key)
+	}
+	kind := "init"
+	switch property.Kind {
+	case PropertyGet:
+		kind = "get"
+	case PropertySet:
+		kind = "set"
+	}
+	value := c.expr(&property.Value)
+	if property.Kind == PropertyMethod || property.Kind == PropertyGet || property.Kind == PropertySet {
+		//方法的名字在key上，函数本身是匿名的
+		value.Set("id", nil)
+	}
+	return node.
+		Set("method", property.Kind == PropertyMethod).
+		Set("shorthand", property.Shorthand).
+		Set("computed", property.Computed).
+		Set("key", key).
+		Set("kind", kind).
+		Set("value", value)
+}
@@ -0,0 +1,79 @@
+package ast_parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_ESTree(t *testing.T) {
+	code := "a.b = -1 || c"
+	p := NewParser(code)
+	ast, _ := p.Parse()
+	output, err := MarshalESTree(&ast, code, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"Program","start":0,"end":13,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":13}},"range":[0,13],"body":[` +
+		`{"type":"ExpressionStatement","start":0,"end":13,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":13}},"range":[0,13],"expression":` +
+		`{"type":"AssignmentExpression","start":0,"end":13,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":13}},"range":[0,13],"operator":"=","left":` +
+		`{"type":"MemberExpression","start":0,"end":3,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":3}},"range":[0,3],"object":` +
+		`{"type":"Identifier","start":0,"end":1,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":1}},"range":[0,1],"name":"a"},"property":` +
+		`{"type":"Identifier","start":2,"end":3,"loc":{"start":{"line":1,"column":2},"end":{"line":1,"column":3}},"range":[2,3],"name":"b"},"computed":false,"optional":false},"right":` +
+		`{"type":"LogicalExpression","start":6,"end":13,"loc":{"start":{"line":1,"column":6},"end":{"line":1,"column":13}},"range":[6,13],"left":` +
+		`{"type":"UnaryExpression","start":6,"end":8,"loc":{"start":{"line":1,"column":6},"end":{"line":1,"column":8}},"range":[6,8],"operator":"-","prefix":true,"argument":` +
+		`{"type":"Literal","start":7,"end":8,"loc":{"start":{"line":1,"column":7},"end":{"line":1,"column":8}},"range":[7,8],"value":1,"raw":"1"}},"operator":"||","right":` +
+		`{"type":"Identifier","start":12,"end":13,"loc":{"start":{"line":1,"column":12},"end":{"line":1,"column":13}},"range":[12,13],"name":"c"}}}}],"sourceType":"script"}`
+	if string(output) != want {
+		t.Errorf("got\n%s\nwant\n%s", output, want)
+	}
+}
+
+//按先序遍历列出有位置的节点和它们的range
+func esRanges(node interface{}) []string {
+	ranges := []string{}
+	switch n := node.(type) {
+	case *ESNode:
+		if r, has := n.Get("range").([]int); has {
+			ranges = append(ranges, fmt.Sprintf("%s %v", n.Type(), r))
+		}
+		for _, key := range n.keys {
+			ranges = append(ranges, esRanges(n.values[key])...)
+		}
+	case []*ESNode:
+		for _, child := range n {
+			ranges = append(ranges, esRanges(child)...)
+		}
+	}
+	return ranges
+}
+
+//语句的位置包括后面的分号，Program包括整个源码，和acorn的输出相同
+func Test_ESTreeRanges(t *testing.T) {
+	cases := map[string][]string{
+		"let a = 1 + 2 * 3;\nfoo(a) ;\n\n": {
+			"Program [0 29]",
+			"VariableDeclaration [0 18]", "VariableDeclarator [4 17]",
+			"BinaryExpression [8 17]", "Literal [8 9]", "BinaryExpression [12 17]", "Literal [12 13]", "Literal [16 17]",
+			"ExpressionStatement [19 27]", "CallExpression [19 25]", "Identifier [19 22]", "Identifier [23 24]",
+		},
+		"for (let i = 0; i < 1; i++) { break; }  ": {
+			"Program [0 40]", "ForStatement [0 38]",
+			"VariableDeclaration [5 14]", "VariableDeclarator [9 14]", "Literal [13 14]",
+			"BinaryExpression [16 21]", "Identifier [16 17]", "Literal [20 21]",
+			"UpdateExpression [23 26]", "Identifier [23 24]",
+			"BlockStatement [28 38]", "BreakStatement [30 36]",
+		},
+	}
+	for code, expected := range cases {
+		p := NewParser(code)
+		ast, diagnostics := p.Parse()
+		if len(diagnostics) > 0 {
+			t.Fatal(diagnostics)
+		}
+		got := esRanges(ToESTree(&ast, code, false))
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%q: expected\n%s\ngot\n%s", code, strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
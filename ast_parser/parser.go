@@ -13,6 +13,22 @@ type AstParser struct {
 	Curr      int
 	HasError  bool
 	Log       logger.Logger
+	//当前是否在generator函数体中，yield只在generator中是关键字
+	inGenerator bool
+	//当前是否在async函数体中，await只在async函数中是关键字
+	inAsync bool
+	//按照模块解析，模块顶层可以使用await
+	IsModule bool
+	//当前是否在函数体中
+	inFunction bool
+	//当前代码是否是严格模式：模块、类、以"use strict"开头的程序和函数，以及其中嵌套的函数
+	inStrict bool
+	//当前是否在try块中，这里的return不是尾调用，有finally的catch块在解析完之后再去掉标记
+	inTry bool
+	//模块顶层是否使用了await
+	HasTopLevelAwait bool
+	//词法和语法错误，出错后会跳到下一条语句继续解析，所以可能有多个
+	Diagnostics []logger.Diagnostic
 }
 
 type AstError struct {
@@ -32,6 +48,7 @@ func NewParser(source string) AstParser {
 
 	if l.HasError {
 		p.HasError = true
+		p.Diagnostics = append(p.Diagnostics, l.Diagnostics...)
 	}
 	return p
 }
@@ -43,7 +60,7 @@ func (p *AstParser) Error(err AstError) {
 
 func (p *AstParser) CurToken() lexer.Token {
 	if p.IsEnd() {
-		return lexer.Token{lexer.TEndOfFile, p.Prev().Loc}
+		return lexer.Token{T: lexer.TEndOfFile, Loc: p.Prev().Loc}
 	}
 	return p.Tokens[p.Curr]
 }
@@ -92,40 +109,352 @@ func (p *AstParser) Check(matches ...lexer.T) bool {
 	return false
 }
 
+func (p *AstParser) Peek() lexer.Token {
+	if p.Curr+1 >= len(p.Tokens) {
+		return lexer.Token{T: lexer.TEndOfFile, Loc: p.CurToken().Loc}
+	}
+	return p.Tokens[p.Curr+1]
+}
+
 func (p *AstParser) Prev() *lexer.Token {
 	return &p.Tokens[p.Curr-1]
 }
 
-func (p *AstParser) AdvanceToNextStmt() {
-
+/*
+panic模式的错误恢复：从出错的位置开始跳过token，直到语句的边界
+遇到分号时跳过分号后停下，遇到}、语句开头的关键字或者换行时停下，括号中的token都会被跳过
+start是出错的语句开始的位置，如果还没有消耗任何token，至少跳过一个，保证能继续向后解析
+*/
+func (p *AstParser) AdvanceToNextStmt(start int) {
+	if p.Curr == start && !p.IsEnd() {
+		p.Step()
+	}
+	depth := 0
+	for !p.IsEnd() {
+		token := p.CurToken()
+		if depth == 0 {
+			switch token.T {
+			case lexer.TSemicolon:
+				p.Step()
+				return
+			case lexer.TCloseBrace,
+				lexer.TLet, lexer.TConst, lexer.TVar, lexer.TFunction, lexer.TClass,
+				lexer.TIf, lexer.TFor, lexer.TWhile, lexer.TReturn, lexer.TThrow, lexer.TTry,
+				lexer.TImport, lexer.TExport:
+				return
+			}
+			if p.Curr > 0 && token.Loc.Line > p.Prev().Loc.Line {
+				return
+			}
+		}
+		switch token.T {
+		case lexer.TOpenBrace, lexer.TOpenParen, lexer.TOpenBracket:
+			depth++
+		case lexer.TCloseBrace, lexer.TCloseParen, lexer.TCloseBracket:
+			if depth > 0 {
+				depth--
+			}
+		}
+		p.Step()
+	}
 }
 
-func (p *AstParser) Parse() Stmt {
+/*
+解析一条语句，出错时记录错误并跳到下一条语句，出错的语句用SError代替
+*/
+func (p *AstParser) recoverStmt(parse func() Stmt) (stmt Stmt) {
+	start := p.Curr
+	loc := p.CurToken().Loc
+	inGenerator, inAsync, inFunction, inStrict := p.inGenerator, p.inAsync, p.inFunction, p.inStrict
 	defer func() {
 		err := recover()
-		if err != nil {
-			p.HasError = true
-			if err, isErr := err.(AstError); isErr {
-				p.Log.Print(logger.LError, err.Loc, err.Msg)
-			} else {
-				panic(err)
-			}
+		if err == nil {
+			return
+		}
+		astErr, isErr := err.(AstError)
+		if !isErr {
+			panic(err)
+		}
+		p.HasError = true
+		diagnostic := logger.Diagnostic{Kind: logger.LError, Loc: astErr.Loc, Msg: astErr.Msg}
+		if !p.reported(diagnostic) {
+			p.Diagnostics = append(p.Diagnostics, diagnostic)
 		}
+		p.inGenerator, p.inAsync, p.inFunction, p.inStrict = inGenerator, inAsync, inFunction, inStrict
+		p.AdvanceToNextStmt(start)
+		p.calcLocFromPrevToken(&loc)
+		stmt = Stmt{loc, &SError{}}
 	}()
+	return parse()
+}
+
+//同一个错误是否已经报告过，例如词法分析发现的错误在语法分析遇到错误token时不再重复报告
+func (p *AstParser) reported(diagnostic logger.Diagnostic) bool {
+	for _, d := range p.Diagnostics {
+		if d == diagnostic {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+解析整个程序，出错时不会停止，返回尽量完整的语法树以及所有的错误
+*/
+func (p *AstParser) Parse() (Stmt, []logger.Diagnostic) {
 	loc := logger.Loc{Line: 1}
+	p.inAsync = p.IsModule
+	p.inStrict = p.IsModule || p.useStrict(p.Curr)
 	stmts := make([]*Stmt, 0)
 	for !p.IsEnd() {
-		stmt := p.stmt()
+		stmt := p.recoverStmt(p.moduleItem)
 		stmts = append(stmts, &stmt)
 	}
 	p.calcLocFromPrevToken(&loc)
 	return Stmt{
 		Loc:  loc,
-		Data: &SProgram{Body: stmts},
+		Data: &SProgram{Body: stmts, Strict: p.inStrict},
+	}, p.Diagnostics
+}
+
+/*
+从start开始的指令序言(程序或函数体开头只有一个字符串的语句)中是否有"use strict"
+只看token，不消耗，这样函数体中的代码在解析时就知道是不是严格模式
+*/
+func (p *AstParser) useStrict(start int) bool {
+	for i := start; i < len(p.Tokens) && p.Tokens[i].T == lexer.TStringLiteral; i++ {
+		raw := p.Raw(p.Tokens[i])
+		if i+1 < len(p.Tokens) {
+			//字符串后面还有其他内容时是表达式，不是指令
+			next := p.Tokens[i+1]
+			switch {
+			case next.T == lexer.TSemicolon:
+				i++
+			case next.T == lexer.TCloseBrace, next.Loc.Line > p.Tokens[i].Loc.Line:
+			default:
+				return false
+			}
+		}
+		if raw[1:len(raw)-1] == "use strict" {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+程序顶层的语句，import和export声明只能出现在模块的顶层
+*/
+func (p *AstParser) moduleItem() Stmt {
+	token := p.CurToken()
+	switch {
+	case token.T == lexer.TImport && p.Peek().T != lexer.TOpenParen:
+	case token.T == lexer.TExport:
+	default:
+		return p.stmt()
+	}
+	if !p.IsModule {
+		p.Error(AstError{token.Loc, "Syntax Error: Cannot use " + p.Raw(token) + " statement outside a module"})
+	}
+
+	var stmt Stmt
+	if token.T == lexer.TImport {
+		stmt = p.importDecl()
+	} else {
+		stmt = p.exportDecl()
+	}
+	if p.Check(lexer.TSemicolon) {
+		p.Step()
+	}
+	return stmt
+}
+
+/*
+import "m"
+import d from "m"
+import * as ns from "m"
+import { a, b as c, default as d } from "m"
+import d, { a } from "m" / import d, * as ns from "m"
+*/
+func (p *AstParser) importDecl() Stmt {
+	loc := p.Consume(lexer.TImport).Loc
+	importDecl := SImport{}
+
+	if p.Check(lexer.TStringLiteral) {
+		importDecl.Source = p.moduleSource()
+		p.calcLocFromPrevToken(&loc)
+		return Stmt{loc, &importDecl}
+	}
+
+	if p.Check(lexer.TIdentifier) {
+		importDecl.Default = &EIdentifier{Value: p.Raw(p.Step())}
+		if !p.Check(lexer.TComma) {
+			p.expectContextual("from")
+			importDecl.Source = p.moduleSource()
+			p.calcLocFromPrevToken(&loc)
+			return Stmt{loc, &importDecl}
+		}
+		p.Step()
+	}
+
+	switch {
+	case p.Check(lexer.TAsterisk):
+		p.Step()
+		p.expectContextual("as")
+		importDecl.Namespace = &EIdentifier{Value: p.Raw(p.Consume(lexer.TIdentifier))}
+	case p.Check(lexer.TOpenBrace):
+		p.Step()
+		for !p.Check(lexer.TCloseBrace) {
+			nameToken := p.CurToken()
+			imported := p.moduleExportName()
+			local := imported
+			if p.isContextual("as") {
+				p.Step()
+				local = p.Raw(p.Consume(lexer.TIdentifier))
+			} else if nameToken.T != lexer.TIdentifier {
+				//import { default } from "m"这样的关键字或字符串不能直接作为变量名
+				p.Error(AstError{nameToken.Loc, "Syntax Error: Unexpected reserved word '" + imported + "'"})
+			}
+			importDecl.Specifiers = append(importDecl.Specifiers, ImportSpecifier{
+				Imported: imported,
+				Local:    EIdentifier{Value: local},
+			})
+			if !p.Check(lexer.TCloseBrace) {
+				p.Consume(lexer.TComma)
+			}
+		}
+		p.Consume(lexer.TCloseBrace)
+	default:
+		p.Error(AstError{p.CurToken().Loc, "Syntax Error: unexpected token in import declaration"})
+	}
+
+	p.expectContextual("from")
+	importDecl.Source = p.moduleSource()
+	p.calcLocFromPrevToken(&loc)
+	return Stmt{loc, &importDecl}
+}
+
+/*
+export let a = 1 / export function f() { } / export class A { }
+export default expr
+export { a, b as c } / export { a } from "m"
+export * from "m" / export * as ns from "m"
+*/
+func (p *AstParser) exportDecl() Stmt {
+	loc := p.Consume(lexer.TExport).Loc
+	token := p.CurToken()
+	var data S
+
+	switch {
+	case token.T == lexer.TDefault:
+		p.Step()
+		expr := p.assignment()
+		data = &SExportDefault{Expr: expr}
+	case token.T == lexer.TLet, token.T == lexer.TConst, token.T == lexer.TVar:
+		decl := p.sVarDecl()
+		data = &SExportDecl{Decl: &decl}
+	case token.T == lexer.TClass:
+		decl := p.class()
+		data = &SExportDecl{Decl: &decl}
+	case token.T == lexer.TFunction, p.Raw(token) == "async" && p.Peek().T == lexer.TFunction:
+		expr := p.assignment()
+		if fn, ok := expr.Data.(*EFunctionExpr); !ok || fn.Id == nil {
+			p.Error(AstError{expr.Loc, "Syntax Error: Function statements require a function name"})
+		}
+		data = &SExportDecl{Decl: &Stmt{expr.Loc, &SExpr{Expr: expr}}}
+	case token.T == lexer.TAsterisk:
+		p.Step()
+		exportAll := SExportAll{}
+		if p.isContextual("as") {
+			p.Step()
+			exported := p.moduleExportName()
+			exportAll.Exported = &exported
+		}
+		p.expectContextual("from")
+		exportAll.Source = p.moduleSource()
+		data = &exportAll
+	case token.T == lexer.TOpenBrace:
+		p.Step()
+		exportNamed := SExportNamed{}
+		//没有from时导出的必须是本模块的变量，不能是关键字
+		var reserved *lexer.Token
+		for !p.Check(lexer.TCloseBrace) {
+			if p.CurToken().T != lexer.TIdentifier && reserved == nil {
+				t := p.CurToken()
+				reserved = &t
+			}
+			local := p.moduleExportName()
+			exported := local
+			if p.isContextual("as") {
+				p.Step()
+				exported = p.moduleExportName()
+			}
+			exportNamed.Specifiers = append(exportNamed.Specifiers, ExportSpecifier{
+				Local:    local,
+				Exported: exported,
+			})
+			if !p.Check(lexer.TCloseBrace) {
+				p.Consume(lexer.TComma)
+			}
+		}
+		p.Consume(lexer.TCloseBrace)
+		if p.isContextual("from") {
+			p.Step()
+			source := p.moduleSource()
+			exportNamed.Source = &source
+		} else if reserved != nil {
+			p.Error(AstError{reserved.Loc, "Syntax Error: Unexpected reserved word '" + p.Raw(*reserved) + "'"})
+		}
+		data = &exportNamed
+	default:
+		p.Error(AstError{token.Loc, "Syntax Error: unexpected token in export declaration"})
+	}
+
+	p.calcLocFromPrevToken(&loc)
+	return Stmt{loc, data}
+}
+
+//import和export中的名字，可以是关键字(default)或者字符串
+func (p *AstParser) moduleExportName() string {
+	token := p.CurToken()
+	switch {
+	case token.T == lexer.TStringLiteral:
+		return p.primary().Data.(*EStringLiteral).Value
+	case lexer.IsIdentifierName(token.T):
+		return p.Raw(p.Step())
+	default:
+		p.Error(AstError{token.Loc, "Syntax Error: unexpected token " + p.Raw(token)})
+		return ""
+	}
+}
+
+//from后面的模块路径
+func (p *AstParser) moduleSource() string {
+	token := p.CurToken()
+	if token.T != lexer.TStringLiteral {
+		p.Error(AstError{token.Loc, "Syntax Error: expect module specifier, but found " + p.Raw(token)})
+	}
+	return p.primary().Data.(*EStringLiteral).Value
+}
+
+//as和from不是关键字，只在import/export中有特殊含义
+func (p *AstParser) isContextual(name string) bool {
+	return p.Check(lexer.TIdentifier) && p.Raw(p.CurToken()) == name
+}
+
+func (p *AstParser) expectContextual(name string) {
+	if !p.isContextual(name) {
+		token := p.CurToken()
+		p.Error(AstError{token.Loc, "expect " + name + ", but found " + p.Raw(token)})
 	}
+	p.Step()
 }
 
 func (p *AstParser) calcLocFromPrevToken(loc *logger.Loc) {
+	//代码以标识符开头时还没有上一个token
+	if p.Curr == 0 {
+		return
+	}
 	prevLoc := p.Prev().Loc
 	loc.Len = prevLoc.Offset + prevLoc.Len - loc.Offset
 }
@@ -165,15 +494,30 @@ func (p *AstParser) stmt() Stmt {
 	case lexer.TIf:
 		stmt = p.sCondition()
 	case lexer.TBreak, lexer.TContinue:
-		p.Step()
-		if token.T == lexer.TBreak {
-			stmt = Stmt{token.Loc, &SBreak{}}
-		} else {
-			stmt = Stmt{token.Loc, &SContinue{}}
-		}
+		stmt = p.sJump()
 	case lexer.TReturn:
 		stmt = p.sReturn()
+	case lexer.TThrow:
+		stmt = p.sThrow()
+	case lexer.TTry:
+		stmt = p.sTry()
+	case lexer.TWith:
+		if p.inStrict {
+			p.Error(AstError{token.Loc, "Syntax Error: Strict mode code may not include a with statement"})
+		}
+		p.Error(AstError{token.Loc, "Syntax Error: with statement is not supported"})
+	case lexer.TExport:
+		p.Error(AstError{token.Loc, "Syntax Error: 'export' may only appear at the top level of a module"})
+	case lexer.TImport:
+		if p.Peek().T != lexer.TOpenParen {
+			p.Error(AstError{token.Loc, "Syntax Error: 'import' may only appear at the top level of a module"})
+		}
+		fallthrough
 	default:
+		if token.T == lexer.TIdentifier && p.Peek().T == lexer.TColon {
+			stmt = p.sLabeled()
+			break
+		}
 		expr := p.expr()
 		stmt = Stmt{
 			Loc:  expr.Loc,
@@ -204,6 +548,9 @@ func (p *AstParser) sVarDecl() Stmt {
 	}
 
 	varDecl := p.varDecl(EIdentifier{Value: p.Raw(name)}, kind)
+	if kind == VConst && varDecl.Init == nil {
+		p.Error(AstError{name.Loc, "SyntaxError: Missing initializer in const declaration"})
+	}
 	p.calcLocFromPrevToken(&loc)
 	return Stmt{
 		Loc:  loc,
@@ -219,12 +566,13 @@ func (p *AstParser) varDecl(id EIdentifier, kind VarKind) SVarDecl {
 	var init *Expr = nil
 	if p.Check(lexer.TEquals) {
 		p.Step()
-		initExpr := p.expr()
+		initExpr := p.assignment()
 		init = &initExpr
 	}
 
 	return SVarDecl{
 		Id:   id,
+		kind: kind,
 		Init: init,
 	}
 }
@@ -233,9 +581,113 @@ func (p *AstParser) sReturn() Stmt {
 	loc := p.CurToken().Loc
 	p.Consume(lexer.TReturn)
 
+	//return; 和 return } 没有返回值，return后换行时也没有返回值
+	var expr Expr
+	if !p.IsEnd() && !p.Check(lexer.TSemicolon, lexer.TCloseBrace) && p.CurToken().Loc.Line == p.Prev().Loc.Line {
+		expr = p.expr()
+	}
+	p.calcLocFromPrevToken(&loc)
+	tail := p.inStrict && p.inFunction && !p.inGenerator && !p.inAsync && !p.inTry
+	return Stmt{loc, &SReturn{Expr: expr, Tail: tail}}
+}
+
+/*
+break label 或 continue label，标签必须和关键字在同一行
+*/
+func (p *AstParser) sJump() Stmt {
+	token := p.Step()
+	loc := token.Loc
+	label := ""
+	if p.Check(lexer.TIdentifier) && p.CurToken().Loc.Line == token.Loc.Line {
+		label = p.Raw(p.Step())
+	}
+	p.calcLocFromPrevToken(&loc)
+	if token.T == lexer.TBreak {
+		return Stmt{loc, &SBreak{label}}
+	}
+	return Stmt{loc, &SContinue{label}}
+}
+
+/*
+label: stmt
+*/
+func (p *AstParser) sLabeled() Stmt {
+	token := p.Consume(lexer.TIdentifier)
+	loc := token.Loc
+	p.Consume(lexer.TColon)
+	body := p.stmt()
+	p.calcLocFromPrevToken(&loc)
+	return Stmt{loc, &SLabeled{Label: p.Raw(token), Body: &body}}
+}
+
+func (p *AstParser) sThrow() Stmt {
+	loc := p.Consume(lexer.TThrow).Loc
 	expr := p.expr()
 	p.calcLocFromPrevToken(&loc)
-	return Stmt{loc, &SReturn{expr}}
+	return Stmt{loc, &SThrow{expr}}
+}
+
+/*
+try { } catch (e) { } finally { }
+*/
+func (p *AstParser) sTry() Stmt {
+	loc := p.Consume(lexer.TTry).Loc
+	outerTry := p.inTry
+	p.inTry = true
+	defer func() {
+		p.inTry = outerTry
+	}()
+	block := p.body()
+	p.inTry = outerTry
+	try := STry{Block: &block}
+
+	if p.Check(lexer.TCatch) {
+		p.Step()
+		if p.Check(lexer.TOpenParen) {
+			p.Step()
+			param := p.Consume(lexer.TIdentifier)
+			try.Param = &EIdentifier{Value: p.Raw(param)}
+			p.Consume(lexer.TCloseParen)
+		}
+		handler := p.body()
+		try.Handler = &handler
+	}
+	if p.Check(lexer.TFinally) {
+		p.Step()
+		//解析catch时还不知道后面有没有finally，有finally时catch中的return执行完之后还要执行finally
+		if try.Handler != nil {
+			clearTail(try.Handler)
+		}
+		finalizer := p.body()
+		try.Finalizer = &finalizer
+	}
+	if try.Handler == nil && try.Finalizer == nil {
+		p.Error(AstError{loc, "Syntax Error: missing catch or finally after try"})
+	}
+
+	p.calcLocFromPrevToken(&loc)
+	return Stmt{loc, &try}
+}
+
+//去掉块中(不包括其中的函数)return的尾调用标记
+func clearTail(body *SBody) {
+	Inspect(body, func(node Node) bool {
+		switch n := node.(type) {
+		case *Stmt:
+			switch s := n.Data.(type) {
+			case *SReturn:
+				s.Tail = false
+			case *SFunctionDecl, *SClass:
+				return false
+			}
+		case *Expr:
+			switch n.Data.(type) {
+			case *EFunctionExpr, *EArrowFunction:
+				return false
+			}
+		}
+		return true
+	})
 }
 
 /*
@@ -249,9 +701,9 @@ func (p *AstParser) sFuncDecl() Stmt {
 	if p.Check(lexer.TIdentifier) {
 		id = &EIdentifier{Value: p.Raw(p.Step())}
 	} else {
-		id = &EIdentifier{"Annoymous"}
+		id = &EIdentifier{Value: "Annoymous"}
 	}
-	fnDecl := p.funcDecl(id)
+	fnDecl := p.funcDecl(id, false, false)
 
 	p.calcLocFromPrevToken(&loc)
 
@@ -263,12 +715,33 @@ func (p *AstParser) sFuncDecl() Stmt {
 
 /*
 @Params id 函数名
+@Params generator 是否是generator函数 function* gen() { }
+@Params async 是否是async函数 async function f() { }
 解析function add() { }
                ^^^^^^
 */
-func (p *AstParser) funcDecl(id *EIdentifier) SFunctionDecl {
-	loc := p.Consume(lexer.TOpenParen).Loc
-	//函数形参
+func (p *AstParser) funcDecl(id *EIdentifier, generator bool, async bool) SFunctionDecl {
+	loc := p.CurToken().Loc
+	params := p.params()
+	body := p.funcBody(generator, async)
+	if body.Strict {
+		p.checkParams(params, loc)
+	}
+	p.calcLocFromPrevToken(&loc)
+	return SFunctionDecl{
+		Id:        id,
+		Params:    params,
+		Body:      &body,
+		Generator: generator,
+		Async:     async,
+	}
+}
+
+/*
+函数形参 (a, b, c)
+*/
+func (p *AstParser) params() []EIdentifier {
+	p.Consume(lexer.TOpenParen)
 	params := make([]EIdentifier, 0)
 Params:
 	for !p.IsEnd() {
@@ -286,19 +759,41 @@ Params:
 			if p.CurToken().T == lexer.TComma {
 				p.Step()
 			}
+		default:
+			p.Error(AstError{param.Loc, "Syntax Error: unexpected token in parameter list"})
 		}
 	}
 	if p.IsEnd() {
 		p.Error(AstError{p.CurToken().Loc, "missing close parentheses"})
 	}
 	p.Consume(lexer.TCloseParen)
+	return params
+}
 
+/*
+函数体中yield和await是否可用取决于函数本身，和外层函数无关
+严格模式的代码中的函数都是严格模式，函数体也可以用"use strict"单独开启
+*/
+func (p *AstParser) funcBody(generator bool, async bool) SBody {
+	outerGenerator, outerAsync, outerFunction, outerStrict, outerTry := p.inGenerator, p.inAsync, p.inFunction, p.inStrict, p.inTry
+	p.inGenerator, p.inAsync, p.inFunction, p.inTry = generator, async, true, false
+	p.inStrict = p.inStrict || (p.Check(lexer.TOpenBrace) && p.useStrict(p.Curr+1))
+	defer func() {
+		p.inGenerator, p.inAsync, p.inFunction, p.inStrict, p.inTry = outerGenerator, outerAsync, outerFunction, outerStrict, outerTry
+	}()
 	body := p.body()
-	p.calcLocFromPrevToken(&loc)
-	return SFunctionDecl{
-		Id:     id,
-		Params: params,
-		Body:   &body,
+	body.Strict = p.inStrict
+	return body
+}
+
+//严格模式的函数和箭头函数不能有重名的参数
+func (p *AstParser) checkParams(params []EIdentifier, loc logger.Loc) {
+	seen := map[string]bool{}
+	for _, param := range params {
+		if seen[param.Value] {
+			p.Error(AstError{loc, "Syntax Error: Duplicate parameter name not allowed in this context"})
+		}
+		seen[param.Value] = true
 	}
 }
 
@@ -311,13 +806,19 @@ class Child extends Father {
 func (p *AstParser) class() Stmt {
 	loc := p.CurToken().Loc
 	p.Consume(lexer.TClass)
+	//类中的代码都是严格模式
+	outerStrict := p.inStrict
+	p.inStrict = true
+	defer func() {
+		p.inStrict = outerStrict
+	}()
 	id := p.Consume(lexer.TIdentifier)
 	className := lexer.Raw(id.Loc, p.RawSource)
 	var superClass *Expr = nil
 	maybeExtends := p.CurToken()
 	if maybeExtends.T == lexer.TExtends {
 		p.Step()
-		expr := p.expr()
+		expr := p.assignment()
 		superClass = &expr
 	}
 
@@ -330,6 +831,8 @@ ClassFields:
 		switch token.T {
 		case lexer.TCloseBrace:
 			break ClassFields
+		case lexer.TSemicolon:
+			p.Step()
 		case lexer.TIdentifier:
 			memberLoc := token.Loc
 			id := EIdentifier{Value: p.Raw(p.Step())}
@@ -337,7 +840,7 @@ ClassFields:
 			switch parenOrEquals.T {
 			case lexer.TOpenParen:
 				// 类的方法class X { method() { } }
-				fnBody := p.funcDecl(&id)
+				fnBody := p.funcDecl(&id, false, false)
 				//结尾位置 计算整条语句位置
 				endPos := p.Prev().Loc.Offset + p.Prev().Loc.Len
 				memberLoc.Len = endPos - memberLoc.Offset
@@ -370,13 +873,14 @@ ClassFields:
 	}
 
 	p.Consume(lexer.TCloseBrace)
+	p.calcLocFromPrevToken(&loc)
 
 	return Stmt{
 		Loc: loc,
 		Data: &SClass{
 			SuperClass: superClass,
 			Id:         EIdentifier{Value: className},
-			Body:       nil,
+			Body:       classMembers,
 		},
 	}
 }
@@ -407,7 +911,7 @@ func (p *AstParser) block() SBlock {
 	stmts := make([]*Stmt, 0)
 
 	for p.CurToken().T != lexer.TCloseBrace && !p.IsEnd() {
-		stmt := p.stmt()
+		stmt := p.recoverStmt(p.stmt)
 		stmts = append(stmts, &stmt)
 	}
 
@@ -430,12 +934,25 @@ func (p *AstParser) sFor() Stmt {
 	forKeyWord := p.Consume(lexer.TFor)
 	p.Consume(lexer.TOpenParen)
 	loc := forKeyWord.Loc
-	initializer := p.stmt()
+	//stmt()会跳过;后面的另一个;，for(;;)的初始化部分为空时单独处理
+	var initializer Stmt
+	if p.Check(lexer.TSemicolon) {
+		p.Step()
+	} else {
+		initializer = p.stmt()
+	}
 
-	condition := p.expr()
+	//for(;;)没有条件时Data为nil
+	var condition Expr
+	if !p.Check(lexer.TSemicolon) {
+		condition = p.expr()
+	}
 	p.Consume(lexer.TSemicolon)
 
-	reset := p.stmt()
+	var reset Stmt
+	if !p.Check(lexer.TCloseParen) {
+		reset = p.stmt()
+	}
 
 	p.Consume(lexer.TCloseParen)
 	body := p.body()
@@ -498,15 +1015,10 @@ Branch:
 
 /*
 解析表达式优先级由上至下 从小到大
-return
-assignment
-equals
-or(||)
-and(&&)
-compare
-binary
-plusAndMinus(+ or -)
-multiplyAndDivision(* or /)
+sequence(a, b)
+assignment(=和复合赋值 yield 箭头函数)
+conditional(a ? b : c)
+binary(二元运算符，优先级和结合性见binaryPrecedence)
 unary
 call
 memberExpr
@@ -514,7 +1026,45 @@ paren
 primary
 */
 func (p *AstParser) expr() Expr {
-	return p.assignment()
+	loc := p.CurToken().Loc
+	expr := p.assignment()
+	if !p.Check(lexer.TComma) {
+		return expr
+	}
+	exprs := []Expr{expr}
+	for p.Check(lexer.TComma) {
+		p.Step()
+		exprs = append(exprs, p.assignment())
+	}
+	p.calcLocFromPrevToken(&loc)
+	return Expr{Loc: loc, Data: &ESequence{Exprs: exprs}}
+}
+
+//赋值运算符的源代码，Op为0时是=
+func AssignOperator(op EOp) string {
+	if op == 0 {
+		return "="
+	}
+	return lexer.Token2StringMap[lexer.T(op)] + "="
+}
+
+//复合赋值运算符对应的二元运算符
+var compoundAssignment = map[lexer.T]lexer.T{
+	lexer.TPlusEquals:                              lexer.TPlus,
+	lexer.TMinusEquals:                             lexer.TMinus,
+	lexer.TAsteriskEquals:                          lexer.TAsterisk,
+	lexer.TSlashEquals:                             lexer.TSlash,
+	lexer.TPercentEquals:                           lexer.TPercent,
+	lexer.TAsteriskAsteriskEquals:                  lexer.TAsteriskAsterisk,
+	lexer.TLessThanLessThanEquals:                  lexer.TLessThanLessThan,
+	lexer.TGreaterThanGreaterThanEquals:            lexer.TGreaterThanGreaterThan,
+	lexer.TGreaterThanGreaterThanGreaterThanEquals: lexer.TGreaterThanGreaterThanGreaterThan,
+	lexer.TAmpersandEquals:                         lexer.TAmpersand,
+	lexer.TBarEquals:                               lexer.TBar,
+	lexer.TCaretEquals:                             lexer.TCaret,
+	lexer.TAmpersandAmpersandEquals:                lexer.TAmpersandAmpersand,
+	lexer.TBarBarEquals:                            lexer.TBarBar,
+	lexer.TQuestionQuestionEquals:                  lexer.TQuestionQuestion,
 }
 
 func (p *AstParser) assignment() Expr {
@@ -525,9 +1075,17 @@ func (p *AstParser) assignment() Expr {
 		}
 	}
 	loc := p.CurToken().Loc
-	expr := p.equals()
+	if p.inGenerator && p.Check(lexer.TIdentifier) && p.Raw(p.CurToken()) == "yield" {
+		return p.yield()
+	}
+	if p.isArrowAhead() {
+		return p.arrowFunction()
+	}
+	expr := p.conditional()
 
-	if p.Check(lexer.TEquals) {
+	//赋值右结合：a = b += c是a = (b += c)
+	op, isCompound := compoundAssignment[p.CurToken().T]
+	if p.Check(lexer.TEquals) || isCompound {
 		p.Step()
 		assignment := p.assignment()
 		p.calcLocFromPrevToken(&loc)
@@ -535,6 +1093,7 @@ func (p *AstParser) assignment() Expr {
 		expr = Expr{
 			Loc: loc,
 			Data: &EAssign{
+				Op:         EOp(op),
 				Target:     &target,
 				Assignment: &assignment,
 			},
@@ -544,194 +1103,187 @@ func (p *AstParser) assignment() Expr {
 	return expr
 }
 
-/**
-equals -> or (== equals)*
+/*
+yield
+yield value
+yield* iterable
 */
-func (p *AstParser) equals() Expr {
-	expr := p.or()
-Equals:
-	for {
-		token := p.CurToken()
-		switch token.T {
-		case lexer.TEqualsEquals, lexer.TEqualsEqualsEquals:
-			p.Step()
-			equalTarget := p.equals()
-			expr = Expr{
-				Loc: logger.Loc{
-					Offset: expr.Loc.Offset,
-					Len:    expr.Loc.Len + token.Loc.Len + equalTarget.Loc.Len,
-					Line:   expr.Loc.Line,
-				},
-				Data: &EBinary{
-					Op:    EOp(token.T),
-					Left:  expr,
-					Right: equalTarget,
-				},
+func (p *AstParser) yield() Expr {
+	token := p.Step()
+	loc := token.Loc
+	delegate := false
+	if p.Check(lexer.TAsterisk) {
+		p.Step()
+		delegate = true
+	}
+
+	var argument *Expr = nil
+	//yield后面换行或者是表达式的结尾时没有参数
+	hasArgument := delegate || (!p.IsEnd() && p.CurToken().Loc.Line == token.Loc.Line)
+	if hasArgument {
+		switch p.CurToken().T {
+		case lexer.TCloseParen, lexer.TCloseBracket, lexer.TCloseBrace,
+			lexer.TComma, lexer.TSemicolon, lexer.TColon:
+			if delegate {
+				p.Error(AstError{p.CurToken().Loc, "Syntax Error: yield* requires an expression"})
 			}
 		default:
-			break Equals
+			expr := p.assignment()
+			argument = &expr
 		}
 	}
 
-	return expr
+	p.calcLocFromPrevToken(&loc)
+	return Expr{
+		Loc: loc,
+		Data: &EYield{
+			Argument: argument,
+			Delegate: delegate,
+		},
+	}
 }
 
-/**
-or -> and (&& or)*
+/*
+二元运算符的优先级，数字越大优先级越高，同一级的运算符左结合，只有**右结合
+??不能和&&、||直接混用，必须加括号
 */
-func (p *AstParser) or() Expr {
-	expr := p.and()
-Bar:
-	for {
-		token := p.CurToken()
-		loc := token.Loc
-		switch token.T {
-		case lexer.TBarBar:
-			p.Step()
-			andTarget := p.or()
-			p.calcLocFromPrevToken(&loc)
+var binaryPrecedence = map[lexer.T]int{
+	lexer.TQuestionQuestion: 1,
 
-			expr = Expr{
-				Loc: loc,
-				Data: &EBinary{
-					Op:    EOp(lexer.TBarBar),
-					Left:  expr,
-					Right: andTarget,
-				},
-			}
-		default:
-			break Bar
-		}
-	}
-	return expr
+	lexer.TBarBar: 2,
+
+	lexer.TAmpersandAmpersand: 3,
+
+	lexer.TBar: 4,
+
+	lexer.TCaret: 5,
+
+	lexer.TAmpersand: 6,
+
+	lexer.TEqualsEquals:            7,
+	lexer.TExclamationEquals:       7,
+	lexer.TEqualsEqualsEquals:      7,
+	lexer.TExclamationEqualsEquals: 7,
+
+	lexer.TLessThan:          8,
+	lexer.TLessThanEquals:    8,
+	lexer.TGreaterThan:       8,
+	lexer.TGreaterThanEquals: 8,
+	lexer.TInstanceof:        8,
+	lexer.TIn:                8,
+
+	lexer.TLessThanLessThan:                  9,
+	lexer.TGreaterThanGreaterThan:            9,
+	lexer.TGreaterThanGreaterThanGreaterThan: 9,
+
+	lexer.TPlus:  10,
+	lexer.TMinus: 10,
+
+	lexer.TAsterisk: 11,
+	lexer.TSlash:    11,
+	lexer.TPercent:  11,
+
+	lexer.TAsteriskAsterisk: 12,
 }
 
-/**
-and -> compare (&& and)*
+//二元运算符的优先级，不是二元运算符时返回false
+func BinaryPrecedence(op EOp) (int, bool) {
+	precedence, isBinary := binaryPrecedence[lexer.T(op)]
+	return precedence, isBinary
+}
+
+/*
+conditional -> binary (? assignment : assignment)?
 */
-func (p *AstParser) and() Expr {
-	expr := p.compare()
-Ampersand:
-	for {
-		token := p.CurToken()
-		loc := token.Loc
-		switch token.T {
-		case lexer.TAmpersandAmpersand:
-			p.Step()
-			andTarget := p.and()
-			p.calcLocFromPrevToken(&loc)
-			expr = Expr{
-				Loc: loc,
-				Data: &EBinary{
-					Op:    EOp(lexer.TAmpersandAmpersand),
-					Left:  expr,
-					Right: andTarget,
-				},
-			}
-		default:
-			break Ampersand
-		}
+func (p *AstParser) conditional() Expr {
+	loc := p.CurToken().Loc
+	test := p.binary(0)
+	if !p.Check(lexer.TQuestion) {
+		return test
+	}
+	p.Step()
+	consequent := p.assignment()
+	p.Consume(lexer.TColon)
+	alternate := p.assignment()
+	p.calcLocFromPrevToken(&loc)
+	return Expr{
+		Loc: loc,
+		Data: &EConditional{
+			Test:       test,
+			Consequent: consequent,
+			Alternate:  alternate,
+		},
 	}
-	return expr
 }
 
-/**
-compare -> add (>= compare)*
+/*
+优先级爬升：解析优先级不低于minPrecedence的二元表达式
+左结合的运算符右侧只能出现优先级更高的运算符，右结合的**右侧可以出现同一级的运算符
 */
-func (p *AstParser) compare() Expr {
-	expr := p.plusAndMinus()
-	Loc := expr.Loc
-
-Compare:
-	for {
+func (p *AstParser) binary(minPrecedence int) Expr {
+	loc := p.CurToken().Loc
+	left := p.unary()
+	for !p.IsEnd() {
 		token := p.CurToken()
-		switch token.T {
-		case
-			lexer.TLessThan, lexer.TLessThanEquals,
-			lexer.TGreaterThan, lexer.TGreaterThanEquals:
-			p.Step()
-			target := p.compare()
-			Loc.Len += token.Loc.Len + target.Loc.Len
-			expr = Expr{
-				Loc: Loc,
-				Data: &EBinary{
-					Op:    EOp(token.T),
-					Left:  expr,
-					Right: target,
-				},
-			}
-		default:
-			break Compare
+		precedence, isBinary := binaryPrecedence[token.T]
+		if !isBinary || precedence < minPrecedence {
+			break
+		}
+		if token.T == lexer.TAsteriskAsterisk && isUnaryOperand(left) {
+			p.Error(AstError{token.Loc, "Syntax Error: Unary operator used immediately before exponentiation expression. Parenthesis must be used to disambiguate operator precedence"})
+		}
+		p.Step()
+		nextPrecedence := precedence + 1
+		if token.T == lexer.TAsteriskAsterisk {
+			nextPrecedence = precedence
+		}
+		right := p.binary(nextPrecedence)
+		if isMixedCoalesce(token.T, left) || isMixedCoalesce(token.T, right) {
+			p.Error(AstError{token.Loc, "Syntax Error: cannot mix ?? with && or || without parentheses"})
+		}
+		p.calcLocFromPrevToken(&loc)
+		left = Expr{
+			Loc: loc,
+			Data: &EBinary{
+				Op:    EOp(token.T),
+				Left:  left,
+				Right: right,
+			},
 		}
 	}
-
-	return expr
+	return left
 }
 
-/*
-add -> mul (+ add)*
-*/
-func (p *AstParser) plusAndMinus() Expr {
-	token := p.CurToken()
-	loc := token.Loc
-	expr := p.multiplyAndDivision()
-
-Plus:
-	for {
-		nextToken := p.CurToken()
-		switch nextToken.T {
-		case lexer.TPlus, lexer.TMinus:
-			p.Step()
-			right := p.plusAndMinus()
-			p.calcLocFromPrevToken(&loc)
-			expr = Expr{
-				Loc: loc,
-				Data: &EBinary{
-					Op:    EOp(nextToken.T),
-					Left:  expr,
-					Right: right,
-				},
-			}
-		default:
-			break Plus
-		}
+//-a ** b有歧义，**的左边不能是没有括号的一元运算(a++和++a除外)
+func isUnaryOperand(expr Expr) bool {
+	switch e := expr.Data.(type) {
+	case *EUnary:
+		return e.Association == AssociationLeft && e.Op != EOp(lexer.TPlusPlus) && e.Op != EOp(lexer.TMinusMinus)
+	case *EAwait:
+		return true
 	}
-	return expr
+	return false
 }
 
-/**
-multiply -> unary (* multiply)*
-*/
-func (p *AstParser) multiplyAndDivision() Expr {
-	token := p.CurToken()
-	loc := token.Loc
-	expr := p.unary()
-Mul:
-	for {
-		nextToken := p.CurToken()
-		switch nextToken.T {
-		case lexer.TAsterisk, lexer.TSlash, lexer.TPercent:
-			p.Step()
-			right := p.multiplyAndDivision()
-			p.calcLocFromPrevToken(&loc)
-			expr = Expr{
-				Loc: loc,
-				Data: &EBinary{
-					Op:    EOp(nextToken.T),
-					Left:  expr,
-					Right: right,
-				},
-			}
-		default:
-			break Mul
-		}
+//a ?? b || c 和 a || b ?? c 都是语法错误
+func isMixedCoalesce(op lexer.T, operand Expr) bool {
+	binary, isBinary := operand.Data.(*EBinary)
+	if !isBinary {
+		return false
 	}
-	return expr
+	inner := lexer.T(binary.Op)
+	if op == lexer.TQuestionQuestion {
+		return inner == lexer.TBarBar || inner == lexer.TAmpersandAmpersand
+	}
+	if op == lexer.TBarBar || op == lexer.TAmpersandAmpersand {
+		return inner == lexer.TQuestionQuestion
+	}
+	return false
 }
 
 /*
-!a
--a
+!a -a +a ~a
+typeof a / void a / delete a
 ++a
 a++
 */
@@ -740,14 +1292,31 @@ func (p *AstParser) unary() Expr {
 	loc := token.Loc
 	var expr Expr
 
+	if p.inAsync && token.T == lexer.TIdentifier && p.Raw(token) == "await" {
+		if !p.inFunction {
+			p.HasTopLevelAwait = true
+		}
+		p.Step()
+		value := p.unary()
+		p.calcLocFromPrevToken(&loc)
+		return Expr{
+			Loc:  loc,
+			Data: &EAwait{Value: value},
+		}
+	}
+
 	switch token.T {
-	case lexer.TExclamation, lexer.TMinus, lexer.TPlusPlus, lexer.TMinusMinus:
+	case lexer.TExclamation, lexer.TMinus, lexer.TPlus, lexer.TTilde,
+		lexer.TTypeof, lexer.TVoid, lexer.TDelete,
+		lexer.TPlusPlus, lexer.TMinusMinus:
 		p.Step()
+		value := p.unary()
+		p.calcLocFromPrevToken(&loc)
 		expr = Expr{
-			Loc: token.Loc,
+			Loc: loc,
 			Data: &EUnary{
 				Op:    EOp(token.T),
-				Value: p.unary(),
+				Value: value,
 			},
 		}
 	default:
@@ -771,36 +1340,48 @@ func (p *AstParser) unary() Expr {
 	return expr
 }
 
+/*
+callExpr -> (newExpr | paren) (.name | [expr] | (args))*
+a.b(1).c、f()()、a[0][1]都在同一个循环中从左到右嵌套
+*/
 func (p *AstParser) callExpr() Expr {
-	expr := p.memberExpr()
-
-	token := p.CurToken()
-	if token.T == lexer.TOpenParen {
-		p.Step()
-		loc := expr.Loc
-		args := []*Expr{}
-		for !p.IsEnd() && p.CurToken().T != lexer.TCloseParen {
-			arg := p.expr()
-			args = append(args, &arg)
-			if p.Check(lexer.TComma) {
-				p.Step()
-			}
-		}
-		p.Consume(lexer.TCloseParen)
-		p.calcLocFromPrevToken(&loc)
-		expr = Expr{
-			Loc: loc,
-			Data: &ECallExpr{
-				Callee: expr,
-				Args:   args,
-			},
-		}
+	var expr Expr
+	if p.Check(lexer.TNew) {
+		expr = p.newExpr()
+	} else {
+		expr = p.paren()
 	}
+	return p.postfix(expr, true)
+}
 
-	return expr
+/*
+new Callee(args)，没有参数时括号可以省略
+Callee中不能有调用，new a.b(1).c中的a.b是Callee，.c作用于new的结果
+*/
+func (p *AstParser) newExpr() Expr {
+	loc := p.Consume(lexer.TNew).Loc
+	var callee Expr
+	if p.Check(lexer.TNew) {
+		callee = p.newExpr()
+	} else {
+		callee = p.memberExpr()
+	}
+	args := []*Expr{}
+	if p.Check(lexer.TOpenParen) {
+		args = p.arguments()
+	}
+	p.calcLocFromPrevToken(&loc)
+	return Expr{
+		Loc: loc,
+		Data: &ENew{
+			Callee: callee,
+			Args:   args,
+		},
+	}
 }
 
 /*
+memberExpr -> paren (.name | [expr])*
 a.b.c对应
 Obj: EMemberExpr{
 	Obj: 		a,
@@ -809,41 +1390,80 @@ Obj: EMemberExpr{
 Property: c
 */
 func (p *AstParser) memberExpr() Expr {
-	expr := p.paren()
-	token := p.CurToken()
-	if token.T == lexer.TDot {
-		loc := expr.Loc
-		p.Step()
-		property := p.paren()
-		p.calcLocFromPrevToken(&loc)
-		expr = Expr{
-			Loc: loc,
-			Data: &EMemberExpr{
-				Obj:      expr,
-				Property: EIdentifier{property.Data.(*EIdentifier).Value},
-			},
-		}
+	return p.postfix(p.paren(), false)
+}
 
-		for !p.IsEnd() && p.CurToken().T == lexer.TDot {
+/*
+处理表达式后面的.name、[expr]和(args)，每次都把已经解析的部分作为新节点的Obj、Target或Callee
+allowCall为false时遇到(停下，用于new的Callee
+*/
+func (p *AstParser) postfix(expr Expr, allowCall bool) Expr {
+	loc := expr.Loc
+	for !p.IsEnd() {
+		switch p.CurToken().T {
+		case lexer.TDot:
+			p.Step()
+			token := p.CurToken()
+			//属性名可以是关键字，例如obj.default
+			if p.IsEnd() || !lexer.IsIdentifierName(token.T) {
+				p.Error(AstError{token.Loc, "Syntax Error: unexpected token after '.'"})
+			}
 			p.Step()
-			newProperty := p.paren()
-			oldLoc := loc
 			p.calcLocFromPrevToken(&loc)
 			expr = Expr{
 				Loc: loc,
 				Data: &EMemberExpr{
-					Obj: Expr{
-						Loc:  oldLoc,
-						Data: expr.Data,
-					},
-					Property: EIdentifier{newProperty.Data.(*EStringLiteral).Value},
+					Obj:      expr,
+					Property: EIdentifier{Value: p.Raw(token)},
+				},
+			}
+		case lexer.TOpenBracket:
+			p.Step()
+			idx := p.expr()
+			p.Consume(lexer.TCloseBracket)
+			p.calcLocFromPrevToken(&loc)
+			expr = Expr{
+				Loc: loc,
+				Data: &EIndex{
+					Target: expr,
+					Idx:    idx,
+				},
+			}
+		case lexer.TOpenParen:
+			if !allowCall {
+				return expr
+			}
+			args := p.arguments()
+			p.calcLocFromPrevToken(&loc)
+			expr = Expr{
+				Loc: loc,
+				Data: &ECallExpr{
+					Callee: expr,
+					Args:   args,
 				},
 			}
+		default:
+			return expr
 		}
 	}
 	return expr
 }
 
+//(a, b, c)
+func (p *AstParser) arguments() []*Expr {
+	p.Consume(lexer.TOpenParen)
+	args := []*Expr{}
+	for !p.IsEnd() && p.CurToken().T != lexer.TCloseParen {
+		arg := p.assignment()
+		args = append(args, &arg)
+		if !p.Check(lexer.TCloseParen) {
+			p.Consume(lexer.TComma)
+		}
+	}
+	p.Consume(lexer.TCloseParen)
+	return args
+}
+
 func (p *AstParser) paren() Expr {
 	token := p.CurToken()
 	loc := token.Loc
@@ -852,7 +1472,7 @@ func (p *AstParser) paren() Expr {
 	switch token.T {
 	case lexer.TOpenParen:
 		p.Step()
-		value := p.assignment()
+		value := p.expr()
 		p.Consume(lexer.TCloseParen)
 		p.calcLocFromPrevToken(&loc)
 		expr = Expr{
@@ -873,6 +1493,9 @@ func (p *AstParser) primary() Expr {
 	switch token.T {
 	case lexer.TNumericLiteral:
 		name := lexer.Raw(token.Loc, p.RawSource)
+		if p.inStrict && len(name) > 1 && name[0] == '0' && name[1] >= '0' && name[1] <= '9' {
+			p.Error(AstError{loc, "Syntax Error: Octal literals are not allowed in strict mode"})
+		}
 		expr = Expr{
 			Loc:  loc,
 			Data: &ENumericLiteral{Value: name},
@@ -896,87 +1519,45 @@ func (p *AstParser) primary() Expr {
 		} else {
 			p.Error(AstError{token.Loc, "string literal should wrapped in ' or \" "})
 		}
-		p.calcLocFromPrevToken(&loc)
 		expr = Expr{
 			Loc:  loc,
 			Data: &EStringLiteral{Value: name},
 		}
 	case lexer.TIdentifier:
 		name := lexer.Raw(token.Loc, p.RawSource)
-		p.calcLocFromPrevToken(&loc)
+		//async function() { }
+		if name == "async" && p.Peek().T == lexer.TFunction && p.Peek().Loc.Line == token.Loc.Line {
+			p.Step()
+			return p.functionExpr(loc, true)
+		}
 		expr = Expr{
 			Loc:  loc,
 			Data: &EIdentifier{Value: name},
 		}
-	case lexer.TFunction: //Function Expression
-		p.Step()
-		var id *EIdentifier = nil
-		if p.CurToken().T == lexer.TIdentifier {
-			id = &EIdentifier{lexer.Raw(p.CurToken().Loc, p.RawSource)}
-			p.Consume(lexer.TIdentifier)
+	case lexer.TNull:
+		expr = Expr{
+			Loc:  loc,
+			Data: &ENullLiteral{},
 		}
-		sFnDecl := p.funcDecl(id)
-		p.calcLocFromPrevToken(&loc)
-		return Expr{
-			Loc: loc,
-			Data: &EFunctionExpr{
-				Id:     sFnDecl.Id,
-				Params: sFnDecl.Params,
-				Body:   sFnDecl.Body,
-			},
+	case lexer.TThis:
+		expr = Expr{
+			Loc:  loc,
+			Data: &EThis{},
 		}
-	case lexer.TEqualsGreaterThan: //arrow function
-	case lexer.TOpenBrace: //object literal
+	case lexer.TFunction: //Function Expression
+		return p.functionExpr(loc, false)
+	case lexer.TImport: //import(source)
 		p.Step()
-		loc := token.Loc
-		properties := []*Expr{}
-	ObjectLiteral:
-		for !p.IsEnd() {
-			var key Expr
-			var val Expr
-			token := p.CurToken()
-			switch token.T {
-			case lexer.TOpenBracket:
-				p.Step()
-				key = p.expr()
-				p.Consume(lexer.TCloseBracket)
-				p.Consume(lexer.TColon)
-				val = p.expr()
-				if p.CurToken().T == lexer.TComma {
-					p.Consume(lexer.TComma)
-				} else {
-					break ObjectLiteral
-				}
-				properties = append(properties, &key, &val)
-			case lexer.TCloseBrace:
-				break ObjectLiteral
-			case lexer.TIdentifier, lexer.TStringLiteral, lexer.TNumericLiteral:
-				if token.T == lexer.TStringLiteral {
-					key = p.primary()
-				} else {
-					key = Expr{token.Loc, &EStringLiteral{lexer.Raw(token.Loc, p.RawSource)}}
-					p.Step()
-				}
-				p.Consume(lexer.TColon)
-				val = p.expr()
-				properties = append(properties, &key, &val)
-				if p.CurToken().T == lexer.TComma {
-					p.Consume(lexer.TComma)
-				} else {
-					break ObjectLiteral
-				}
-			}
-		}
-		p.Consume(lexer.TCloseBrace)
+		p.Consume(lexer.TOpenParen)
+		source := p.assignment()
+		p.Consume(lexer.TCloseParen)
 		p.calcLocFromPrevToken(&loc)
 		return Expr{
-			Loc: loc,
-			Data: &EObjectLiteral{
-				Proto:       nil,
-				Constructor: nil,
-				Properties:  properties,
-			},
+			Loc:  loc,
+			Data: &EImportCall{Source: source},
 		}
+	case lexer.TOpenBrace: //object literal
+		return p.objectLiteral()
 	case lexer.TOpenBracket: // array literal
 		p.Step()
 		// [(expr(,)?)*]
@@ -992,7 +1573,7 @@ func (p *AstParser) primary() Expr {
 			case lexer.TCloseBracket:
 				break Array
 			default:
-				expr := p.expr()
+				expr := p.assignment()
 				length++
 				arr = append(arr, &expr)
 			}
@@ -1006,28 +1587,288 @@ func (p *AstParser) primary() Expr {
 				Length: length,
 			},
 		}
+	case lexer.TSyntaxError:
+		//词法分析已经报告过这个错误
+		p.Step()
+		p.Error(AstError{token.Loc, "unexpected word"})
 	default:
 		p.Step()
 		p.Error(AstError{token.Loc, "unexpected token"})
 	}
 	p.Step()
 
-	curToken := p.CurToken()
+	return expr
+}
+
+/*
+{ a: 1, 'b': 2, 3: 4, [key]: 5, c, m() {}, get x() {}, set x(v) {}, __proto__: p }
+*/
+func (p *AstParser) objectLiteral() Expr {
+	loc := p.Consume(lexer.TOpenBrace).Loc
+	properties := []Property{}
+	hasProto := false
+	for !p.IsEnd() && !p.Check(lexer.TCloseBrace) {
+		property := p.property()
+		if property.Kind == PropertyProto {
+			if hasProto {
+				p.Error(AstError{property.Loc, "Syntax Error: duplicate __proto__ fields are not allowed in object literals"})
+			}
+			hasProto = true
+		}
+		properties = append(properties, property)
+		if !p.Check(lexer.TCloseBrace) {
+			p.Consume(lexer.TComma)
+		}
+	}
+	p.Consume(lexer.TCloseBrace)
+	p.calcLocFromPrevToken(&loc)
+	return Expr{
+		Loc:  loc,
+		Data: &EObjectLiteral{Properties: properties},
+	}
+}
+
+func (p *AstParser) property() Property {
+	token := p.CurToken()
+	loc := token.Loc
+	kind := PropertyInit
+
+	// async m() {}，async后面不是属性名时只是普通的属性名
+	async := false
+	if token.T == lexer.TIdentifier && p.Raw(token) == "async" {
+		switch p.Peek().T {
+		case lexer.TOpenParen, lexer.TColon, lexer.TComma, lexer.TCloseBrace, lexer.TEndOfFile:
+		default:
+			if p.Peek().T == lexer.TAsterisk {
+				p.Error(AstError{p.Peek().Loc, "Syntax Error: async generators are not supported"})
+			}
+			p.Step()
+			async = true
+			kind = PropertyMethod
+			token = p.CurToken()
+		}
+	}
 
-	//a[0]
-	if curToken.T == lexer.TOpenBracket {
+	// *gen() {}
+	if token.T == lexer.TAsterisk {
 		p.Step()
-		idx := p.expr()
-		p.Consume(lexer.TCloseBracket)
+		key, computed := p.propertyKey()
+		property := Property{Kind: PropertyMethod, Key: key, Computed: computed}
+		property.Value = p.method(key, computed, true, false)
 		p.calcLocFromPrevToken(&loc)
-		expr = Expr{
-			Loc: loc,
-			Data: &EIndex{
-				Target: expr,
-				Idx:    idx,
-			},
+		property.Loc = loc
+		return property
+	}
+
+	//get x() {} 和 set x(v) {}，get和set后面不是属性名时只是普通的属性名
+	if !async && token.T == lexer.TIdentifier && (p.Raw(token) == "get" || p.Raw(token) == "set") {
+		switch p.Peek().T {
+		case lexer.TOpenParen, lexer.TColon, lexer.TComma, lexer.TCloseBrace, lexer.TEndOfFile:
+		default:
+			p.Step()
+			if p.Raw(token) == "get" {
+				kind = PropertyGet
+			} else {
+				kind = PropertySet
+			}
 		}
 	}
 
-	return expr
+	keyToken := p.CurToken()
+	key, computed := p.propertyKey()
+	property := Property{Kind: kind, Key: key, Computed: computed}
+
+	switch {
+	case kind == PropertyGet || kind == PropertySet:
+		fn := p.method(key, computed, false, async)
+		params := fn.Data.(*EFunctionExpr).Params
+		if kind == PropertyGet && len(params) != 0 {
+			p.Error(AstError{fn.Loc, "Syntax Error: getter must not have any formal parameters"})
+		}
+		if kind == PropertySet && len(params) != 1 {
+			p.Error(AstError{fn.Loc, "Syntax Error: setter must have exactly one formal parameter"})
+		}
+		property.Value = fn
+	case p.Check(lexer.TOpenParen):
+		property.Kind = PropertyMethod
+		property.Value = p.method(key, computed, false, async)
+	case p.Check(lexer.TColon):
+		p.Step()
+		property.Value = p.assignment()
+		if !computed {
+			if str, ok := key.Data.(*EStringLiteral); ok && str.Value == "__proto__" {
+				property.Kind = PropertyProto
+			}
+		}
+	default:
+		// { a, b } 简写，只允许标识符
+		if computed || keyToken.T != lexer.TIdentifier {
+			p.Error(AstError{keyToken.Loc, "Syntax Error: unexpected token in object literal"})
+		}
+		property.Shorthand = true
+		property.Value = Expr{keyToken.Loc, &EIdentifier{Value: p.Raw(keyToken)}}
+	}
+
+	p.calcLocFromPrevToken(&loc)
+	property.Loc = loc
+	return property
+}
+
+/*
+属性名: 标识符(包括关键字)、字符串、数字或[计算属性]
+*/
+func (p *AstParser) propertyKey() (Expr, bool) {
+	token := p.CurToken()
+	switch {
+	case token.T == lexer.TOpenBracket:
+		p.Step()
+		key := p.expr()
+		p.Consume(lexer.TCloseBracket)
+		return key, true
+	case token.T == lexer.TStringLiteral, token.T == lexer.TNumericLiteral:
+		//数字和字面量一样，严格模式下不能是八进制
+		return p.primary(), false
+	case lexer.IsIdentifierName(token.T):
+		p.Step()
+		return Expr{token.Loc, &EStringLiteral{Value: p.Raw(token)}}, false
+	default:
+		p.Error(AstError{token.Loc, "Syntax Error: unexpected token in object literal"})
+		return Expr{}, false
+	}
+}
+
+/*
+对象中的方法 m() {}，假设属性名已经被消耗掉了
+*/
+func (p *AstParser) method(key Expr, computed bool, generator bool, async bool) Expr {
+	loc := p.CurToken().Loc
+	var id *EIdentifier = nil
+	if str, ok := key.Data.(*EStringLiteral); ok && !computed {
+		id = &EIdentifier{Value: str.Value}
+	}
+	fnDecl := p.funcDecl(id, generator, async)
+	p.calcLocFromPrevToken(&loc)
+	return Expr{
+		Loc: loc,
+		Data: &EFunctionExpr{
+			Id:        fnDecl.Id,
+			Params:    fnDecl.Params,
+			Body:      fnDecl.Body,
+			Generator: fnDecl.Generator,
+			Async:     fnDecl.Async,
+		},
+	}
+}
+
+/*
+function name() { } 或 function* name() { }，loc是function(或async)的位置
+*/
+func (p *AstParser) functionExpr(loc logger.Loc, async bool) Expr {
+	p.Consume(lexer.TFunction)
+	generator := false
+	if p.Check(lexer.TAsterisk) {
+		if async {
+			p.Error(AstError{p.CurToken().Loc, "Syntax Error: async generators are not supported"})
+		}
+		p.Step()
+		generator = true
+	}
+	var id *EIdentifier = nil
+	if p.CurToken().T == lexer.TIdentifier {
+		id = &EIdentifier{Value: lexer.Raw(p.CurToken().Loc, p.RawSource)}
+		p.Consume(lexer.TIdentifier)
+	}
+	sFnDecl := p.funcDecl(id, generator, async)
+	p.calcLocFromPrevToken(&loc)
+	return Expr{
+		Loc: loc,
+		Data: &EFunctionExpr{
+			Id:        sFnDecl.Id,
+			Params:    sFnDecl.Params,
+			Body:      sFnDecl.Body,
+			Generator: sFnDecl.Generator,
+			Async:     sFnDecl.Async,
+		},
+	}
+}
+
+/*
+判断从当前位置开始是不是箭头函数：x =>、(a, b) =>、async x =>、async (a) =>
+*/
+func (p *AstParser) isArrowAhead() bool {
+	i := p.Curr
+	if i < len(p.Tokens) && p.Tokens[i].T == lexer.TIdentifier && p.Raw(p.Tokens[i]) == "async" &&
+		i+1 < len(p.Tokens) && p.Tokens[i+1].Loc.Line == p.Tokens[i].Loc.Line &&
+		(p.Tokens[i+1].T == lexer.TIdentifier || p.Tokens[i+1].T == lexer.TOpenParen) {
+		i++
+	}
+	if i >= len(p.Tokens) {
+		return false
+	}
+	switch p.Tokens[i].T {
+	case lexer.TIdentifier:
+		i++
+	case lexer.TOpenParen:
+		//找到匹配的右括号
+		depth := 0
+		for ; i < len(p.Tokens); i++ {
+			if p.Tokens[i].T == lexer.TOpenParen {
+				depth++
+			} else if p.Tokens[i].T == lexer.TCloseParen {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		i++
+	default:
+		return false
+	}
+	return i < len(p.Tokens) && p.Tokens[i].T == lexer.TEqualsGreaterThan
+}
+
+/*
+(a, b) => a + b
+async x => { }
+*/
+func (p *AstParser) arrowFunction() Expr {
+	loc := p.CurToken().Loc
+	async := false
+	if p.Raw(p.CurToken()) == "async" && p.Peek().T != lexer.TEqualsGreaterThan {
+		p.Step()
+		async = true
+	}
+
+	var params []EIdentifier
+	if p.Check(lexer.TIdentifier) {
+		params = []EIdentifier{{Value: p.Raw(p.Step())}}
+	} else {
+		params = p.params()
+	}
+	p.Consume(lexer.TEqualsGreaterThan)
+	p.checkParams(params, loc)
+
+	arrow := EArrowFunction{Params: params, Async: async}
+	if p.Check(lexer.TOpenBrace) {
+		body := p.funcBody(false, async)
+		arrow.Body = &body
+	} else {
+		//箭头函数体是表达式时，相当于 { return expr }
+		outerGenerator, outerAsync, outerFunction := p.inGenerator, p.inAsync, p.inFunction
+		p.inGenerator, p.inAsync, p.inFunction = false, async, true
+		expr := p.assignment()
+		p.inGenerator, p.inAsync, p.inFunction = outerGenerator, outerAsync, outerFunction
+		arrow.Expression = true
+		arrow.Body = &SBody{
+			Loc:    expr.Loc,
+			Strict: p.inStrict,
+			Data: &SBlock{Data: []*Stmt{
+				{Loc: expr.Loc, Data: &SReturn{Expr: expr, Tail: p.inStrict && !async}},
+			}},
+		}
+	}
+
+	p.calcLocFromPrevToken(&loc)
+	return Expr{Loc: loc, Data: &arrow}
 }
@@ -0,0 +1,286 @@
+package ast_parser
+
+import (
+	"fmt"
+	"jsInterpreter/lexer"
+	"jsInterpreter/logger"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseRecovery(t *testing.T) {
+	p := NewParser("let a = ;\nlet b = 2\nif (b) { let c = 1 +; let d = 3 }\nlet e = )\n")
+	ast, diagnostics := p.Parse()
+	if len(diagnostics) != 3 {
+		t.Errorf("expected 3 diagnostics, got %d", len(diagnostics))
+	}
+	body := ast.Data.(*SProgram).Body
+	if len(body) != 4 {
+		t.Fatalf("expected 4 statements, got %d", len(body))
+	}
+	if _, isErr := body[0].Data.(*SError); !isErr {
+		t.Error("first statement should be an error node")
+	}
+	if _, isDecl := body[1].Data.(*SVarDecl); !isDecl {
+		t.Error("second statement should be parsed")
+	}
+	if _, isCond := body[2].Data.(*SCondition); !isCond {
+		t.Error("if statement should be parsed")
+	}
+}
+
+//无法识别的字符只在词法分析时报告一次，语法分析跳过它所在的语句
+func Test_ParseLexerError(t *testing.T) {
+	p := NewParser("let a = 1\nlet b = #\nlet c = 3 @ 4\nlet d = 5")
+	ast, diagnostics := p.Parse()
+	expected := []logger.Diagnostic{
+		{Kind: logger.LError, Loc: logger.Loc{Offset: 18, Len: 1, Line: 2}, Msg: "unexpected word"},
+		{Kind: logger.LError, Loc: logger.Loc{Offset: 30, Len: 1, Line: 3}, Msg: "unexpected word"},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("expected diagnostics %v, got %v", expected, diagnostics)
+	}
+	body := ast.Data.(*SProgram).Body
+	kinds := []string{}
+	for _, stmt := range body {
+		kinds = append(kinds, fmt.Sprintf("%T", stmt.Data))
+		if stmt.Loc.Len < 0 {
+			t.Errorf("negative length at %v", stmt.Loc)
+		}
+	}
+	expectedKinds := "*ast_parser.SVarDecl *ast_parser.SError *ast_parser.SVarDecl *ast_parser.SError *ast_parser.SVarDecl"
+	if strings.Join(kinds, " ") != expectedKinds {
+		t.Fatalf("expected %s, got %s", expectedKinds, strings.Join(kinds, " "))
+	}
+	if name := body[4].Data.(*SVarDecl).Id.Value; name != "d" {
+		t.Errorf("expected the last declaration to be d, got %s", name)
+	}
+}
+
+//把表达式按照语法树加上括号，用来比较解析结果
+func parenthesize(expr Expr) string {
+	switch e := expr.Data.(type) {
+	case *EBinary:
+		return "(" + parenthesize(e.Left) + " " + lexer.Token2StringMap[lexer.T(e.Op)] + " " + parenthesize(e.Right) + ")"
+	case *EUnary:
+		if e.Association == AssociationRight {
+			return "(" + parenthesize(e.Value) + lexer.Token2StringMap[lexer.T(e.Op)] + ")"
+		}
+		return "(" + lexer.Token2StringMap[lexer.T(e.Op)] + " " + parenthesize(e.Value) + ")"
+	case *EConditional:
+		return "(" + parenthesize(e.Test) + " ? " + parenthesize(e.Consequent) + " : " + parenthesize(e.Alternate) + ")"
+	case *EAssign:
+		return "(" + parenthesize(*e.Target) + " " + AssignOperator(e.Op) + " " + parenthesize(*e.Assignment) + ")"
+	case *ESequence:
+		exprs := []string{}
+		for _, expr := range e.Exprs {
+			exprs = append(exprs, parenthesize(expr))
+		}
+		return "(" + strings.Join(exprs, ", ") + ")"
+	case *EParen:
+		return parenthesize(e.Data)
+	case *EMemberExpr:
+		return parenthesize(e.Obj) + "." + e.Property.Value
+	case *EIndex:
+		return parenthesize(e.Target) + "[" + parenthesize(e.Idx) + "]"
+	case *ECallExpr:
+		args := []string{}
+		for _, arg := range e.Args {
+			args = append(args, parenthesize(*arg))
+		}
+		return "{" + parenthesize(e.Callee) + "(" + strings.Join(args, ", ") + ")}"
+	case *ENew:
+		args := []string{}
+		for _, arg := range e.Args {
+			args = append(args, parenthesize(*arg))
+		}
+		return "{new " + parenthesize(e.Callee) + "(" + strings.Join(args, ", ") + ")}"
+	case *EIdentifier:
+		return e.Value
+	case *ENumericLiteral:
+		return e.Value
+	default:
+		return "?"
+	}
+}
+
+func parseExpr(code string) (Expr, []logger.Diagnostic) {
+	p := NewParser(code)
+	ast, diagnostics := p.Parse()
+	body := ast.Data.(*SProgram).Body
+	if len(body) == 0 {
+		return Expr{}, diagnostics
+	}
+	if stmt, isExpr := body[0].Data.(*SExpr); isExpr {
+		return stmt.Expr, diagnostics
+	}
+	return Expr{}, diagnostics
+}
+
+func Test_ParsePrecedence(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"10 - 3 - 2", "((10 - 3) - 2)"},
+		{"a / b * c % d", "(((a / b) * c) % d)"},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"a == b || c == d && e", "((a == b) || ((c == d) && e))"},
+		{"a || b && c | d ^ e & f", "(a || (b && (c | (d ^ (e & f)))))"},
+		{"a === b < c", "(a === (b < c))"},
+		{"a < b == c > d", "((a < b) == (c > d))"},
+		{"a << 1 + 2 < b >>> 3", "((a << (1 + 2)) < (b >>> 3))"},
+		{"a instanceof b in c", "((a instanceof b) in c)"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"(-a) ** b", "((- a) ** b)"},
+		{"a ** -b", "(a ** (- b))"},
+		{"a++ ** 2", "((a++) ** 2)"},
+		{"!a && typeof b == c", "((! a) && ((typeof b) == c))"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"(a || b) ?? c", "((a || b) ?? c)"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a || b ? c + 1 : d", "((a || b) ? (c + 1) : d)"},
+		{"a = b = c ? d : e", "(a = (b = (c ? d : e)))"},
+		{"a += b -= c * 2", "(a += (b -= (c * 2)))"},
+		{"a.b **= c || d", "(a.b **= (c || d))"},
+		{"a ??= b ? c : d", "(a ??= (b ? c : d))"},
+		{"a, b = 1, c", "(a, (b = 1), c)"},
+		{"(1, 2) + 3", "((1, 2) + 3)"},
+		{"f((a, b), c)", "{f((a, b), c)}"},
+	}
+	for _, test := range tests {
+		expr, diagnostics := parseExpr(test.code)
+		if len(diagnostics) > 0 {
+			t.Errorf("%s: unexpected error %s", test.code, diagnostics[0].Msg)
+			continue
+		}
+		if got := parenthesize(expr); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.code, test.want, got)
+		}
+	}
+}
+
+func Test_ParsePrecedenceErrors(t *testing.T) {
+	for _, code := range []string{"-a ** b", "typeof a ** b", "-a.b ** 2 + c[0]", "a ?? b || c", "a && b ?? c"} {
+		if _, diagnostics := parseExpr(code); len(diagnostics) == 0 {
+			t.Errorf("%s: expected a syntax error", code)
+		}
+	}
+}
+
+func Test_ParsePostfix(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"a.b(1).c", "{a.b(1)}.c"},
+		{"f()()", "{{f()}()}"},
+		{"a[0][1]", "a[0][1]"},
+		{"obj.list[2].name", "obj.list[2].name"},
+		{"obj.default.if", "obj.default.if"},
+		{"a.b(c.d, e[0])[f]()", "{{a.b(c.d, e[0])}[f]()}"},
+		{"new a.B(1).c", "{new a.B(1)}.c"},
+		{"new F()()", "{{new F()}()}"},
+		{"a.b + c.d * e()", "(a.b + (c.d * {e()}))"},
+	}
+	for _, test := range tests {
+		expr, diagnostics := parseExpr(test.code)
+		if len(diagnostics) > 0 {
+			t.Errorf("%s: unexpected error %s", test.code, diagnostics[0].Msg)
+			continue
+		}
+		if got := parenthesize(expr); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.code, test.want, got)
+		}
+	}
+
+	//每一层的位置都从表达式开头到这一层的结尾
+	code := "x = a.b(1).c"
+	expr, _ := parseExpr(code)
+	member := expr.Data.(*EAssign).Assignment
+	call := member.Data.(*EMemberExpr).Obj
+	if raw := lexer.Raw(member.Loc, code); raw != "a.b(1).c" {
+		t.Errorf("member location: got %q", raw)
+	}
+	if raw := lexer.Raw(call.Loc, code); raw != "a.b(1)" {
+		t.Errorf("call location: got %q", raw)
+	}
+}
+
+func Test_ParseStrict(t *testing.T) {
+	strict := map[string]bool{
+		"'use strict'; a":               true,
+		"\"use strict\"\na":             true,
+		"'a'; 'use strict'; b":          true,
+		"a; 'use strict'":               false,
+		"'use strict' + a":              false,
+		"'use\\x20strict'; a":           false,
+		"function f() { 'use strict' }": false,
+	}
+	for code, expected := range strict {
+		p := NewParser(code)
+		ast, diagnostics := p.Parse()
+		if len(diagnostics) > 0 {
+			t.Errorf("%s: unexpected error %s", code, diagnostics[0].Msg)
+		} else if ast.Data.(*SProgram).Strict != expected {
+			t.Errorf("%s: expected strict to be %v", code, expected)
+		}
+	}
+
+	p := NewParser("function f() { 'use strict'; return () => 1 }\nfunction g() { }\nclass A { m() { } }")
+	ast, _ := p.Parse()
+	body := ast.Data.(*SProgram).Body
+	f := body[0].Data.(*SExpr).Data.(*EFunctionExpr)
+	arrow := f.Body.Data.Data[1].Data.(*SReturn).Data.(*EArrowFunction)
+	g := body[1].Data.(*SExpr).Data.(*EFunctionExpr)
+	method := body[2].Data.(*SClass).Body[0].Value.(*SFunctionDecl)
+	if !f.Body.Strict || !arrow.Body.Strict || g.Body.Strict || !method.Body.Strict {
+		t.Errorf("strict: f %v, arrow %v, g %v, method %v", f.Body.Strict, arrow.Body.Strict, g.Body.Strict, method.Body.Strict)
+	}
+
+	errors := []string{
+		"'use strict'; let a = 010",
+		"'use strict'; function f(a, a) { }",
+		"function f(a, a) { 'use strict' }",
+		"let f = (a, a) => a",
+		"'use strict'; with (a) { }",
+		"class A { m() { return 07 } }",
+		"'use strict'; ({ 010: 1 })",
+		"'use strict'; ({ 010() { } })",
+		"class A { 010() { } }",
+	}
+	for _, code := range errors {
+		p := NewParser(code)
+		if _, diagnostics := p.Parse(); len(diagnostics) == 0 {
+			t.Errorf("%s: expected a syntax error", code)
+		}
+	}
+	p = NewParser("let a = 010; function f(a, a) { }\nlet o = { 010: 1, 1.5: 2 }")
+	if _, diagnostics := p.Parse(); len(diagnostics) > 0 {
+		t.Errorf("sloppy code: unexpected error %s", diagnostics[0].Msg)
+	}
+	p = NewParser("let a = 010")
+	p.IsModule = true
+	if _, diagnostics := p.Parse(); len(diagnostics) == 0 {
+		t.Error("modules are strict")
+	}
+}
+
+func Test_ParseConstInitializer(t *testing.T) {
+	p := NewParser("const a = 1\nconst c\nlet b\nexport const d")
+	p.IsModule = true
+	_, diagnostics := p.Parse()
+	expected := []logger.Diagnostic{
+		{Kind: logger.LError, Loc: logger.Loc{Offset: 18, Len: 1, Line: 2}, Msg: "SyntaxError: Missing initializer in const declaration"},
+		{Kind: logger.LError, Loc: logger.Loc{Offset: 39, Len: 1, Line: 4}, Msg: "SyntaxError: Missing initializer in const declaration"},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("expected %v, got %v", expected, diagnostics)
+	}
+	p = NewParser("for (const i = 0; i < 1; ) { }\nclass A { x }")
+	if _, diagnostics := p.Parse(); len(diagnostics) > 0 {
+		t.Errorf("unexpected error %s", diagnostics[0].Msg)
+	}
+}
@@ -0,0 +1,269 @@
+package ast_parser
+
+/*
+语法树中可以被访问的节点:
+*Stmt、*Expr、*SBody、*Branch、*ClassMember、*Property、*EIdentifier(声明的名字、类成员名、a.b中的属性名和函数参数)
+*/
+type Node interface{}
+
+/*
+和go/ast一样，Walk对每个节点调用Visit，返回的visitor不为nil时用它访问子节点，
+访问完子节点后再调用一次Visit(nil)
+*/
+type NodeVisitor interface {
+	Visit(node Node) (w NodeVisitor)
+}
+
+func Walk(v NodeVisitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	eachChild(node, func(child Node) {
+		Walk(v, child)
+	})
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) NodeVisitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/*
+深度优先遍历，f返回false时跳过这个节点的子节点
+访问完一个节点的子节点后会调用f(nil)
+*/
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+/*
+重写语法树：后序遍历，子节点重写完后再对节点本身调用Stmt或Expr，
+返回值会直接替换原来的节点，不需要替换时返回原节点。为nil的函数不会被调用
+*/
+type Rewriter struct {
+	Stmt func(stmt *Stmt) Stmt
+	Expr func(expr *Expr) Expr
+}
+
+func Rewrite(node Node, r Rewriter) {
+	eachChild(node, func(child Node) {
+		Rewrite(child, r)
+	})
+	switch n := node.(type) {
+	case *Stmt:
+		if r.Stmt != nil {
+			*n = r.Stmt(n)
+		}
+	case *Expr:
+		if r.Expr != nil {
+			*n = r.Expr(n)
+		}
+	}
+}
+
+//按照代码中出现的顺序对每个直接子节点调用fn，子节点都是指向原来位置的指针，可以直接修改
+func eachChild(node Node, fn func(Node)) {
+	switch n := node.(type) {
+	case *Stmt:
+		if n != nil {
+			eachStmtChild(n.Data, fn)
+		}
+	case *Expr:
+		if n != nil {
+			eachExprChild(n.Data, fn)
+		}
+	case *SBody:
+		if n != nil && n.Data != nil {
+			eachStmt(n.Data.Data, fn)
+		}
+	case *Branch:
+		if n.Condition != nil {
+			fn(n.Condition)
+		}
+		fn(n.Body)
+	case *ClassMember:
+		//成员的值中的Id和Key是同一个名字，只访问一次
+		fn(&n.Key)
+		switch value := n.Value.(type) {
+		case *SFunctionDecl:
+			eachParam(value.Params, fn)
+			fn(value.Body)
+		case *SVarDecl:
+			if value.Init != nil {
+				fn(value.Init)
+			}
+		}
+	case *Property:
+		fn(&n.Key)
+		fn(&n.Value)
+	}
+}
+
+func eachStmt(stmts []*Stmt, fn func(Node)) {
+	for _, stmt := range stmts {
+		fn(stmt)
+	}
+}
+
+func eachParam(params []EIdentifier, fn func(Node)) {
+	for i := range params {
+		fn(&params[i])
+	}
+}
+
+//Expr的Data为nil时表示没有这个部分，例如return;和for(;;)
+func optionalExpr(expr *Expr, fn func(Node)) {
+	if expr != nil && expr.Data != nil {
+		fn(expr)
+	}
+}
+
+func optionalStmt(stmt *Stmt, fn func(Node)) {
+	if stmt != nil && stmt.Data != nil {
+		fn(stmt)
+	}
+}
+
+func eachStmtChild(data S, fn func(Node)) {
+	switch s := data.(type) {
+	case *SProgram:
+		eachStmt(s.Body, fn)
+	case *SBlock:
+		eachStmt(s.Data, fn)
+	case *SBody:
+		eachChild(s, fn)
+	case *SVarDecl:
+		fn(&s.Id)
+		if s.Init != nil {
+			fn(s.Init)
+		}
+	case *SExpr:
+		fn(&s.Expr)
+	case *SFor:
+		optionalStmt(s.Initializer, fn)
+		optionalExpr(s.Condition, fn)
+		optionalStmt(s.Reset, fn)
+		fn(s.Body)
+	case *SLabeled:
+		fn(s.Body)
+	case *SWhile:
+		fn(&s.Condition)
+		fn(&s.Body)
+	case *SCondition:
+		for i := range s.Branches {
+			fn(&s.Branches[i])
+		}
+	case *SFunctionDecl:
+		if s.Id != nil {
+			fn(s.Id)
+		}
+		eachParam(s.Params, fn)
+		fn(s.Body)
+	case *SReturn:
+		optionalExpr(&s.Expr, fn)
+	case *SThrow:
+		fn(&s.Expr)
+	case *STry:
+		fn(s.Block)
+		if s.Param != nil {
+			fn(s.Param)
+		}
+		if s.Handler != nil {
+			fn(s.Handler)
+		}
+		if s.Finalizer != nil {
+			fn(s.Finalizer)
+		}
+	case *SClass:
+		fn(&s.Id)
+		if s.SuperClass != nil {
+			fn(s.SuperClass)
+		}
+		for i := range s.Body {
+			fn(&s.Body[i])
+		}
+	case *SImport:
+		if s.Default != nil {
+			fn(s.Default)
+		}
+		if s.Namespace != nil {
+			fn(s.Namespace)
+		}
+		for i := range s.Specifiers {
+			fn(&s.Specifiers[i].Local)
+		}
+	case *SExportDecl:
+		fn(s.Decl)
+	case *SExportDefault:
+		fn(&s.Expr)
+	}
+}
+
+func eachExprChild(data E, fn func(Node)) {
+	switch e := data.(type) {
+	case *EAssign:
+		fn(e.Target)
+		fn(e.Assignment)
+	case *ESequence:
+		for i := range e.Exprs {
+			fn(&e.Exprs[i])
+		}
+	case *EBinary:
+		fn(&e.Left)
+		fn(&e.Right)
+	case *EConditional:
+		fn(&e.Test)
+		fn(&e.Consequent)
+		fn(&e.Alternate)
+	case *EUnary:
+		fn(&e.Value)
+	case *EIndex:
+		fn(&e.Target)
+		fn(&e.Idx)
+	case *EMemberExpr:
+		fn(&e.Obj)
+		fn(&e.Property)
+	case *EParen:
+		fn(&e.Data)
+	case *EArrowFunction:
+		eachParam(e.Params, fn)
+		fn(e.Body)
+	case *EFunctionExpr:
+		if e.Id != nil {
+			fn(e.Id)
+		}
+		eachParam(e.Params, fn)
+		fn(e.Body)
+	case *EAwait:
+		fn(&e.Value)
+	case *EImportCall:
+		fn(&e.Source)
+	case *ENew:
+		fn(&e.Callee)
+		for _, arg := range e.Args {
+			fn(arg)
+		}
+	case *EYield:
+		if e.Argument != nil {
+			fn(e.Argument)
+		}
+	case *ECallExpr:
+		fn(&e.Callee)
+		for _, arg := range e.Args {
+			fn(arg)
+		}
+	case *EArrayLiteral:
+		for _, item := range e.Arr {
+			fn(item)
+		}
+	case *EObjectLiteral:
+		for i := range e.Properties {
+			fn(&e.Properties[i])
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ast_parser
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func Test_Inspect(t *testing.T) {
+	code := `
+class A extends B { x = c; m(p) { return p ? d : e } }
+function f(q) { if (g) { h() } else { i[j] } }
+try { k } catch (err) { l }
+let o = { n: ({ z: 1 }).z, [s]: -t }
+`
+	p := NewParser(code)
+	ast, diagnostics := p.Parse()
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	var names []string
+	Inspect(&ast, func(node Node) bool {
+		if id, isId := node.(*EIdentifier); isId {
+			names = append(names, id.Value)
+		}
+		if expr, isExpr := node.(*Expr); isExpr {
+			if id, isId := expr.Data.(*EIdentifier); isId {
+				names = append(names, id.Value)
+			}
+		}
+		return true
+	})
+	sort.Strings(names)
+	expected := "A B c d e err f g h i j k l m o p p q s t x z"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	//返回false时不访问子节点
+	count := 0
+	Inspect(&ast, func(node Node) bool {
+		if node != nil {
+			count++
+		}
+		_, isClass := node.(*ClassMember)
+		return !isClass
+	})
+	total := 0
+	Inspect(&ast, func(node Node) bool {
+		if node != nil {
+			total++
+		}
+		return true
+	})
+	if count >= total {
+		t.Errorf("class members should be skipped, %d >= %d", count, total)
+	}
+}
+
+func Test_Rewrite(t *testing.T) {
+	p := NewParser("let a = b + (c + 1); f(b)")
+	ast, _ := p.Parse()
+	Rewrite(&ast, Rewriter{
+		Expr: func(expr *Expr) Expr {
+			if id, isId := expr.Data.(*EIdentifier); isId && id.Value == "b" {
+				return Expr{Loc: expr.Loc, Data: &ENumericLiteral{Value: "2"}}
+			}
+			return *expr
+		},
+	})
+	body := ast.Data.(*SProgram).Body
+	if got := parenthesize(*body[0].Data.(*SVarDecl).Init); got != "(2 + (c + 1))" {
+		t.Errorf("unexpected rewrite result %s", got)
+	}
+	call := body[1].Data.(*SExpr).Data.(*ECallExpr)
+	if literal, isNum := call.Args[0].Data.(*ENumericLiteral); !isNum || literal.Value != "2" {
+		t.Error("call argument should be rewritten")
+	}
+}
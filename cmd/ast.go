@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	ast_interpreter "jsInterpreter/ast-interpreter"
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+	"os"
+)
+
+/*
+ast [-module|-script] [-compact] [file]
+把文件解析成ESTree格式的JSON输出，没有file时从标准输入读取
+默认按照执行文件时的规则判断是ES模块还是普通脚本，有语法错误时返回1
+*/
+func PrintAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	module := flags.Bool("module", false, "按照ES模块解析")
+	script := flags.Bool("script", false, "按照普通脚本解析")
+	compact := flags.Bool("compact", false, "输出不带缩进的JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	path := flags.Arg(0)
+	var data []byte
+	var err error
+	if path == "" || path == "-" {
+		path = ""
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	code := string(data)
+
+	isModule := *module
+	if !*module && !*script {
+		isModule = ast_interpreter.IsESModule(path, code)
+	}
+	p := ast_parser.NewParser(code)
+	p.IsModule = isModule
+	ast, diagnostics := p.Parse()
+	if len(diagnostics) > 0 {
+		log := logger.Logger{Content: code, File: path}
+		log.PrintDiagnostics(diagnostics)
+		return 1
+	}
+
+	indent := "  "
+	if *compact {
+		indent = ""
+	}
+	output, err := ast_parser.MarshalESTree(&ast, code, isModule, indent)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(output))
+	return 0
+}
@@ -5,14 +5,32 @@ import (
 	"fmt"
 	ast_interpreter "jsInterpreter/ast-interpreter"
 	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
 )
 
-func RunCommand() {
+//engine为nil时使用树遍历解释器执行输入的代码，optimize为true时执行之前优化语法树
+func RunCommand(engine ast_interpreter.Engine, optimize bool) {
 	var code string
 	var prev string
 	fmt.Println("TIP: 如果想要换行请输入\\n后点击回车")
 	runner := ast_interpreter.NewCodeRunner(nil)
+	runner.SetEngine(engine)
+	runner.SetOptimize(optimize)
+	//执行代码时按下Ctrl-C只停止这次执行，回到输入；等待输入时按下Ctrl-C退出
+	var running int32
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			if atomic.LoadInt32(&running) == 0 {
+				fmt.Println()
+				os.Exit(0)
+			}
+			runner.Interrupt("Ctrl-C")
+		}
+	}()
 	for {
 		print("> ")
 		reader := bufio.NewReader(os.Stdin)
@@ -27,7 +45,9 @@ func RunCommand() {
 			continue
 		} else {
 			code += prev
+			atomic.StoreInt32(&running, 1)
 			runner.Run(code)
+			atomic.StoreInt32(&running, 0)
 			prev = ""
 		}
 	}
@@ -283,6 +283,11 @@ var Token2StringMap = map[T]string{
 	TWith:       "with",
 }
 
+// 属性名等位置允许使用关键字，例如 obj.default、{ if: 1 }
+func IsIdentifierName(t T) bool {
+	return t == TIdentifier || t == TLet || t == TTrue || t == TFalse || t >= TBreak
+}
+
 type Token struct {
 	T   T
 	Loc logger.Loc
@@ -299,6 +304,7 @@ type Lexer struct {
 	CurChar      rune
 	CurCharWidth int
 	HasError     bool
+	Diagnostics  []logger.Diagnostic
 }
 
 func (lexer *Lexer) IsEnd() bool {
@@ -307,7 +313,7 @@ func (lexer *Lexer) IsEnd() bool {
 
 func (lexer *Lexer) Error(loc logger.Loc, msg string) {
 	lexer.HasError = true
-	lexer.Log.Print(logger.LError, loc, msg)
+	lexer.Diagnostics = append(lexer.Diagnostics, logger.Diagnostic{Kind: logger.LError, Loc: loc, Msg: msg})
 }
 
 func (lexer *Lexer) Raw(loc logger.Loc) string {
@@ -374,17 +380,114 @@ func (lexer *Lexer) Tokenizer() []Token {
 		case '<':
 			switch lexer.CurChar {
 			case '=':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
 				token = Token{TLessThanEquals, loc}
+			case '<':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				if lexer.CurChar == '=' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+					token = Token{TLessThanLessThanEquals, loc}
+				} else {
+					token = Token{TLessThanLessThan, loc}
+				}
 			default:
 				token = Token{TLessThan, loc}
 			}
 		case '>':
 			switch lexer.CurChar {
 			case '=':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
 				token = Token{TGreaterThanEquals, loc}
+			case '>':
+				//>> >>= >>> >>>=
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				t := TGreaterThanGreaterThan
+				if lexer.CurChar == '>' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+					t = TGreaterThanGreaterThanGreaterThan
+				}
+				if lexer.CurChar == '=' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+					if t == TGreaterThanGreaterThan {
+						t = TGreaterThanGreaterThanEquals
+					} else {
+						t = TGreaterThanGreaterThanGreaterThanEquals
+					}
+				}
+				token = Token{t, loc}
 			default:
 				token = Token{TGreaterThan, loc}
 			}
+		case '&':
+			switch lexer.CurChar {
+			case '&':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				if lexer.CurChar == '=' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+					token = Token{TAmpersandAmpersandEquals, loc}
+				} else {
+					token = Token{TAmpersandAmpersand, loc}
+				}
+			case '=':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				token = Token{TAmpersandEquals, loc}
+			default:
+				token = Token{TAmpersand, loc}
+			}
+		case '|':
+			switch lexer.CurChar {
+			case '|':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				if lexer.CurChar == '=' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+					token = Token{TBarBarEquals, loc}
+				} else {
+					token = Token{TBarBar, loc}
+				}
+			case '=':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				token = Token{TBarEquals, loc}
+			default:
+				token = Token{TBar, loc}
+			}
+		case '^':
+			if lexer.CurChar == '=' {
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				token = Token{TCaretEquals, loc}
+			} else {
+				token = Token{TCaret, loc}
+			}
+		case '~':
+			token = Token{TTilde, loc}
+		case '?':
+			switch lexer.CurChar {
+			case '?':
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				if lexer.CurChar == '=' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+					token = Token{TQuestionQuestionEquals, loc}
+				} else {
+					token = Token{TQuestionQuestion, loc}
+				}
+			default:
+				token = Token{TQuestion, loc}
+			}
 		case '!':
 			switch lexer.CurChar {
 			case '=':
@@ -406,11 +509,12 @@ func (lexer *Lexer) Tokenizer() []Token {
 				loc.Len += lexer.CurCharWidth
 				lexer.Step()
 				if lexer.CurChar == '=' {
-					loc.Len = lexer.CurCharWidth
+					loc.Len += lexer.CurCharWidth
 					lexer.Step()
 					token = Token{TEqualsEqualsEquals, loc}
+				} else {
+					token = Token{TEqualsEquals, loc}
 				}
-				token = Token{TEqualsEquals, loc}
 			case '>':
 				loc.Len += lexer.CurCharWidth
 				lexer.Step()
@@ -495,7 +599,13 @@ func (lexer *Lexer) Tokenizer() []Token {
 				token = Token{TSlash, loc}
 			}
 		case '%':
-			token = Token{TPercent, loc}
+			if lexer.CurChar == '=' {
+				loc.Len += lexer.CurCharWidth
+				lexer.Step()
+				token = Token{TPercentEquals, loc}
+			} else {
+				token = Token{TPercent, loc}
+			}
 		case '_', '$',
 			'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm',
 			'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z',
@@ -547,6 +657,11 @@ func (lexer *Lexer) Tokenizer() []Token {
 			//String Literal
 			t := curChar
 			for !lexer.IsEnd() && lexer.CurChar != t {
+				//转义的字符不会结束字符串，例如"a\"b"
+				if lexer.CurChar == '\\' {
+					loc.Len += lexer.CurCharWidth
+					lexer.Step()
+				}
 				loc.Len += lexer.CurCharWidth
 				lexer.Step()
 			}
@@ -556,7 +671,9 @@ func (lexer *Lexer) Tokenizer() []Token {
 			}
 			token = Token{TStringLiteral, loc}
 		default:
+			//无法识别的字符产生一个错误token，位置就是这个字符，语法分析在这里恢复
 			lexer.Error(loc, "unexpected word")
+			token = Token{TSyntaxError, loc}
 		}
 		tokens = append(tokens, token)
 	}
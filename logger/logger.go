@@ -7,6 +7,8 @@ import (
 
 type Logger struct {
 	Content string
+	//代码所在的文件，不为空时在出错的代码前打印文件名
+	File string
 }
 
 type Loc struct {
@@ -22,6 +24,19 @@ const (
 	LWarn
 )
 
+//词法分析和语法分析中发现的错误，由调用方决定是否打印
+type Diagnostic struct {
+	Kind LKind
+	Loc  Loc
+	Msg  string
+}
+
+func (log *Logger) PrintDiagnostics(diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		log.Print(d.Kind, d.Loc, d.Msg)
+	}
+}
+
 func (log *Logger) Print(kind LKind, loc Loc, errMsg string) {
 	//计算多少行
 	content := log.Content
@@ -56,6 +71,9 @@ func (log *Logger) Print(kind LKind, loc Loc, errMsg string) {
 	}
 	//start - end是这一行的文本
 	rawCode := log.Content[start:end]
+	if log.File != "" {
+		fmt.Printf("%s:%d\n", log.File, line)
+	}
 	fmt.Printf("%6d| %s\n", line, rawCode)
 	fmt.Printf("%8s", "")
 	for i := 0; i < loc.Offset-start; i++ {
@@ -4,29 +4,55 @@ import (
 	"fmt"
 	ast_interpreter "jsInterpreter/ast-interpreter"
 	"jsInterpreter/cmd"
+	"jsInterpreter/vm"
 	"os"
 )
 
 func main() {
-
-	for _, item := range jsArr.Value.(*ast_interpreter.JsArray).Arr {
-		fmt.Println(item.Value)
-	}
-
 	args := os.Args
+	//ast子命令：输出ESTree格式的语法树
+	if len(args) > 1 && args[1] == "ast" {
+		os.Exit(cmd.PrintAST(args[2:]))
+	}
+	//-vm：使用字节码虚拟机执行，-O：执行之前优化语法树，两个选项可以一起使用
+	var engine ast_interpreter.Engine
+	optimize := false
+	for len(args) > 1 && (args[1] == "-vm" || args[1] == "-O") {
+		if args[1] == "-vm" {
+			engine = vm.Engine{}
+		} else {
+			optimize = true
+		}
+		args = append(args[:1], args[2:]...)
+	}
 	switch len(args) {
 	case 1: // 命令行
-		cmd.RunCommand()
+		cmd.RunCommand(engine, optimize)
 	case 2: // 输入的文件地址
 		dir := args[1]
-		if data, err := os.ReadFile(dir); err != nil {
+		if engine != nil {
+			//虚拟机只支持脚本，不能加载模块
+			data, err := os.ReadFile(dir)
+			if err != nil {
+				fmt.Println("找不到文件")
+				return
+			}
+			runner := ast_interpreter.NewCodeRunner(nil)
+			runner.SetEngine(engine)
+			runner.SetOptimize(optimize)
+			runner.Run(string(data))
+			return
+		}
+		//按照ES模块或CommonJS执行，可以通过import或require加载同一个项目中的其他文件
+		if err := ast_interpreter.RunFile(dir, optimize); err != nil {
 			fmt.Println("找不到文件")
-		} else {
-			ast_interpreter.Run(string(data))
 		}
 
 	default:
 		fmt.Println("参数错误\n" +
-			"输入一个目标代码相对位置或直接以命令行执行")
+			"输入一个目标代码相对位置或直接以命令行执行\n" +
+			"-vm [文件] 使用字节码虚拟机执行\n" +
+			"-O [文件] 执行之前进行常量折叠、删除不会执行的代码，可以和-vm一起使用\n" +
+			"ast [-module|-script] [-compact] [文件] 输出ESTree格式的语法树")
 	}
 }
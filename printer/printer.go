@@ -0,0 +1,530 @@
+package printer
+
+import (
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/lexer"
+	"strings"
+)
+
+/*
+把语法树重新输出成JavaScript代码
+括号只在优先级或结合性需要时输出，原代码中多余的括号会被去掉
+*/
+
+type Options struct {
+	//每一级缩进使用的字符串
+	Indent string
+	//字符串字面量使用的引号，'"'或'\''，为0时使用双引号
+	Quote rune
+}
+
+var DefaultOptions = Options{Indent: "  ", Quote: '"'}
+
+func Print(stmt *ast_parser.Stmt, options Options) string {
+	p := newPrinter(options)
+	p.stmt(stmt)
+	return p.buf.String()
+}
+
+func PrintExpr(expr *ast_parser.Expr, options Options) string {
+	p := newPrinter(options)
+	p.expr(expr, levelLowest)
+	return p.buf.String()
+}
+
+type printer struct {
+	options Options
+	buf     strings.Builder
+	indent  int
+}
+
+func newPrinter(options Options) *printer {
+	if options.Quote == 0 {
+		options.Quote = '"'
+	}
+	return &printer{options: options}
+}
+
+func (p *printer) print(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newLine() {
+	p.buf.WriteByte('\n')
+	for i := 0; i < p.indent; i++ {
+		p.print(p.options.Indent)
+	}
+}
+
+/*
+表达式的优先级，数字越大结合得越紧
+二元运算符的优先级来自ast_parser.BinaryPrecedence，加上levelBinary
+*/
+const (
+	//a, b
+	levelLowest = iota
+	//= yield 箭头函数
+	levelAssign
+	//a ? b : c
+	levelConditional
+	levelBinary
+	//-a typeof a await a
+	levelPrefix = levelBinary + 13
+	//a++
+	levelPostfix = levelPrefix + 1
+	//a.b a[0] a() new A()
+	levelCall = levelPostfix + 1
+	levelPrimary
+)
+
+func binaryLevel(op ast_parser.EOp) int {
+	precedence, _ := ast_parser.BinaryPrecedence(op)
+	return levelBinary + precedence
+}
+
+func exprLevel(expr *ast_parser.Expr) int {
+	switch e := expr.Data.(type) {
+	case *ast_parser.EParen:
+		return exprLevel(&e.Data)
+	case *ast_parser.ESequence:
+		return levelLowest
+	case *ast_parser.EAssign, *ast_parser.EArrowFunction, *ast_parser.EYield:
+		return levelAssign
+	case *ast_parser.EConditional:
+		return levelConditional
+	case *ast_parser.EBinary:
+		return binaryLevel(e.Op)
+	case *ast_parser.EUnary:
+		if e.Association == ast_parser.AssociationRight {
+			return levelPostfix
+		}
+		return levelPrefix
+	case *ast_parser.EAwait:
+		return levelPrefix
+	case *ast_parser.EMemberExpr, *ast_parser.EIndex, *ast_parser.ECallExpr, *ast_parser.ENew, *ast_parser.EImportCall:
+		return levelCall
+	default:
+		return levelPrimary
+	}
+}
+
+//去掉原代码中的括号，是否需要括号由外层决定
+func unparen(expr *ast_parser.Expr) *ast_parser.Expr {
+	for {
+		paren, isParen := expr.Data.(*ast_parser.EParen)
+		if !isParen {
+			return expr
+		}
+		expr = &paren.Data
+	}
+}
+
+//表达式的优先级低于level时加上括号
+func (p *printer) expr(expr *ast_parser.Expr, level int) {
+	expr = unparen(expr)
+	if exprLevel(expr) < level {
+		p.print("(")
+		p.exprNoParen(expr)
+		p.print(")")
+		return
+	}
+	p.exprNoParen(expr)
+}
+
+func (p *printer) exprNoParen(expr *ast_parser.Expr) {
+	switch e := expr.Data.(type) {
+	case nil:
+	case *ast_parser.EIdentifier:
+		p.print(e.Value)
+	case *ast_parser.EThis:
+		p.print("this")
+	case *ast_parser.ENullLiteral:
+		p.print("null")
+	case *ast_parser.EBoolLiteral:
+		if e.Value {
+			p.print("true")
+		} else {
+			p.print("false")
+		}
+	case *ast_parser.ENumericLiteral:
+		p.print(e.Value)
+	case *ast_parser.EStringLiteral:
+		p.print(p.quote(e.Value))
+	case *ast_parser.EArrayLiteral:
+		p.print("[")
+		for i, item := range e.Arr {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expr(item, levelAssign)
+		}
+		p.print("]")
+	case *ast_parser.EObjectLiteral:
+		p.object(e)
+	case *ast_parser.EAssign:
+		p.expr(e.Target, levelCall)
+		p.print(" " + ast_parser.AssignOperator(e.Op) + " ")
+		p.expr(e.Assignment, levelAssign)
+	case *ast_parser.ESequence:
+		for i := range e.Exprs {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expr(&e.Exprs[i], levelAssign)
+		}
+	case *ast_parser.EConditional:
+		p.expr(&e.Test, levelConditional+1)
+		p.print(" ? ")
+		p.expr(&e.Consequent, levelAssign)
+		p.print(" : ")
+		p.expr(&e.Alternate, levelAssign)
+	case *ast_parser.EBinary:
+		p.binary(e)
+	case *ast_parser.EUnary:
+		op := lexer.Token2StringMap[lexer.T(e.Op)]
+		if e.Association == ast_parser.AssociationRight {
+			p.expr(&e.Value, levelCall)
+			p.print(op)
+			return
+		}
+		p.print(op)
+		operand := p.sub(&e.Value, levelPrefix)
+		switch lexer.T(e.Op) {
+		case lexer.TTypeof, lexer.TVoid, lexer.TDelete:
+			p.print(" ")
+		case lexer.TMinus, lexer.TMinusMinus, lexer.TPlus, lexer.TPlusPlus:
+			//- -a 和 + +a 不能连在一起
+			if strings.HasPrefix(operand, op[:1]) {
+				p.print(" ")
+			}
+		}
+		p.print(operand)
+	case *ast_parser.EAwait:
+		p.print("await ")
+		p.expr(&e.Value, levelPrefix)
+	case *ast_parser.EYield:
+		p.print("yield")
+		if e.Delegate {
+			p.print("*")
+		}
+		if e.Argument != nil {
+			p.print(" ")
+			p.expr(e.Argument, levelAssign)
+		}
+	case *ast_parser.EMemberExpr:
+		p.memberObject(&e.Obj)
+		p.print(".")
+		p.print(e.Property.Value)
+	case *ast_parser.EIndex:
+		p.memberObject(&e.Target)
+		p.print("[")
+		p.expr(&e.Idx, levelLowest)
+		p.print("]")
+	case *ast_parser.ECallExpr:
+		p.expr(&e.Callee, levelCall)
+		p.args(e.Args)
+	case *ast_parser.ENew:
+		p.print("new ")
+		//new的Callee中不能有调用，new (f())()和new f()()不同
+		if hasCall(&e.Callee) {
+			p.print("(")
+			p.expr(&e.Callee, levelLowest)
+			p.print(")")
+		} else {
+			p.expr(&e.Callee, levelCall)
+		}
+		p.args(e.Args)
+	case *ast_parser.EImportCall:
+		p.print("import(")
+		p.expr(&e.Source, levelAssign)
+		p.print(")")
+	case *ast_parser.EFunctionExpr:
+		p.function(e.Id, e.Params, e.Body, e.Generator, e.Async)
+	case *ast_parser.EArrowFunction:
+		p.arrow(e)
+	}
+}
+
+//输出到单独的字符串中，用来检查开头的字符
+func (p *printer) sub(expr *ast_parser.Expr, level int) string {
+	sub := &printer{options: p.options, indent: p.indent}
+	sub.expr(expr, level)
+	return sub.buf.String()
+}
+
+/*
+左结合的运算符右侧需要更高的优先级，**相反
+-a ** b是语法错误，**左侧的一元运算需要括号
+??和&&、||混用时需要括号
+*/
+func (p *printer) binary(e *ast_parser.EBinary) {
+	level := binaryLevel(e.Op)
+	leftLevel, rightLevel := level, level+1
+	if lexer.T(e.Op) == lexer.TAsteriskAsterisk {
+		leftLevel, rightLevel = levelPostfix, level
+	}
+	if lexer.T(e.Op) == lexer.TQuestionQuestion {
+		leftLevel, rightLevel = binaryLevel(ast_parser.EOp(lexer.TBar)), binaryLevel(ast_parser.EOp(lexer.TBar))
+		if left, isBinary := unparen(&e.Left).Data.(*ast_parser.EBinary); isBinary && lexer.T(left.Op) == lexer.TQuestionQuestion {
+			leftLevel = level
+		}
+	}
+	p.expr(&e.Left, leftLevel)
+	p.print(" " + lexer.Token2StringMap[lexer.T(e.Op)] + " ")
+	p.expr(&e.Right, rightLevel)
+}
+
+//1.toString()中的点会被当成小数点
+func (p *printer) memberObject(obj *ast_parser.Expr) {
+	if num, isNum := unparen(obj).Data.(*ast_parser.ENumericLiteral); isNum && !strings.ContainsAny(num.Value, ".eE") {
+		p.print("(" + num.Value + ")")
+		return
+	}
+	p.expr(obj, levelCall)
+}
+
+func hasCall(expr *ast_parser.Expr) bool {
+	switch e := unparen(expr).Data.(type) {
+	case *ast_parser.ECallExpr, *ast_parser.EImportCall:
+		return true
+	case *ast_parser.EMemberExpr:
+		return hasCall(&e.Obj)
+	case *ast_parser.EIndex:
+		return hasCall(&e.Target)
+	}
+	return false
+}
+
+func (p *printer) args(args []*ast_parser.Expr) {
+	p.print("(")
+	for i, arg := range args {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(arg, levelAssign)
+	}
+	p.print(")")
+}
+
+func (p *printer) params(params []ast_parser.EIdentifier) {
+	p.print("(")
+	for i, param := range params {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(param.Value)
+	}
+	p.print(")")
+}
+
+func (p *printer) function(id *ast_parser.EIdentifier, params []ast_parser.EIdentifier, body *ast_parser.SBody, generator bool, async bool) {
+	if async {
+		p.print("async ")
+	}
+	p.print("function")
+	if generator {
+		p.print("*")
+	}
+	if id != nil {
+		p.print(" " + id.Value)
+	}
+	p.params(params)
+	p.print(" ")
+	p.block(body.Data.Data)
+}
+
+func (p *printer) arrow(e *ast_parser.EArrowFunction) {
+	if e.Async {
+		p.print("async ")
+	}
+	p.params(e.Params)
+	p.print(" => ")
+	if e.Expression && len(e.Body.Data.Data) == 1 {
+		if ret, isReturn := e.Body.Data.Data[0].Data.(*ast_parser.SReturn); isReturn {
+			//箭头函数直接返回对象时需要括号，否则会被当成函数体
+			if startsWith(&ret.Expr, isObjectLiteral) {
+				p.print("(")
+				p.expr(&ret.Expr, levelLowest)
+				p.print(")")
+			} else {
+				p.expr(&ret.Expr, levelAssign)
+			}
+			return
+		}
+	}
+	p.block(e.Body.Data.Data)
+}
+
+func (p *printer) object(e *ast_parser.EObjectLiteral) {
+	if len(e.Properties) == 0 {
+		p.print("{}")
+		return
+	}
+	//有方法时每个属性占一行
+	multiline := false
+	for _, property := range e.Properties {
+		if property.Kind == ast_parser.PropertyMethod || property.Kind == ast_parser.PropertyGet || property.Kind == ast_parser.PropertySet {
+			multiline = true
+		}
+	}
+	if !multiline {
+		p.print("{ ")
+		for i, property := range e.Properties {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.property(property)
+		}
+		p.print(" }")
+		return
+	}
+	p.print("{")
+	p.indent++
+	for i, property := range e.Properties {
+		if i > 0 {
+			p.print(",")
+		}
+		p.newLine()
+		p.property(property)
+	}
+	p.indent--
+	p.newLine()
+	p.print("}")
+}
+
+func (p *printer) property(property ast_parser.Property) {
+	switch property.Kind {
+	case ast_parser.PropertyGet:
+		p.print("get ")
+	case ast_parser.PropertySet:
+		p.print("set ")
+	}
+	fn, isFn := unparen(&property.Value).Data.(*ast_parser.EFunctionExpr)
+	if property.Kind == ast_parser.PropertyMethod && isFn {
+		if fn.Async {
+			p.print("async ")
+		}
+		if fn.Generator {
+			p.print("*")
+		}
+	}
+	if property.Shorthand {
+		p.expr(&property.Value, levelAssign)
+		return
+	}
+	p.propertyKey(&property.Key, property.Computed)
+	if property.Kind != ast_parser.PropertyInit && property.Kind != ast_parser.PropertyProto && isFn {
+		p.params(fn.Params)
+		p.print(" ")
+		p.block(fn.Body.Data.Data)
+		return
+	}
+	p.print(": ")
+	p.expr(&property.Value, levelAssign)
+}
+
+func (p *printer) propertyKey(key *ast_parser.Expr, computed bool) {
+	if computed {
+		p.print("[")
+		p.expr(key, levelAssign)
+		p.print("]")
+		return
+	}
+	if str, isStr := key.Data.(*ast_parser.EStringLiteral); isStr && isIdentifierName(str.Value) {
+		p.print(str.Value)
+		return
+	}
+	p.expr(key, levelPrimary)
+}
+
+func isIdentifierName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		isLetter := r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+用options.Quote包裹字符串，字符串的值保留了原代码中的转义
+换成另一种引号时，去掉原来引号的转义，给新的引号加上转义
+*/
+func (p *printer) quote(value string) string {
+	quote := p.options.Quote
+	var buf strings.Builder
+	buf.WriteRune(quote)
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			if r != '"' && r != '\'' || r == quote {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == quote:
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	if escaped {
+		buf.WriteRune('\\')
+	}
+	buf.WriteRune(quote)
+	return buf.String()
+}
+
+func isObjectLiteral(expr *ast_parser.Expr) bool {
+	_, isObject := expr.Data.(*ast_parser.EObjectLiteral)
+	return isObject
+}
+
+func isFunctionOrObject(expr *ast_parser.Expr) bool {
+	switch expr.Data.(type) {
+	case *ast_parser.EObjectLiteral, *ast_parser.EFunctionExpr:
+		return true
+	}
+	return false
+}
+
+//输出时表达式最左边的部分是否满足match，不会进入需要加括号的子表达式
+func startsWith(expr *ast_parser.Expr, match func(*ast_parser.Expr) bool) bool {
+	expr = unparen(expr)
+	if match(expr) {
+		return true
+	}
+	var left *ast_parser.Expr
+	switch e := expr.Data.(type) {
+	case *ast_parser.EAssign:
+		left = e.Target
+	case *ast_parser.ESequence:
+		left = &e.Exprs[0]
+	case *ast_parser.EConditional:
+		left = &e.Test
+	case *ast_parser.EBinary:
+		left = &e.Left
+	case *ast_parser.EUnary:
+		if e.Association == ast_parser.AssociationRight {
+			left = &e.Value
+		}
+	case *ast_parser.EMemberExpr:
+		left = &e.Obj
+	case *ast_parser.EIndex:
+		left = &e.Target
+	case *ast_parser.ECallExpr:
+		left = &e.Callee
+	}
+	if left == nil || exprLevel(unparen(left)) < exprLevel(expr) {
+		return false
+	}
+	return startsWith(left, match)
+}
@@ -0,0 +1,85 @@
+package printer
+
+import (
+	"jsInterpreter/ast_parser"
+	"testing"
+)
+
+func parse(t *testing.T, code string, module bool) ast_parser.Stmt {
+	p := ast_parser.NewParser(code)
+	p.IsModule = module
+	ast, diagnostics := p.Parse()
+	if len(diagnostics) > 0 {
+		t.Fatalf("%s: %s", code, diagnostics[0].Msg)
+	}
+	return ast
+}
+
+func Test_PrintParens(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"(a + b) * c", "(a + b) * c;"},
+		{"a + (b * c)", "a + b * c;"},
+		{"(a - b) - c", "a - b - c;"},
+		{"a - (b - c)", "a - (b - c);"},
+		{"(2 ** 3) ** 2", "(2 ** 3) ** 2;"},
+		{"2 ** (3 ** 2)", "2 ** 3 ** 2;"},
+		{"(-a) ** b", "(-a) ** b;"},
+		{"-(-a)", "- -a;"},
+		{"(a || b) ?? c", "(a || b) ?? c;"},
+		{"a ?? (b && c)", "a ?? (b && c);"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e;"},
+		{"a = (b ? c : d)", "a = b ? c : d;"},
+		{"(a, b) => ({ a: 1 })", "(a, b) => ({ a: 1 });"},
+		{"(function () { return 1 })()", "(function() {\n  return 1;\n}());"},
+		{"({ a: 1 }).a", "({ a: 1 }.a);"},
+		{"new (f().A)()", "new (f().A)();"},
+		{"new (a.B)(1).c", "new a.B(1).c;"},
+		{"(1).toString()", "(1).toString();"},
+		{"typeof (a + b)", "typeof (a + b);"},
+		{"(a.b)(c)[0]", "a.b(c)[0];"},
+		{"(await x) ** 2", "(await x) ** 2;"},
+	}
+	for _, test := range tests {
+		ast := parse(t, test.code, true)
+		if got := Print(&ast, DefaultOptions); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.code, test.want, got)
+		}
+	}
+}
+
+func Test_PrintOptions(t *testing.T) {
+	ast := parse(t, `if (a) { b("x'y", 'p"q', "r\"s") }`, false)
+	want := "if (a) {\n\tb('x\\'y', 'p\"q', 'r\"s');\n}"
+	if got := Print(&ast, Options{Indent: "\t", Quote: '\''}); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+//解析、输出、再解析再输出的结果应该相同
+func Test_PrintRoundTrip(t *testing.T) {
+	code := `import d, { a as b, c } from "m"
+import * as ns from "n"
+export const x = 1
+export default function f(a, b) { return a ?? b }
+export { x as y, d }
+export * as all from "o"
+let obj = { a, "b-c": 1, [k]: 2, m() { return this.a }, get g() { return 1 }, set g(v) {}, async q() { await 1 }, *gen() { yield* [1] } }
+function* g() { const v = yield 1; yield }
+for (let i = 0; i < 10; i++) { if (i % 2 === 0) { continue } else if (i > 5) { break } else { obj.list[i].name = i } }
+outer: for (;;) { for (let j = 0; ; j++) { continue outer } break outer }
+try { throw new Error("e") } catch (e) { console.log(e) } finally { }
+class A extends B { field = 1; method(x) { return x } }
+let h = async (x) => await x
+let v = a ? b : c ? d : e
+let w = !(a && b) || (-c) ** 2
+`
+	ast := parse(t, code, true)
+	first := Print(&ast, DefaultOptions)
+	again := parse(t, first, true)
+	if second := Print(&again, DefaultOptions); first != second {
+		t.Errorf("round trip changed the output:\n%s\n---\n%s", first, second)
+	}
+}
@@ -0,0 +1,286 @@
+package printer
+
+import "jsInterpreter/ast_parser"
+
+func (p *printer) stmts(stmts []*ast_parser.Stmt) {
+	for i, stmt := range stmts {
+		if i > 0 {
+			p.newLine()
+		}
+		p.stmt(stmt)
+	}
+}
+
+//{ }，语句各占一行
+func (p *printer) block(stmts []*ast_parser.Stmt) {
+	if len(stmts) == 0 {
+		p.print("{}")
+		return
+	}
+	p.print("{")
+	p.indent++
+	p.newLine()
+	p.stmts(stmts)
+	p.indent--
+	p.newLine()
+	p.print("}")
+}
+
+func varKind(kind ast_parser.VarKind) string {
+	switch kind {
+	case ast_parser.VConst:
+		return "const"
+	case ast_parser.VVar:
+		return "var"
+	default:
+		return "let"
+	}
+}
+
+func (p *printer) varDecl(decl *ast_parser.SVarDecl) {
+	p.print(varKind(decl.Kind()) + " " + decl.Id.Value)
+	if decl.Init != nil {
+		p.print(" = ")
+		p.expr(decl.Init, levelAssign)
+	}
+}
+
+func (p *printer) stmt(stmt *ast_parser.Stmt) {
+	switch s := stmt.Data.(type) {
+	case nil, *ast_parser.SError:
+		p.print(";")
+	case *ast_parser.SProgram:
+		p.stmts(s.Body)
+	case *ast_parser.SVarDecl:
+		p.varDecl(s)
+		p.print(";")
+	case *ast_parser.SExpr:
+		p.exprStmt(&s.Expr)
+	case *ast_parser.SBlock:
+		p.block(s.Data)
+	case *ast_parser.SBody:
+		p.block(s.Data.Data)
+	case *ast_parser.SBreak:
+		p.jump("break", s.Label)
+	case *ast_parser.SContinue:
+		p.jump("continue", s.Label)
+	case *ast_parser.SLabeled:
+		p.print(s.Label + ": ")
+		p.stmt(s.Body)
+	case *ast_parser.SReturn:
+		p.print("return")
+		if s.Expr.Data != nil {
+			p.print(" ")
+			p.expr(&s.Expr, levelLowest)
+		}
+		p.print(";")
+	case *ast_parser.SThrow:
+		p.print("throw ")
+		p.expr(&s.Expr, levelLowest)
+		p.print(";")
+	case *ast_parser.SFor:
+		p.print("for (")
+		if s.Initializer != nil {
+			switch init := s.Initializer.Data.(type) {
+			case *ast_parser.SVarDecl:
+				p.varDecl(init)
+			case *ast_parser.SExpr:
+				p.expr(&init.Expr, levelLowest)
+			}
+		}
+		p.print(";")
+		if s.Condition != nil && s.Condition.Data != nil {
+			p.print(" ")
+			p.expr(s.Condition, levelLowest)
+		}
+		p.print(";")
+		if s.Reset != nil {
+			if reset, isExpr := s.Reset.Data.(*ast_parser.SExpr); isExpr && reset.Data != nil {
+				p.print(" ")
+				p.expr(&reset.Expr, levelLowest)
+			}
+		}
+		p.print(") ")
+		p.block(s.Body.Data.Data)
+	case *ast_parser.SWhile:
+		p.print("while (")
+		if condition, isExpr := s.Condition.Data.(*ast_parser.SExpr); isExpr {
+			p.expr(&condition.Expr, levelLowest)
+		}
+		p.print(") ")
+		p.block(s.Body.Data.Data)
+	case *ast_parser.SCondition:
+		for i, branch := range s.Branches {
+			if i > 0 {
+				p.print(" else ")
+			}
+			if branch.Condition != nil {
+				p.print("if (")
+				p.expr(branch.Condition, levelLowest)
+				p.print(") ")
+			}
+			p.block(branch.Body.Data.Data)
+		}
+	case *ast_parser.SFunctionDecl:
+		p.function(s.Id, s.Params, s.Body, s.Generator, s.Async)
+	case *ast_parser.STry:
+		p.print("try ")
+		p.block(s.Block.Data.Data)
+		if s.Handler != nil {
+			p.print(" catch ")
+			if s.Param != nil {
+				p.print("(" + s.Param.Value + ") ")
+			}
+			p.block(s.Handler.Data.Data)
+		}
+		if s.Finalizer != nil {
+			p.print(" finally ")
+			p.block(s.Finalizer.Data.Data)
+		}
+	case *ast_parser.SClass:
+		p.class(s)
+	case *ast_parser.SImport:
+		p.importDecl(s)
+	case *ast_parser.SExportDecl:
+		p.print("export ")
+		p.stmt(s.Decl)
+	case *ast_parser.SExportDefault:
+		p.print("export default ")
+		p.expr(&s.Expr, levelAssign)
+		if _, isFn := unparen(&s.Expr).Data.(*ast_parser.EFunctionExpr); !isFn {
+			p.print(";")
+		}
+	case *ast_parser.SExportNamed:
+		p.print("export {")
+		for i, specifier := range s.Specifiers {
+			if i > 0 {
+				p.print(",")
+			}
+			p.print(" " + p.moduleExportName(specifier.Local))
+			if specifier.Exported != specifier.Local {
+				p.print(" as " + p.moduleExportName(specifier.Exported))
+			}
+		}
+		if len(s.Specifiers) > 0 {
+			p.print(" ")
+		}
+		p.print("}")
+		if s.Source != nil {
+			p.print(" from " + p.quote(*s.Source))
+		}
+		p.print(";")
+	case *ast_parser.SExportAll:
+		p.print("export *")
+		if s.Exported != nil {
+			p.print(" as " + p.moduleExportName(*s.Exported))
+		}
+		p.print(" from " + p.quote(s.Source) + ";")
+	}
+}
+
+/*
+表达式语句不能以{或匿名的function开头，否则会被当成代码块或函数声明
+具名的function在这里就是函数声明，原样输出
+*/
+func (p *printer) exprStmt(expr *ast_parser.Expr) {
+	if fn, isFn := expr.Data.(*ast_parser.EFunctionExpr); isFn && fn.Id != nil {
+		p.function(fn.Id, fn.Params, fn.Body, fn.Generator, fn.Async)
+		return
+	}
+	if startsWith(expr, isFunctionOrObject) {
+		p.print("(")
+		p.expr(expr, levelLowest)
+		p.print(");")
+		return
+	}
+	p.expr(expr, levelLowest)
+	p.print(";")
+}
+
+//break;、continue;或者带标签的break label;
+func (p *printer) jump(keyword string, label string) {
+	p.print(keyword)
+	if label != "" {
+		p.print(" " + label)
+	}
+	p.print(";")
+}
+
+func (p *printer) class(s *ast_parser.SClass) {
+	p.print("class " + s.Id.Value)
+	if s.SuperClass != nil {
+		p.print(" extends ")
+		p.expr(s.SuperClass, levelCall)
+	}
+	if len(s.Body) == 0 {
+		p.print(" {}")
+		return
+	}
+	p.print(" {")
+	p.indent++
+	for _, member := range s.Body {
+		p.newLine()
+		switch value := member.Value.(type) {
+		case *ast_parser.SFunctionDecl:
+			p.print(member.Key.Value)
+			p.params(value.Params)
+			p.print(" ")
+			p.block(value.Body.Data.Data)
+		case *ast_parser.SVarDecl:
+			p.print(member.Key.Value)
+			if value.Init != nil {
+				p.print(" = ")
+				p.expr(value.Init, levelAssign)
+			}
+			p.print(";")
+		}
+	}
+	p.indent--
+	p.newLine()
+	p.print("}")
+}
+
+func (p *printer) importDecl(s *ast_parser.SImport) {
+	p.print("import ")
+	hasBinding := false
+	if s.Default != nil {
+		p.print(s.Default.Value)
+		hasBinding = true
+	}
+	if s.Namespace != nil {
+		if hasBinding {
+			p.print(", ")
+		}
+		p.print("* as " + s.Namespace.Value)
+		hasBinding = true
+	}
+	if len(s.Specifiers) > 0 {
+		if hasBinding {
+			p.print(", ")
+		}
+		p.print("{")
+		for i, specifier := range s.Specifiers {
+			if i > 0 {
+				p.print(",")
+			}
+			p.print(" " + p.moduleExportName(specifier.Imported))
+			if specifier.Imported != specifier.Local.Value {
+				p.print(" as " + specifier.Local.Value)
+			}
+		}
+		p.print(" }")
+		hasBinding = true
+	}
+	if hasBinding {
+		p.print(" from ")
+	}
+	p.print(p.quote(s.Source) + ";")
+}
+
+//import/export中的名字，不是标识符时输出成字符串
+func (p *printer) moduleExportName(name string) string {
+	if isIdentifierName(name) {
+		return name
+	}
+	return p.quote(name)
+}
@@ -0,0 +1,1108 @@
+package vm
+
+import (
+	"jsInterpreter/analyzer"
+	ast_interpreter "jsInterpreter/ast-interpreter"
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/lexer"
+	"jsInterpreter/logger"
+	"strconv"
+)
+
+type compiler struct {
+	result *analyzer.Result
+	//变量在所在作用域中的位置，即在Scope.Declared中的下标
+	slots map[*analyzer.Symbol]int
+	//对象字面量中方法的作用域，方法名不会绑定到方法内部
+	methods     map[*analyzer.Scope]bool
+	diagnostics []logger.Diagnostic
+	fs          *funcState
+}
+
+// 正在编译的函数
+type funcState struct {
+	proto *FunctionProto
+	//当前代码所在的作用域
+	scope *analyzer.Scope
+	//函数内已经进入的块级作用域(OpPushEnv)的层数
+	envDepth int
+	//break需要弹出的栈上的临时值的个数，例如finally的异常路径上保存的异常
+	temps     int
+	targets   []*jumpTarget
+	tries     []*tryState
+	constants map[ast_interpreter.JsValue]int
+	names     map[string]int
+	loc       logger.Loc
+}
+
+// break/continue可以跳转到的语句：循环和带标签的语句
+type jumpTarget struct {
+	labels []string
+	loop   bool
+	//需要回填的跳转指令
+	breaks    []int
+	continues []int
+	//break跳出语句时的环境层数，continue跳到循环体之外、for头部的作用域之内
+	envDepth      int
+	continueDepth int
+	temps         int
+	tries         int
+}
+
+// break、continue和return离开try语句时需要弹出handler并执行finally
+type tryState struct {
+	finalizer *ast_parser.SBody
+	//当前有效的handler数量：try块中是catch和finally的，catch块中只有finally的
+	handlers int
+	scope    *analyzer.Scope
+	envDepth int
+	temps    int
+	targets  int
+}
+
+/*
+把程序编译成字节码，程序的顶层相当于一个没有参数的函数
+作用域分析的结果决定每个变量存放在哪里：函数和块级作用域中的变量按位置存放在环境中，
+顶层的声明和没有声明的全局变量按名字在InterpreterStat.Scope和全局对象上查找
+*/
+func Compile(program *ast_parser.Stmt) (*FunctionProto, []logger.Diagnostic) {
+	result, diagnostics := analyzer.Analyze(program, false)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
+	}
+	c := &compiler{
+		result:  result,
+		slots:   map[*analyzer.Symbol]int{},
+		methods: map[*analyzer.Scope]bool{},
+	}
+	for _, scope := range result.Scopes {
+		for i, symbol := range scope.Declared {
+			c.slots[symbol] = i
+		}
+	}
+
+	body := program.Data.(*ast_parser.SProgram)
+	proto := &FunctionProto{Name: "<program>", Strict: body.Strict, Arrow: true, NameSlot: -1}
+	c.fs = newFuncState(proto, result.Root)
+	for _, symbol := range result.Root.Declared {
+		switch symbol.Kind {
+		case analyzer.SymbolVar:
+			c.emit(OpHoistGlobal, c.name(symbol.Name), int(declareVar))
+		case analyzer.SymbolLet:
+			c.emit(OpHoistGlobal, c.name(symbol.Name), int(declareLet))
+		case analyzer.SymbolConst:
+			c.emit(OpHoistGlobal, c.name(symbol.Name), int(declareConst))
+		}
+	}
+	c.body(body.Body)
+	return proto, c.diagnostics
+}
+
+func newFuncState(proto *FunctionProto, scope *analyzer.Scope) *funcState {
+	return &funcState{
+		proto:     proto,
+		scope:     scope,
+		constants: map[ast_interpreter.JsValue]int{},
+		names:     map[string]int{},
+	}
+}
+
+func (c *compiler) error(loc logger.Loc, msg string) {
+	c.diagnostics = append(c.diagnostics, logger.Diagnostic{Kind: logger.LError, Loc: loc, Msg: msg})
+}
+
+func (c *compiler) unsupported(loc logger.Loc, what string) {
+	c.error(loc, what+" is not supported by the bytecode VM")
+}
+
+/**********/
+/** 指令 **/
+/**********/
+
+// 写入一条指令，返回它的位置
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	fs := c.fs
+	proto := fs.proto
+	pc := len(proto.Code)
+	if n := len(proto.locs); n == 0 || proto.locs[n-1].loc != fs.loc {
+		proto.locs = append(proto.locs, pcLoc{pc, fs.loc})
+	}
+	proto.Code = append(proto.Code, byte(op))
+	for i, width := range opcodes[op].operands {
+		operand := operands[i]
+		if operand >= 1<<(8*width) {
+			c.error(fs.loc, "Syntax Error: program is too large for the bytecode VM")
+		}
+		proto.Code = append(proto.Code, byte(operand))
+		if width == 2 {
+			proto.Code = append(proto.Code, byte(operand>>8))
+		}
+	}
+	return pc
+}
+
+// 写入一条目标未知的跳转指令，返回需要回填的位置
+func (c *compiler) emitJump(op Opcode, operands ...int) int {
+	return c.emit(op, append([]int{0}, operands...)...) + 1
+}
+
+// 把pos处的跳转目标设置为当前位置
+func (c *compiler) patch(pos int) {
+	code := c.fs.proto.Code
+	target := len(code)
+	if target > 0xffff {
+		c.error(c.fs.loc, "Syntax Error: program is too large for the bytecode VM")
+	}
+	code[pos] = byte(target)
+	code[pos+1] = byte(target >> 8)
+}
+
+func (c *compiler) constant(value ast_interpreter.JsValue) {
+	fs := c.fs
+	k, has := fs.constants[value]
+	if !has {
+		k = len(fs.proto.Constants)
+		fs.proto.Constants = append(fs.proto.Constants, value)
+		fs.constants[value] = k
+	}
+	c.emit(OpConstant, k)
+}
+
+func (c *compiler) name(name string) int {
+	fs := c.fs
+	k, has := fs.names[name]
+	if !has {
+		k = len(fs.proto.Names)
+		fs.proto.Names = append(fs.proto.Names, name)
+		fs.names[name] = k
+	}
+	return k
+}
+
+/************/
+/** 作用域 **/
+/************/
+
+// 顶层以外有声明的作用域在运行时才有对应的环境
+func materialized(scope *analyzer.Scope) bool {
+	return scope != nil && scope.Kind != analyzer.ScopeGlobal && len(scope.Declared) > 0
+}
+
+func (c *compiler) scopeInfo(scope *analyzer.Scope) *ScopeInfo {
+	info := &ScopeInfo{}
+	for _, symbol := range scope.Declared {
+		info.Names = append(info.Names, symbol.Name)
+		switch symbol.Kind {
+		case analyzer.SymbolLet, analyzer.SymbolConst:
+			info.init = append(info.init, ast_interpreter.JsValue{Type: ast_interpreter.Uninitialized})
+		default:
+			info.init = append(info.init, ast_interpreter.JsValue{Type: ast_interpreter.Undefined})
+		}
+	}
+	return info
+}
+
+// 进入块级作用域，有声明时创建新的环境，返回是否创建了环境
+func (c *compiler) pushScope(scope *analyzer.Scope) bool {
+	if scope == nil {
+		return false
+	}
+	fs := c.fs
+	fs.scope = scope
+	if !materialized(scope) {
+		return false
+	}
+	fs.proto.Scopes = append(fs.proto.Scopes, c.scopeInfo(scope))
+	c.emit(OpPushEnv, len(fs.proto.Scopes)-1)
+	fs.envDepth++
+	return true
+}
+
+func (c *compiler) popScope(outer *analyzer.Scope, pushed bool) {
+	if pushed {
+		c.emit(OpPopEnv)
+		c.fs.envDepth--
+	}
+	c.fs.scope = outer
+}
+
+/*
+找到标识符对应的变量，local为false时按名字在顶层作用域和全局对象上查找，
+否则从当前环境向上depth层，第index个变量
+*/
+func (c *compiler) resolve(id *ast_parser.EIdentifier) (symbol *analyzer.Symbol, depth int, index int, local bool) {
+	symbol = c.result.SymbolOf(id)
+	//方法名在方法内部不可见，引用的是外层的同名变量
+	for symbol != nil && symbol.Kind == analyzer.SymbolFunctionName && c.methods[symbol.Scope] {
+		symbol = symbol.Scope.Parent.Lookup(symbol.Name)
+	}
+	if symbol == nil || symbol.Scope.Kind == analyzer.ScopeGlobal {
+		return symbol, 0, 0, false
+	}
+	for scope := c.fs.scope; scope != symbol.Scope; scope = scope.Parent {
+		if materialized(scope) {
+			depth++
+		}
+	}
+	return symbol, depth, c.slots[symbol], true
+}
+
+func (c *compiler) load(id *ast_parser.EIdentifier) {
+	if _, depth, index, local := c.resolve(id); local {
+		c.emit(OpGetVar, depth, index)
+	} else {
+		c.emit(OpGetGlobal, c.name(id.Value))
+	}
+}
+
+// 给变量赋值，值留在栈上
+func (c *compiler) store(id *ast_parser.EIdentifier) {
+	symbol, depth, index, local := c.resolve(id)
+	switch {
+	case !local:
+		c.emit(OpSetGlobal, c.name(id.Value))
+	case symbol.Kind == analyzer.SymbolConst:
+		c.emit(OpSetConst, depth, index)
+	default:
+		c.emit(OpSetVar, depth, index)
+	}
+}
+
+// 执行声明，值出栈
+func (c *compiler) declare(id *ast_parser.EIdentifier, kind byte) {
+	if _, depth, index, local := c.resolve(id); local {
+		c.emit(OpInitVar, depth, index)
+	} else {
+		c.emit(OpDeclareGlobal, c.name(id.Value), int(kind))
+	}
+}
+
+/**********/
+/** 函数 **/
+/**********/
+
+/*
+编译函数，返回它在外层函数的Functions中的位置
+node是作用域分析中函数作用域的key，id是具名函数表达式的名字
+*/
+func (c *compiler) function(node ast_parser.Node, name string, id *ast_parser.EIdentifier, params []ast_parser.EIdentifier, body *ast_parser.SBody, arrow bool) int {
+	scope := c.result.Scopes[node]
+	proto := &FunctionProto{Name: name, Strict: body.Strict, Arrow: arrow, NameSlot: -1}
+	if materialized(scope) {
+		proto.Scope = c.scopeInfo(scope)
+	}
+	for i := range params {
+		proto.ParamSlots = append(proto.ParamSlots, c.slots[c.result.SymbolOf(&params[i])])
+	}
+	if id != nil && !c.methods[scope] {
+		if symbol := scope.Symbols[id.Value]; symbol != nil && symbol.Kind == analyzer.SymbolFunctionName {
+			proto.NameSlot = c.slots[symbol]
+		}
+	}
+
+	parent := c.fs
+	c.fs = newFuncState(proto, scope)
+	c.fs.loc = body.Loc
+	c.body(body.Data.Data)
+	c.fs = parent
+
+	parent.proto.Functions = append(parent.proto.Functions, proto)
+	return len(parent.proto.Functions) - 1
+}
+
+// 函数体和程序：先创建函数声明，最后隐式地返回undefined
+func (c *compiler) body(stmts []*ast_parser.Stmt) {
+	c.hoistFunctions(stmts)
+	c.stmts(stmts)
+	c.emit(OpUndefined)
+	c.emit(OpReturn)
+}
+
+// 进入作用域时先创建其中的函数声明
+func (c *compiler) hoistFunctions(stmts []*ast_parser.Stmt) {
+	for _, stmt := range stmts {
+		s, isExpr := stmt.Data.(*ast_parser.SExpr)
+		if !isExpr {
+			continue
+		}
+		fn, isFn := s.Data.(*ast_parser.EFunctionExpr)
+		if !isFn || fn.Id == nil {
+			continue
+		}
+		c.fs.loc = stmt.Loc
+		if c.checkFunction(stmt.Loc, fn.Generator, fn.Async) {
+			c.emit(OpClosure, c.function(&s.Expr, fn.Id.Value, nil, fn.Params, fn.Body, false))
+			c.declare(fn.Id, declareFunction)
+		}
+	}
+}
+
+func (c *compiler) checkFunction(loc logger.Loc, generator bool, async bool) bool {
+	switch {
+	case generator:
+		c.unsupported(loc, "generator function")
+	case async:
+		c.unsupported(loc, "async function")
+	default:
+		return true
+	}
+	return false
+}
+
+/**********/
+/** 语句 **/
+/**********/
+
+func (c *compiler) stmts(stmts []*ast_parser.Stmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+// 在新的块级作用域中编译语句，node是作用域分析中这个作用域的key
+func (c *compiler) block(node ast_parser.Node, stmts []*ast_parser.Stmt) {
+	outer := c.fs.scope
+	pushed := c.pushScope(c.result.Scopes[node])
+	c.hoistFunctions(stmts)
+	c.stmts(stmts)
+	c.popScope(outer, pushed)
+}
+
+func (c *compiler) stmt(stmt *ast_parser.Stmt) {
+	if stmt == nil || stmt.Data == nil {
+		return
+	}
+	c.fs.loc = stmt.Loc
+	switch s := stmt.Data.(type) {
+	case *ast_parser.SExpr:
+		if fn, isFn := s.Data.(*ast_parser.EFunctionExpr); isFn && fn.Id != nil {
+			//函数声明已经在进入作用域时创建好了
+			return
+		}
+		c.expr(&s.Expr)
+		c.emit(OpPop)
+	case *ast_parser.SVarDecl:
+		c.varDecl(s)
+	case *ast_parser.SBlock:
+		c.block(stmt, s.Data)
+	case *ast_parser.SCondition:
+		c.condition(s)
+	case *ast_parser.SFor:
+		c.forLoop(stmt, s, nil)
+	case *ast_parser.SLabeled:
+		c.labeled(stmt)
+	case *ast_parser.SBreak:
+		c.jump(stmt.Loc, s.Label, false)
+	case *ast_parser.SContinue:
+		c.jump(stmt.Loc, s.Label, true)
+	case *ast_parser.SReturn:
+		//严格模式中的return f()，当前函数没有需要退出的try时用f的frame代替当前的frame
+		if call := tailCall(s); call != nil && len(c.fs.tries) == 0 {
+			outer := c.fs.loc
+			c.fs.loc = call.Loc
+			c.call(call.Data.(*ast_parser.ECallExpr), OpTailCall)
+			c.fs.loc = outer
+			c.emit(OpReturn)
+			break
+		}
+		if s.Data != nil {
+			c.expr(&s.Expr)
+		} else {
+			c.emit(OpUndefined)
+		}
+		c.exitTries(0, true)
+		c.emit(OpReturn)
+	case *ast_parser.SThrow:
+		c.expr(&s.Expr)
+		c.emit(OpThrow)
+	case *ast_parser.STry:
+		c.try(stmt, s)
+	case *ast_parser.SClass:
+		c.unsupported(stmt.Loc, "class")
+	case *ast_parser.SImport, *ast_parser.SExportDecl, *ast_parser.SExportDefault, *ast_parser.SExportNamed, *ast_parser.SExportAll:
+		c.unsupported(stmt.Loc, "module syntax")
+	default:
+		c.unsupported(stmt.Loc, "this statement")
+	}
+}
+
+func (c *compiler) varDecl(s *ast_parser.SVarDecl) {
+	kind := s.Kind()
+	if kind == ast_parser.VVar && s.Init == nil {
+		//var已经在执行之前创建好了
+		return
+	}
+	loc := c.fs.loc
+	if s.Init != nil {
+		c.expr(s.Init)
+	} else {
+		c.emit(OpUndefined)
+	}
+	c.fs.loc = loc
+	_, depth, index, local := c.resolve(&s.Id)
+	switch {
+	case local:
+		c.emit(OpInitVar, depth, index)
+	case kind == ast_parser.VVar:
+		//顶层的var和树遍历解释器一样，相当于赋值
+		c.emit(OpSetGlobal, c.name(s.Id.Value))
+		c.emit(OpPop)
+	case kind == ast_parser.VConst:
+		c.emit(OpDeclareGlobal, c.name(s.Id.Value), int(declareConst))
+	default:
+		c.emit(OpDeclareGlobal, c.name(s.Id.Value), int(declareLet))
+	}
+}
+
+func (c *compiler) condition(s *ast_parser.SCondition) {
+	ends := []int{}
+	for _, branch := range s.Branches {
+		next := -1
+		//else分支没有条件
+		if branch.Condition != nil {
+			c.expr(branch.Condition)
+			next = c.emitJump(OpJumpIfFalse)
+		}
+		c.block(branch.Body, branch.Body.Data.Data)
+		if next < 0 {
+			break
+		}
+		ends = append(ends, c.emitJump(OpJump))
+		c.patch(next)
+	}
+	for _, pos := range ends {
+		c.patch(pos)
+	}
+}
+
+/*
+for头部的作用域只创建一次，循环体的作用域每次循环都重新创建
+labels是循环语句前的标签
+*/
+func (c *compiler) forLoop(stmt *ast_parser.Stmt, s *ast_parser.SFor, labels []string) {
+	fs := c.fs
+	target := &jumpTarget{labels: labels, loop: true, envDepth: fs.envDepth, temps: fs.temps, tries: len(fs.tries)}
+	outer := fs.scope
+	pushed := c.pushScope(c.result.Scopes[stmt])
+	target.continueDepth = fs.envDepth
+
+	c.stmt(s.Initializer)
+	//和树遍历解释器一样，条件之前换成新的环境，闭包捕获的是每次循环自己的变量
+	if pushed {
+		c.emit(OpCopyEnv)
+	}
+	start := len(fs.proto.Code)
+	exit := -1
+	if s.Condition != nil && s.Condition.Data != nil {
+		c.expr(s.Condition)
+		exit = c.emitJump(OpJumpIfFalse)
+	}
+	fs.targets = append(fs.targets, target)
+	c.block(s.Body, s.Body.Data.Data)
+	fs.targets = fs.targets[:len(fs.targets)-1]
+	for _, pos := range target.continues {
+		c.patch(pos)
+	}
+	if pushed {
+		c.emit(OpCopyEnv)
+	}
+	c.stmt(s.Reset)
+	c.emit(OpJump, start)
+	if exit >= 0 {
+		c.patch(exit)
+	}
+	c.popScope(outer, pushed)
+	for _, pos := range target.breaks {
+		c.patch(pos)
+	}
+}
+
+// a: b: for (...) 连续的标签都属于同一个语句
+func (c *compiler) labeled(stmt *ast_parser.Stmt) {
+	var labels []string
+	body := stmt
+	for {
+		labeled, isLabeled := body.Data.(*ast_parser.SLabeled)
+		if !isLabeled {
+			break
+		}
+		labels = append(labels, labeled.Label)
+		body = labeled.Body
+	}
+	if forLoop, isLoop := body.Data.(*ast_parser.SFor); isLoop {
+		c.forLoop(body, forLoop, labels)
+		return
+	}
+	fs := c.fs
+	target := &jumpTarget{labels: labels, envDepth: fs.envDepth, temps: fs.temps, tries: len(fs.tries)}
+	fs.targets = append(fs.targets, target)
+	c.stmt(body)
+	fs.targets = fs.targets[:len(fs.targets)-1]
+	for _, pos := range target.breaks {
+		c.patch(pos)
+	}
+}
+
+func (c *compiler) findTarget(loc logger.Loc, label string, isContinue bool) *jumpTarget {
+	targets := c.fs.targets
+	for i := len(targets) - 1; i >= 0; i-- {
+		target := targets[i]
+		if label == "" {
+			if target.loop {
+				return target
+			}
+			continue
+		}
+		for _, l := range target.labels {
+			if l != label {
+				continue
+			}
+			if isContinue && !target.loop {
+				c.error(loc, "Syntax Error: Illegal continue statement: '"+label+"' does not denote an iteration statement")
+				return nil
+			}
+			return target
+		}
+	}
+	switch {
+	case label != "":
+		c.error(loc, "Syntax Error: Undefined label '"+label+"'")
+	case isContinue:
+		c.error(loc, "Syntax Error: Illegal continue statement: no surrounding iteration statement")
+	default:
+		c.error(loc, "Syntax Error: Illegal break statement")
+	}
+	return nil
+}
+
+// break和continue：离开经过的try和块级作用域，再跳转到目标
+func (c *compiler) jump(loc logger.Loc, label string, isContinue bool) {
+	target := c.findTarget(loc, label, isContinue)
+	if target == nil {
+		return
+	}
+	envDepth, temps := c.exitTries(target.tries, false)
+	targetDepth := target.envDepth
+	if isContinue {
+		targetDepth = target.continueDepth
+	}
+	c.unwind(envDepth-targetDepth, temps-target.temps)
+	if isContinue {
+		target.continues = append(target.continues, c.emitJump(OpJump))
+	} else {
+		target.breaks = append(target.breaks, c.emitJump(OpJump))
+	}
+}
+
+func (c *compiler) unwind(envs int, temps int) {
+	for i := 0; i < envs; i++ {
+		c.emit(OpPopEnv)
+	}
+	for i := 0; i < temps; i++ {
+		c.emit(OpPop)
+	}
+}
+
+/*
+离开第depth个以及更内层的try语句：弹出它们的handler，在try语句所在的作用域中执行finally
+ret为true时是return，返回值在栈顶，不弹出临时值
+返回离开之后的环境层数和临时值个数
+*/
+func (c *compiler) exitTries(depth int, ret bool) (int, int) {
+	fs := c.fs
+	envDepth, temps := fs.envDepth, fs.temps
+	for i := len(fs.tries) - 1; i >= depth; i-- {
+		t := fs.tries[i]
+		if ret {
+			c.unwind(envDepth-t.envDepth, 0)
+		} else {
+			c.unwind(envDepth-t.envDepth, temps-t.temps)
+			temps = t.temps
+		}
+		envDepth = t.envDepth
+		for j := 0; j < t.handlers; j++ {
+			c.emit(OpPopHandler)
+		}
+		if t.finalizer == nil {
+			continue
+		}
+		scope, outerDepth, outerTemps, tries, targets := fs.scope, fs.envDepth, fs.temps, fs.tries, fs.targets
+		fs.scope, fs.envDepth, fs.temps = t.scope, t.envDepth, temps
+		if ret {
+			fs.temps = temps + 1
+		}
+		//finally中的try和循环不能修改外层的列表
+		fs.tries = append([]*tryState{}, tries[:i]...)
+		fs.targets = append([]*jumpTarget{}, targets[:t.targets]...)
+		c.block(t.finalizer, t.finalizer.Data.Data)
+		fs.scope, fs.envDepth, fs.temps, fs.tries, fs.targets = scope, outerDepth, outerTemps, tries, targets
+	}
+	return envDepth, temps
+}
+
+/*
+try { B } catch (e) { C } finally { F }
+
+	PUSH_HANDLER finally; PUSH_HANDLER catch
+	B; POP_HANDLER; JUMP done
+
+catch:
+
+	e = 异常; C
+
+done:
+
+	POP_HANDLER; F; JUMP end
+
+finally:
+
+	F; RETHROW
+
+end:
+*/
+func (c *compiler) try(stmt *ast_parser.Stmt, s *ast_parser.STry) {
+	fs := c.fs
+	t := &tryState{finalizer: s.Finalizer, scope: fs.scope, envDepth: fs.envDepth, temps: fs.temps, targets: len(fs.targets)}
+	finallyHandler, catchHandler := 0, 0
+	if s.Finalizer != nil {
+		finallyHandler = c.emitJump(OpPushHandler, int(handlerFinally))
+		t.handlers++
+	}
+	if s.Handler != nil {
+		catchHandler = c.emitJump(OpPushHandler, int(handlerCatch))
+		t.handlers++
+	}
+	fs.tries = append(fs.tries, t)
+	c.block(s.Block, s.Block.Data.Data)
+
+	if s.Handler != nil {
+		c.fs.loc = stmt.Loc
+		c.emit(OpPopHandler)
+		t.handlers--
+		done := c.emitJump(OpJump)
+		c.patch(catchHandler)
+		outer := fs.scope
+		pushed := c.pushScope(c.result.Scopes[stmt])
+		if s.Param != nil {
+			c.declare(s.Param, declareLet)
+		} else {
+			c.emit(OpPop)
+		}
+		stmts := s.Handler.Data.Data
+		c.hoistFunctions(stmts)
+		c.stmts(stmts)
+		c.popScope(outer, pushed)
+		c.patch(done)
+	}
+	fs.tries = fs.tries[:len(fs.tries)-1]
+
+	if s.Finalizer != nil {
+		c.fs.loc = stmt.Loc
+		c.emit(OpPopHandler)
+		c.block(s.Finalizer, s.Finalizer.Data.Data)
+		end := c.emitJump(OpJump)
+		c.patch(finallyHandler)
+		//异常路径上原来的异常保存在栈上
+		fs.temps++
+		c.block(s.Finalizer, s.Finalizer.Data.Data)
+		fs.temps--
+		c.emit(OpRethrow)
+		c.patch(end)
+	}
+}
+
+/************/
+/** 表达式 **/
+/************/
+
+func (c *compiler) expr(e *ast_parser.Expr) {
+	fs := c.fs
+	outer := fs.loc
+	fs.loc = e.Loc
+	defer func() {
+		fs.loc = outer
+	}()
+
+	switch t := e.Data.(type) {
+	case *ast_parser.ENumericLiteral:
+		num, _ := strconv.ParseFloat(t.Value, 64)
+		c.constant(ast_interpreter.NumberValue(num))
+	case *ast_parser.EStringLiteral:
+		c.constant(ast_interpreter.JsValue{Value: t.Value, Type: ast_interpreter.String})
+	case *ast_parser.EBoolLiteral:
+		if t.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *ast_parser.ENullLiteral:
+		c.emit(OpNull)
+	case *ast_parser.EThis:
+		c.emit(OpThis)
+	case *ast_parser.EIdentifier:
+		c.load(t)
+	case *ast_parser.EParen:
+		c.expr(&t.Data)
+	case *ast_parser.EAssign:
+		c.assign(e, t)
+	case *ast_parser.ESequence:
+		for i := range t.Exprs {
+			if i > 0 {
+				c.emit(OpPop)
+			}
+			c.expr(&t.Exprs[i])
+		}
+	case *ast_parser.EBinary:
+		c.binary(t)
+	case *ast_parser.EConditional:
+		c.expr(&t.Test)
+		alternate := c.emitJump(OpJumpIfFalse)
+		c.expr(&t.Consequent)
+		end := c.emitJump(OpJump)
+		c.patch(alternate)
+		c.expr(&t.Alternate)
+		c.patch(end)
+	case *ast_parser.EUnary:
+		c.unary(e, t)
+	case *ast_parser.EMemberExpr:
+		c.expr(&t.Obj)
+		c.emit(OpGetProp, c.name(t.Property.Value))
+	case *ast_parser.EIndex:
+		c.expr(&t.Target)
+		c.expr(&t.Idx)
+		c.emit(OpGetIndex)
+	case *ast_parser.ECallExpr:
+		c.call(t, OpCall)
+	case *ast_parser.ENew:
+		c.expr(&t.Callee)
+		c.args(t.Args)
+		c.emit(OpNew, len(t.Args))
+	case *ast_parser.EArrayLiteral:
+		for _, item := range t.Arr {
+			c.expr(item)
+		}
+		c.emit(OpArray, len(t.Arr))
+	case *ast_parser.EObjectLiteral:
+		c.object(t)
+	case *ast_parser.EFunctionExpr:
+		if !c.checkFunction(e.Loc, t.Generator, t.Async) {
+			c.emit(OpUndefined)
+			return
+		}
+		name := ""
+		if t.Id != nil {
+			name = t.Id.Value
+		}
+		c.emit(OpClosure, c.function(e, name, t.Id, t.Params, t.Body, false))
+	case *ast_parser.EArrowFunction:
+		if !c.checkFunction(e.Loc, false, t.Async) {
+			c.emit(OpUndefined)
+			return
+		}
+		c.emit(OpClosure, c.function(e, "", nil, t.Params, t.Body, true))
+	case *ast_parser.EYield:
+		c.unsupported(e.Loc, "yield")
+		c.emit(OpUndefined)
+	case *ast_parser.EAwait:
+		c.unsupported(e.Loc, "await")
+		c.emit(OpUndefined)
+	case *ast_parser.EImportCall:
+		c.unsupported(e.Loc, "import()")
+		c.emit(OpUndefined)
+	default:
+		c.emit(OpUndefined)
+	}
+}
+
+func (c *compiler) args(args []*ast_parser.Expr) {
+	for _, arg := range args {
+		c.expr(arg)
+	}
+}
+
+// a.b()和a[b]()的this是a，其他情况是undefined
+// 严格模式函数中return f()的f()，去掉外层的括号
+func tailCall(s *ast_parser.SReturn) *ast_parser.Expr {
+	if !s.Tail {
+		return nil
+	}
+	e := &s.Expr
+	for {
+		switch t := e.Data.(type) {
+		case *ast_parser.EParen:
+			e = &t.Data
+		case *ast_parser.ECallExpr:
+			return e
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *compiler) call(t *ast_parser.ECallExpr, op Opcode) {
+	switch callee := t.Callee.Data.(type) {
+	case *ast_parser.EMemberExpr:
+		c.expr(&callee.Obj)
+		c.emit(OpDup)
+		c.emit(OpGetProp, c.name(callee.Property.Value))
+	case *ast_parser.EIndex:
+		c.expr(&callee.Target)
+		c.emit(OpDup)
+		c.expr(&callee.Idx)
+		c.emit(OpGetIndex)
+	default:
+		c.emit(OpUndefined)
+		c.expr(&t.Callee)
+	}
+	c.args(t.Args)
+	c.emit(op, len(t.Args))
+}
+
+/*
+复合赋值先读取原来的值：
+a += b:   GET a; b; BINARY +; SET a
+o.a += b: o; DUP; GET_PROP a; b; BINARY +; SET_PROP a
+o[k] += b: o; k; DUP2; GET_INDEX; b; BINARY +; SET_INDEX
+逻辑赋值短路时跳过右侧和赋值，去掉栈上的对象和key，原来的值就是结果
+*/
+func (c *compiler) assign(e *ast_parser.Expr, t *ast_parser.EAssign) {
+	if t.Op != 0 {
+		c.compoundAssign(e, t)
+		return
+	}
+	switch target := t.Target.Data.(type) {
+	case *ast_parser.EIdentifier:
+		c.expr(t.Assignment)
+		c.store(target)
+	case *ast_parser.EMemberExpr:
+		c.expr(&target.Obj)
+		c.expr(t.Assignment)
+		c.emit(OpSetProp, c.name(target.Property.Value))
+	case *ast_parser.EIndex:
+		c.expr(&target.Target)
+		c.expr(&target.Idx)
+		c.expr(t.Assignment)
+		c.emit(OpSetIndex)
+	default:
+		c.error(e.Loc, "Syntax Error: Invalid left-hand side in assignment")
+		c.emit(OpUndefined)
+	}
+}
+
+func (c *compiler) compoundAssign(e *ast_parser.Expr, t *ast_parser.EAssign) {
+	switch target := t.Target.Data.(type) {
+	case *ast_parser.EIdentifier:
+		c.load(target)
+	case *ast_parser.EMemberExpr:
+		c.expr(&target.Obj)
+		c.emit(OpDup)
+		c.emit(OpGetProp, c.name(target.Property.Value))
+	case *ast_parser.EIndex:
+		c.expr(&target.Target)
+		c.expr(&target.Idx)
+		c.emit(OpDup2)
+		c.emit(OpGetIndex)
+	default:
+		c.error(e.Loc, "Syntax Error: Invalid left-hand side in assignment")
+		c.emit(OpUndefined)
+		return
+	}
+
+	logical := true
+	shortCircuit := 0
+	switch lexer.T(t.Op) {
+	case lexer.TAmpersandAmpersand:
+		shortCircuit = c.emitJump(OpJumpIfFalseOrPop)
+	case lexer.TBarBar:
+		shortCircuit = c.emitJump(OpJumpIfTrueOrPop)
+	case lexer.TQuestionQuestion:
+		shortCircuit = c.emitJump(OpJumpIfNotNullishOrPop)
+	default:
+		logical = false
+	}
+	c.expr(t.Assignment)
+	if !logical {
+		c.emit(OpBinary, int(t.Op))
+	}
+
+	switch target := t.Target.Data.(type) {
+	case *ast_parser.EIdentifier:
+		c.store(target)
+	case *ast_parser.EMemberExpr:
+		c.emit(OpSetProp, c.name(target.Property.Value))
+	case *ast_parser.EIndex:
+		c.emit(OpSetIndex)
+	}
+	if !logical {
+		return
+	}
+	if _, isId := t.Target.Data.(*ast_parser.EIdentifier); isId {
+		c.patch(shortCircuit)
+		return
+	}
+	end := c.emitJump(OpJump)
+	c.patch(shortCircuit)
+	if _, isMember := t.Target.Data.(*ast_parser.EMemberExpr); isMember {
+		c.emit(OpSwap)
+		c.emit(OpPop)
+	} else {
+		c.emit(OpRot3)
+		c.emit(OpPop)
+		c.emit(OpPop)
+	}
+	c.patch(end)
+}
+
+// &&、||、??短路，跳过右侧时左侧的值就是结果
+func (c *compiler) binary(t *ast_parser.EBinary) {
+	c.expr(&t.Left)
+	var jump Opcode
+	switch lexer.T(t.Op) {
+	case lexer.TAmpersandAmpersand:
+		jump = OpJumpIfFalseOrPop
+	case lexer.TBarBar:
+		jump = OpJumpIfTrueOrPop
+	case lexer.TQuestionQuestion:
+		jump = OpJumpIfNotNullishOrPop
+	default:
+		c.expr(&t.Right)
+		c.emit(OpBinary, int(t.Op))
+		return
+	}
+	end := c.emitJump(jump)
+	c.expr(&t.Right)
+	c.patch(end)
+}
+
+func (c *compiler) unary(e *ast_parser.Expr, t *ast_parser.EUnary) {
+	switch lexer.T(t.Op) {
+	case lexer.TDelete:
+		c.delete(&t.Value)
+	case lexer.TPlusPlus, lexer.TMinusMinus:
+		c.update(e, t)
+	case lexer.TTypeof:
+		//typeof对没有声明的全局变量返回"undefined"
+		if id, isId := t.Value.Data.(*ast_parser.EIdentifier); isId {
+			if _, _, _, local := c.resolve(id); !local {
+				c.emit(OpTypeofGlobal, c.name(id.Value))
+				return
+			}
+		}
+		c.expr(&t.Value)
+		c.emit(OpUnary, int(t.Op))
+	default:
+		c.expr(&t.Value)
+		c.emit(OpUnary, int(t.Op))
+	}
+}
+
+func (c *compiler) delete(target *ast_parser.Expr) {
+	switch t := target.Data.(type) {
+	case *ast_parser.EMemberExpr:
+		c.expr(&t.Obj)
+		c.emit(OpDeleteProp, c.name(t.Property.Value))
+	case *ast_parser.EIndex:
+		c.expr(&t.Target)
+		c.expr(&t.Idx)
+		c.emit(OpDeleteIndex)
+	case *ast_parser.EIdentifier:
+		//声明的变量不能删除
+		if _, _, _, local := c.resolve(t); local {
+			c.emit(OpFalse)
+		} else {
+			c.emit(OpDeleteGlobal, c.name(t.Value))
+		}
+	default:
+		c.expr(target)
+		c.emit(OpPop)
+		c.emit(OpTrue)
+	}
+}
+
+/*
+++a和a++，后缀形式的结果是原来的值
+a++:    GET a; DUP; UPDATE; SET a; POP
+o.a++:  o; DUP; GET_PROP a; DUP; ROT3; UPDATE; SET_PROP a; POP
+o[k]++: o; k; DUP2; GET_INDEX; DUP; ROT4; UPDATE; SET_INDEX; POP
+*/
+func (c *compiler) update(e *ast_parser.Expr, t *ast_parser.EUnary) {
+	postfix := t.Association == ast_parser.AssociationRight
+	switch target := t.Value.Data.(type) {
+	case *ast_parser.EIdentifier:
+		c.load(target)
+		if postfix {
+			c.emit(OpDup)
+		}
+		c.emit(OpUpdate, int(t.Op))
+		c.store(target)
+	case *ast_parser.EMemberExpr:
+		c.expr(&target.Obj)
+		c.emit(OpDup)
+		c.emit(OpGetProp, c.name(target.Property.Value))
+		if postfix {
+			c.emit(OpDup)
+			c.emit(OpRot3)
+		}
+		c.emit(OpUpdate, int(t.Op))
+		c.emit(OpSetProp, c.name(target.Property.Value))
+	case *ast_parser.EIndex:
+		c.expr(&target.Target)
+		c.expr(&target.Idx)
+		c.emit(OpDup2)
+		c.emit(OpGetIndex)
+		if postfix {
+			c.emit(OpDup)
+			c.emit(OpRot4)
+		}
+		c.emit(OpUpdate, int(t.Op))
+		c.emit(OpSetIndex)
+	default:
+		c.error(e.Loc, "Syntax Error: Invalid left-hand side expression in update operation")
+		c.emit(OpUndefined)
+		return
+	}
+	if postfix {
+		c.emit(OpPop)
+	}
+}
+
+// { key: value }：OBJECT，然后每个属性 key value DEFINE_PROP
+func (c *compiler) object(t *ast_parser.EObjectLiteral) {
+	c.emit(OpObject)
+	for i := range t.Properties {
+		property := &t.Properties[i]
+		if property.Kind == ast_parser.PropertyProto {
+			c.expr(&property.Value)
+			c.emit(OpSetProto)
+			continue
+		}
+		c.expr(&property.Key)
+		kind := propertyData
+		switch property.Kind {
+		case ast_parser.PropertyMethod, ast_parser.PropertyGet, ast_parser.PropertySet:
+			c.method(&property.Value)
+			if property.Kind == ast_parser.PropertyGet {
+				kind = propertyGet
+			} else if property.Kind == ast_parser.PropertySet {
+				kind = propertySet
+			}
+		default:
+			c.expr(&property.Value)
+		}
+		c.emit(OpDefineProp, int(kind))
+	}
+}
+
+func (c *compiler) method(e *ast_parser.Expr) {
+	fn := e.Data.(*ast_parser.EFunctionExpr)
+	if !c.checkFunction(e.Loc, fn.Generator, fn.Async) {
+		c.emit(OpUndefined)
+		return
+	}
+	c.methods[c.result.Scopes[e]] = true
+	name := ""
+	if fn.Id != nil {
+		name = fn.Id.Value
+	}
+	c.emit(OpClosure, c.function(e, name, fn.Id, fn.Params, fn.Body, false))
+}
@@ -0,0 +1,108 @@
+package vm
+
+import (
+	"fmt"
+	ast_interpreter "jsInterpreter/ast-interpreter"
+	"jsInterpreter/logger"
+	"sort"
+	"strings"
+)
+
+/*
+编译后的函数，程序的顶层也编译成一个函数
+Scope是函数自己的作用域(参数和函数体顶层的声明)，没有声明时为nil，直接使用闭包捕获的环境
+Scopes是函数体中有声明的块级作用域，由OpPushEnv创建
+*/
+type FunctionProto struct {
+	Name      string
+	Code      []byte
+	Constants []ast_interpreter.JsValue
+	Names     []string
+	Functions []*FunctionProto
+	Scope     *ScopeInfo
+	Scopes    []*ScopeInfo
+	//参数在Scope中的位置，同名的参数对应同一个位置
+	ParamSlots []int
+	//具名函数表达式的名字在Scope中的位置，没有时为-1
+	NameSlot int
+	Strict   bool
+	//箭头函数和程序的顶层没有自己的this，使用创建时的this
+	Arrow bool
+	locs  []pcLoc
+}
+
+// 作用域中变量的名字和初始值，let/const的初始值是Uninitialized，其他是undefined
+type ScopeInfo struct {
+	Names []string
+	init  []ast_interpreter.JsValue
+}
+
+type pcLoc struct {
+	pc  int
+	loc logger.Loc
+}
+
+// pc处的指令对应的源代码位置
+func (p *FunctionProto) loc(pc int) logger.Loc {
+	i := sort.Search(len(p.locs), func(i int) bool {
+		return p.locs[i].pc > pc
+	})
+	if i == 0 {
+		return logger.Loc{}
+	}
+	return p.locs[i-1].loc
+}
+
+/*
+反汇编，调试用，内层的函数跟在后面
+0003 GET_VAR 0 1 ; count
+*/
+func (p *FunctionProto) Disassemble() string {
+	var b strings.Builder
+	p.disassemble(&b)
+	return b.String()
+}
+
+func (p *FunctionProto) disassemble(b *strings.Builder) {
+	name := p.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	fmt.Fprintf(b, "== %s ==\n", name)
+	for pc := 0; pc < len(p.Code); {
+		op := Opcode(p.Code[pc])
+		fmt.Fprintf(b, "%04d %s", pc, op)
+		pc++
+		var operands []int
+		for _, width := range opcodes[op].operands {
+			operand := int(p.Code[pc])
+			if width == 2 {
+				operand |= int(p.Code[pc+1]) << 8
+			}
+			operands = append(operands, operand)
+			fmt.Fprintf(b, " %d", operand)
+			pc += width
+		}
+		if comment := p.comment(op, operands); comment != "" {
+			fmt.Fprintf(b, " ; %s", comment)
+		}
+		b.WriteString("\n")
+	}
+	for _, fn := range p.Functions {
+		fn.disassemble(b)
+	}
+}
+
+func (p *FunctionProto) comment(op Opcode, operands []int) string {
+	switch op {
+	case OpConstant:
+		value := p.Constants[operands[0]]
+		return ast_interpreter.ToString(&value).Value.(string)
+	case OpGetGlobal, OpSetGlobal, OpTypeofGlobal, OpDeleteGlobal, OpDeclareGlobal, OpHoistGlobal,
+		OpGetProp, OpSetProp, OpDeleteProp:
+		return p.Names[operands[0]]
+	case OpClosure:
+		return p.Functions[operands[0]].Name
+	}
+	return ""
+}
@@ -0,0 +1,192 @@
+package vm
+
+type Opcode byte
+
+/*
+指令由一个字节的操作码和若干操作数组成，操作数的宽度见opcodes，
+两个字节的操作数按小端序存放，跳转的目标是函数字节码中的绝对位置
+注释中的 a b -> c 表示指令执行前后栈顶的变化
+*/
+const (
+	//-> constants[k]
+	OpConstant Opcode = iota
+	OpUndefined
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop
+	//a -> a a
+	OpDup
+	//a b -> a b a b
+	OpDup2
+	//a b -> b a
+	OpSwap
+	//a b c -> c a b
+	OpRot3
+	//a b c d -> d a b c
+	OpRot4
+	OpThis
+
+	//depth index：沿着环境链向上depth层，读写第index个变量
+	OpGetVar
+	//赋值表达式的值留在栈上
+	OpSetVar
+	//声明时初始化变量，不检查TDZ，值出栈
+	OpInitVar
+	//给const赋值，检查TDZ后抛出TypeError
+	OpSetConst
+
+	//name：顶层作用域中的变量和全局对象的属性，按名字查找
+	OpGetGlobal
+	OpSetGlobal
+	OpTypeofGlobal
+	OpDeleteGlobal
+	//name kind：执行顶层的let/const/函数声明，值出栈
+	OpDeclareGlobal
+	//name kind：执行之前提前创建顶层的var和let/const
+	OpHoistGlobal
+
+	//name：obj -> obj.name
+	OpGetProp
+	//name：obj value -> value
+	OpSetProp
+	OpDeleteProp
+	//obj key -> obj[key]
+	OpGetIndex
+	//obj key value -> value
+	OpSetIndex
+	OpDeleteIndex
+
+	//op：a b -> a op b
+	OpBinary
+	//op：a -> op a
+	OpUnary
+	//op：a -> a+1或a-1
+	OpUpdate
+
+	OpJump
+	//条件出栈
+	OpJumpIfFalse
+	//&&、||、??：跳转时条件留在栈上作为结果，否则出栈
+	OpJumpIfFalseOrPop
+	OpJumpIfTrueOrPop
+	OpJumpIfNotNullishOrPop
+
+	//argc：this callee args... -> result
+	OpCall
+	//argc：和OpCall相同，被调用的是这个虚拟机中的函数时代替当前的frame，后面紧跟着OpReturn
+	OpTailCall
+	//argc：callee args... -> result
+	OpNew
+	OpReturn
+	//function：创建闭包，捕获当前的环境
+	OpClosure
+	OpThrow
+	//finally的异常路径结束后重新抛出原来的异常
+	OpRethrow
+	//address kind：进入try，异常时跳转到address
+	OpPushHandler
+	OpPopHandler
+	//scope：进入有声明的块级作用域
+	OpPushEnv
+	OpPopEnv
+	//复制当前环境，for头部的let每次循环都是新的变量
+	OpCopyEnv
+
+	//n：n个元素 -> 数组
+	OpArray
+	OpObject
+	//kind：obj key value -> obj
+	OpDefineProp
+	//obj proto -> obj
+	OpSetProto
+)
+
+type opcodeInfo struct {
+	name string
+	//每个操作数的字节数
+	operands []int
+}
+
+var opcodes = [...]opcodeInfo{
+	OpConstant:              {"CONSTANT", []int{2}},
+	OpUndefined:             {"UNDEFINED", nil},
+	OpNull:                  {"NULL", nil},
+	OpTrue:                  {"TRUE", nil},
+	OpFalse:                 {"FALSE", nil},
+	OpPop:                   {"POP", nil},
+	OpDup:                   {"DUP", nil},
+	OpDup2:                  {"DUP2", nil},
+	OpSwap:                  {"SWAP", nil},
+	OpRot3:                  {"ROT3", nil},
+	OpRot4:                  {"ROT4", nil},
+	OpThis:                  {"THIS", nil},
+	OpGetVar:                {"GET_VAR", []int{1, 2}},
+	OpSetVar:                {"SET_VAR", []int{1, 2}},
+	OpInitVar:               {"INIT_VAR", []int{1, 2}},
+	OpSetConst:              {"SET_CONST", []int{1, 2}},
+	OpGetGlobal:             {"GET_GLOBAL", []int{2}},
+	OpSetGlobal:             {"SET_GLOBAL", []int{2}},
+	OpTypeofGlobal:          {"TYPEOF_GLOBAL", []int{2}},
+	OpDeleteGlobal:          {"DELETE_GLOBAL", []int{2}},
+	OpDeclareGlobal:         {"DECLARE_GLOBAL", []int{2, 1}},
+	OpHoistGlobal:           {"HOIST_GLOBAL", []int{2, 1}},
+	OpGetProp:               {"GET_PROP", []int{2}},
+	OpSetProp:               {"SET_PROP", []int{2}},
+	OpDeleteProp:            {"DELETE_PROP", []int{2}},
+	OpGetIndex:              {"GET_INDEX", nil},
+	OpSetIndex:              {"SET_INDEX", nil},
+	OpDeleteIndex:           {"DELETE_INDEX", nil},
+	OpBinary:                {"BINARY", []int{1}},
+	OpUnary:                 {"UNARY", []int{1}},
+	OpUpdate:                {"UPDATE", []int{1}},
+	OpJump:                  {"JUMP", []int{2}},
+	OpJumpIfFalse:           {"JUMP_IF_FALSE", []int{2}},
+	OpJumpIfFalseOrPop:      {"JUMP_IF_FALSE_OR_POP", []int{2}},
+	OpJumpIfTrueOrPop:       {"JUMP_IF_TRUE_OR_POP", []int{2}},
+	OpJumpIfNotNullishOrPop: {"JUMP_IF_NOT_NULLISH_OR_POP", []int{2}},
+	OpCall:                  {"CALL", []int{1}},
+	OpTailCall:              {"TAIL_CALL", []int{1}},
+	OpNew:                   {"NEW", []int{1}},
+	OpReturn:                {"RETURN", nil},
+	OpClosure:               {"CLOSURE", []int{2}},
+	OpThrow:                 {"THROW", nil},
+	OpRethrow:               {"RETHROW", nil},
+	OpPushHandler:           {"PUSH_HANDLER", []int{2, 1}},
+	OpPopHandler:            {"POP_HANDLER", nil},
+	OpPushEnv:               {"PUSH_ENV", []int{2}},
+	OpPopEnv:                {"POP_ENV", nil},
+	OpCopyEnv:               {"COPY_ENV", nil},
+	OpArray:                 {"ARRAY", []int{2}},
+	OpObject:                {"OBJECT", nil},
+	OpDefineProp:            {"DEFINE_PROP", []int{1}},
+	OpSetProto:              {"SET_PROTO", nil},
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodes) {
+		return opcodes[op].name
+	}
+	return "UNKNOWN"
+}
+
+// OpDeclareGlobal和OpHoistGlobal的kind
+const (
+	declareVar byte = iota
+	declareLet
+	declareConst
+	declareFunction
+)
+
+// OpDefineProp的kind
+const (
+	propertyData byte = iota
+	propertyGet
+	propertySet
+)
+
+// OpPushHandler的kind，catch得到抛出的值，finally得到原来的异常，执行完后重新抛出
+const (
+	handlerCatch byte = iota
+	handlerFinally
+)
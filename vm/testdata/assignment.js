@@ -0,0 +1,53 @@
+let n = 10
+n += 5
+n -= 3
+n *= 2
+n /= 4
+n **= 2
+n %= 7
+console.log(n)
+let bits = 6
+bits &= 3
+bits |= 8
+bits ^= 1
+bits <<= 2
+bits >>= 1
+bits >>>= 1
+console.log(bits)
+
+let s = "a"
+s += "b"
+console.log(s)
+
+let o = { count: 1, name: "", missing: null }
+o.count += 2
+o.name ||= "default"
+o.count &&= o.count * 10
+o.missing ??= "filled"
+o.count ??= 0
+console.log(o.count, o.name, o.missing)
+
+let arr = [1, 2, 3]
+let i = 0
+arr[i++] += 10
+arr[2] ||= 99
+arr[1] &&= 0
+console.log(arr[0], arr[1], arr[2], i)
+
+let calls = 0
+function side() {
+	calls++
+	return 1
+}
+let t = 1
+t ||= side()
+let f = 0
+f &&= side()
+console.log(t, f, calls)
+
+let seq = (calls++, calls++, calls)
+console.log(seq)
+let b = 10
+for (let a = 0; a < b; a += 3, b -= 3) {
+	console.log(a, b)
+}
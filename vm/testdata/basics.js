@@ -0,0 +1,105 @@
+function fib(n) {
+	if (n < 2) {
+		return n
+	}
+	return fib(n - 1) + fib(n - 2)
+}
+console.log(fib(15))
+
+function counter() {
+	let count = 0
+	return {
+		inc: () => {
+			count = count + 1
+			return count
+		},
+		get: function () {
+			return count
+		}
+	}
+}
+let c = counter()
+c.inc()
+c.inc()
+console.log(c.get(), c.inc())
+
+let sum = 0
+for (let i = 0; i < 10; i++) {
+	if (i % 2 == 0) {
+		continue
+	}
+	sum = sum + i
+}
+console.log(sum)
+
+let pairs = ""
+outer: for (let i = 0; i < 4; i++) {
+	for (let j = 0; j < 4; j++) {
+		if (j > i) {
+			continue outer
+		}
+		if (i == 3) {
+			break outer
+		}
+		pairs = pairs + i + j + " "
+	}
+}
+console.log(pairs)
+
+block: {
+	console.log("in block")
+	if (sum > 0) {
+		break block
+	}
+	console.log("not reached")
+}
+
+let n = 0
+for (;;) {
+	n++
+	if (n >= 5) {
+		break
+	} else if (n == 2) {
+		console.log("two")
+	} else {
+		console.log("other", n)
+	}
+}
+
+console.log(1 + 2 * 3, 7 % 3, 2 ** 10, -5 / 2, 5 & 3, 5 | 3, 5 ^ 3, ~5, 1 << 4, -16 >> 2, -16 >>> 28)
+console.log("a" + 1 + 2, 1 + 2 + "b", !0, !"x", typeof 1, typeof "s", typeof fib, typeof null, void 1)
+console.log(0 || "default", 1 && "both", null ?? "fallback", 0 ?? "zero kept", sum > 10 ? "big" : "small")
+
+let x = 10
+x++
+x++
+--x
+console.log(x)
+x--
+console.log(--x)
+
+const adders = []
+for (let i = 0; i < 3; i++) {
+	adders.push(function (v) {
+		return v + 100
+	})
+}
+console.log(adders.length, adders[2](1))
+
+const fact = function f(k) {
+	return k <= 1 ? 1 : k * f(k - 1)
+}
+console.log(fact(10))
+
+function outerFn() {
+	let a = 1
+	function middle() {
+		let b = 2
+		return function () {
+			return a + b
+		}
+	}
+	a = 40
+	return middle()
+}
+console.log(outerFn()())
@@ -0,0 +1,144 @@
+function thrower(v) {
+	throw v
+}
+
+try {
+	thrower("boom")
+} catch (e) {
+	console.log("caught", e)
+} finally {
+	console.log("finally")
+}
+
+function finallyOverrides() {
+	try {
+		return "try"
+	} finally {
+		return "finally"
+	}
+}
+console.log(finallyOverrides())
+
+function returnThroughFinally() {
+	let log = ""
+	for (let i = 0; i < 3; i++) {
+		try {
+			if (i == 1) {
+				return log + "returned at 1"
+			}
+			log = log + i
+		} finally {
+			log = log + "f"
+			console.log("finally", i)
+		}
+	}
+	return log
+}
+console.log(returnThroughFinally())
+
+let trace = ""
+for (let i = 0; i < 4; i++) {
+	try {
+		try {
+			if (i == 2) {
+				break
+			}
+			if (i == 0) {
+				continue
+			}
+			trace = trace + "body" + i
+		} finally {
+			trace = trace + "[inner" + i + "]"
+		}
+	} finally {
+		trace = trace + "[outer" + i + "]"
+	}
+}
+console.log(trace)
+
+function breakInFinally() {
+	for (;;) {
+		try {
+			throw "lost"
+		} finally {
+			break
+		}
+	}
+	return "swallowed"
+}
+console.log(breakInFinally())
+
+try {
+	try {
+		thrower(1)
+	} finally {
+		console.log("inner finally")
+	}
+} catch (e) {
+	console.log("outer caught", e)
+}
+
+try {
+	null.x
+} catch (e) {
+	console.log(e)
+}
+
+try {
+	let f = 1
+	f()
+} catch (e) {
+	console.log("call", e)
+}
+
+try {
+	new (() => 1)()
+} catch (e) {
+	console.log(e)
+}
+
+function deep(n) {
+	if (n == 0) {
+		thrower("deep " + n)
+	}
+	return deep(n - 1)
+}
+try {
+	deep(50)
+} catch (e) {
+	console.log(e)
+}
+
+let rethrown = ""
+try {
+	try {
+		thrower("first")
+	} catch (e) {
+		rethrown = e
+		thrower("second")
+	} finally {
+		rethrown = rethrown + "+finally"
+	}
+} catch (e) {
+	console.log(rethrown, e)
+}
+
+try {
+	const k = 1
+	k = 2
+} catch (e) {
+	console.log(e)
+}
+
+try {
+	early
+	let early = 1
+} catch (e) {
+	console.log(e)
+}
+
+try {
+	notDeclaredAnywhere
+} catch (e) {
+	console.log(e)
+}
@@ -0,0 +1,62 @@
+let point = { x: 1, y: 2, 1.0: "one", ["comp" + "uted"]: true }
+point.z = point.x + point.y
+console.log(point.x, point["y"], point.z, point[1], point.computed)
+console.log("x" in point, "w" in point, delete point.x, "x" in point)
+try { "a" in 1 } catch (e) { console.log(e) }
+
+let temperature = {
+	celsius: 25,
+	get fahrenheit() {
+		return this.celsius * 9 / 5 + 32
+	},
+	set fahrenheit(f) {
+		this.celsius = (f - 32) * 5 / 9
+	},
+	describe() {
+		return "it is " + this.celsius
+	}
+}
+console.log(temperature.fahrenheit)
+temperature.fahrenheit = 212
+console.log(temperature.celsius, temperature.describe())
+
+let base = {
+	greet: function () {
+		return "hello " + this.name
+	}
+}
+let child = { __proto__: base, name: "child" }
+console.log(child.greet())
+
+function Person(name, age) {
+	this.name = name
+	this.age = age
+}
+let p = new Person("ann", 30)
+console.log(p.name, p.age, p instanceof Person, base instanceof Person)
+
+function Box(v) {
+	this.v = v
+	return { boxed: v }
+}
+console.log(new Box(3).boxed, new Box(3).v)
+
+let arr = [1, 2, 3]
+arr.push(4, 5)
+arr[7] = 8
+console.log(arr.length, arr[6], arr[7])
+
+let nested = { list: [{ v: 1 }, { v: 2 }] }
+nested.list[1].v = 20
+nested.list[0].v++
+console.log(nested.list[0].v, nested.list[1].v)
+let key = "v"
+nested.list[1][key] = nested.list[1][key] + 1
+console.log(nested.list[1][key])
+
+let counter = { n: 0 }
+let old = counter.n++
+console.log(old, counter.n, ++counter.n)
+
+console.log(typeof {}, typeof [], typeof Person, typeof console.log)
+console.log(globalThis.console == console)
@@ -0,0 +1,14 @@
+let p = new Promise((resolve) => {
+	console.log("executor")
+	resolve(1)
+})
+p.then((v) => {
+	console.log("then", v)
+	return v + 1
+}).then((v) => {
+	console.log("then", v)
+	throw "fail"
+}).catch((e) => {
+	console.log("catch", e)
+})
+console.log("sync done")
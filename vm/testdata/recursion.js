@@ -0,0 +1,45 @@
+function forever(n) {
+	return forever(n + 1) + 1
+}
+try {
+	forever(0)
+} catch (e) {
+	console.log("caught", e)
+}
+
+function countDown(n) {
+	"use strict"
+	if (n === 0) {
+		return "done"
+	}
+	return countDown(n - 1)
+}
+console.log(countDown(100000))
+
+const obj = {
+	depth(n) {
+		"use strict"
+		if (n === 0) {
+			return this === obj
+		}
+		return (this.depth(n - 1))
+	}
+}
+console.log(obj.depth(50000))
+
+function notTail(n) {
+	"use strict"
+	try {
+		if (n === 0) {
+			return "ok"
+		}
+		return notTail(n - 1)
+	} finally {
+	}
+}
+try {
+	notTail(100000)
+} catch (e) {
+	console.log("caught", e)
+}
+console.log(notTail(10))
@@ -0,0 +1,85 @@
+console.log(hoisted(), typeof later, typeof missing)
+function hoisted() {
+	return "hoisted"
+}
+var later = 1
+
+let shadow = "global"
+{
+	let shadow = "block"
+	function inBlock() {
+		return shadow
+	}
+	console.log(inBlock())
+}
+console.log(shadow)
+
+function vars() {
+	if (true) {
+		var v = "function scoped"
+	}
+	return v
+}
+console.log(vars())
+
+implicitGlobal = "created"
+console.log(globalThis.implicitGlobal, delete implicitGlobal, typeof implicitGlobal)
+
+function sloppyThis() {
+	return this == globalThis
+}
+function strictThis() {
+	"use strict"
+	return typeof this
+}
+console.log(sloppyThis(), strictThis())
+
+let obj = {
+	name: "obj",
+	method: function () {
+		let arrow = () => this.name
+		return arrow()
+	}
+}
+console.log(obj.method())
+
+let shared = []
+for (let i = 0; i < 3; i++) {
+	let copy = i
+	shared.push(() => copy)
+}
+console.log(shared[0](), shared[1](), shared[2]())
+
+function params(a, b, a2) {
+	var a = a + 1
+	return a + b + a2
+}
+console.log(params(1, 2, 3))
+
+let named = function self() {
+	return typeof self
+}
+console.log(named(), typeof self)
+
+let methods = {
+	m() {
+		return typeof m
+	}
+}
+console.log(methods.m())
+
+try {
+	throw "e1"
+} catch (e) {
+	let inner = e + "!"
+	console.log(inner)
+}
+
+const PI = 3
+console.log(PI * 2)
+
+let loopClosures = []
+for (let i = 0; i < 3; i++) {
+	loopClosures.push(() => i)
+}
+console.log(loopClosures[0](), loopClosures[1](), loopClosures[2]())
@@ -0,0 +1,6 @@
+function f(o) {
+	return o.missing.field
+}
+console.log("before")
+f({})
+console.log("not reached")
@@ -0,0 +1,543 @@
+package vm
+
+import (
+	ast_interpreter "jsInterpreter/ast-interpreter"
+	"jsInterpreter/ast_parser"
+	"jsInterpreter/logger"
+)
+
+// 块级作用域和函数作用域在运行时的环境，变量按编译时确定的位置存放
+type Env struct {
+	Slots  []ast_interpreter.JsValue
+	Parent *Env
+	info   *ScopeInfo
+}
+
+func newEnv(info *ScopeInfo, parent *Env) *Env {
+	slots := make([]ast_interpreter.JsValue, len(info.init))
+	copy(slots, info.init)
+	return &Env{Slots: slots, Parent: parent, info: info}
+}
+
+/*
+字节码函数，作为JsValue时类型是Function，实现了Callable，
+树遍历解释器和内置函数(例如promise的回调)可以像普通函数一样调用它
+*/
+type Closure struct {
+	Proto *FunctionProto
+	Env   *Env
+	//箭头函数创建时外层的this
+	this ast_interpreter.JsValue
+	vm   *VM
+}
+
+func (c *Closure) Call(this ast_interpreter.JsValue, args []ast_interpreter.JsValue) *ast_interpreter.JsValue {
+	return c.vm.call(c, this, args)
+}
+
+type handler struct {
+	pc   int
+	kind byte
+	//进入try时栈的高度和环境，异常时恢复
+	sp  int
+	env *Env
+}
+
+type frame struct {
+	closure  *Closure
+	pc       int
+	base     int
+	env      *Env
+	this     ast_interpreter.JsValue
+	handlers []handler
+	//进入这个函数之前的调用层数，离开时恢复
+	depth int
+}
+
+// finally的异常路径上保存在栈上的原来的异常，RETHROW时重新抛出
+type pendingException struct {
+	err interface{}
+}
+
+/*
+栈式虚拟机，和树遍历解释器共享InterpreterStat：属性访问、运算符和函数调用使用同样的实现，
+顶层的声明同样存放在stat.Scope中
+JS函数之间的调用不会增加Go的调用栈，只有经过内置函数或者其他引擎时才会嵌套执行
+*/
+type VM struct {
+	stat    *ast_interpreter.InterpreterStat
+	globals *ast_interpreter.Scope
+	stack   []ast_interpreter.JsValue
+	frames  []*frame
+}
+
+func New(stat *ast_interpreter.InterpreterStat) *VM {
+	return &VM{stat: stat, globals: stat.Scope}
+}
+
+// 执行编译好的程序，没有被catch的异常会panic
+func (vm *VM) Run(program *FunctionProto) *ast_interpreter.JsValue {
+	return vm.call(&Closure{Proto: program, vm: vm}, ast_interpreter.JsValue{Type: ast_interpreter.Undefined}, nil)
+}
+
+func (vm *VM) call(closure *Closure, this ast_interpreter.JsValue, args []ast_interpreter.JsValue) *ast_interpreter.JsValue {
+	stat := vm.stat
+	scope, strict := stat.Scope, stat.Strict
+	base, height := len(vm.frames), len(vm.stack)
+	defer func() {
+		stat.Scope, stat.Strict = scope, strict
+		if len(vm.frames) > base {
+			stat.Runtime.LeaveCall(vm.frames[base].depth)
+		}
+		vm.frames = vm.frames[:base]
+		vm.stack = vm.stack[:height]
+	}()
+	stat.Scope = vm.globals
+	vm.pushFrame(closure, this, args, height)
+	result := vm.run(base)
+	return &result
+}
+
+/*
+进入函数：创建函数的环境，写入参数，sp是调用结束后栈恢复到的高度
+JS函数之间的调用不增加Go的调用栈，但是同样计入调用层数，无限递归时抛出RangeError而不是耗尽内存
+*/
+func (vm *VM) pushFrame(closure *Closure, this ast_interpreter.JsValue, args []ast_interpreter.JsValue, sp int) {
+	depth := vm.stat.Runtime.EnterCall()
+	proto := closure.Proto
+	env := closure.Env
+	if proto.Scope != nil {
+		env = newEnv(proto.Scope, env)
+		for i, slot := range proto.ParamSlots {
+			if i < len(args) {
+				env.Slots[slot] = args[i]
+			}
+		}
+		if proto.NameSlot >= 0 {
+			env.Slots[proto.NameSlot] = ast_interpreter.JsValue{Value: closure, Type: ast_interpreter.Function}
+		}
+	}
+	if proto.Arrow {
+		this = closure.this
+	} else if !proto.Strict && (this.Type == ast_interpreter.Undefined || this.Type == ast_interpreter.Null) {
+		//非严格模式的函数中this为undefined或null时使用全局对象
+		this = *vm.stat.Runtime.Global
+	}
+	vm.stack = vm.stack[:sp]
+	vm.frames = append(vm.frames, &frame{closure: closure, base: sp, env: env, this: this, depth: depth})
+	vm.stat.Strict = proto.Strict
+}
+
+// 执行到第base个frame返回，异常被catch后从handler处继续执行
+func (vm *VM) run(base int) ast_interpreter.JsValue {
+	for {
+		if result, done := vm.execute(base); done {
+			return result
+		}
+	}
+}
+
+func (vm *VM) push(v ast_interpreter.JsValue) {
+	vm.stack = append(vm.stack, v)
+}
+
+func (vm *VM) pop() ast_interpreter.JsValue {
+	n := len(vm.stack) - 1
+	v := vm.stack[n]
+	vm.stack = vm.stack[:n]
+	return v
+}
+
+func (vm *VM) peek() *ast_interpreter.JsValue {
+	return &vm.stack[len(vm.stack)-1]
+}
+
+func u16(code []byte, pc int) int {
+	return int(code[pc]) | int(code[pc+1])<<8
+}
+
+func tdzError(env *Env, index int) ast_interpreter.RuntimeError {
+	return ast_interpreter.NewRuntimeError(logger.Loc{}, "ReferenceError: Cannot access '"+env.info.Names[index]+"' before initialization")
+}
+
+func (vm *VM) execute(base int) (result ast_interpreter.JsValue, done bool) {
+	stat := vm.stat
+	f := vm.frames[len(vm.frames)-1]
+	proto := f.closure.Proto
+	code := proto.Code
+	pc := f.pc
+	//正在执行的指令的位置，出错时用来找到源代码的位置
+	ip := pc
+	defer func() {
+		if err := recover(); err != nil {
+			vm.handle(err, proto.loc(ip), base)
+		}
+	}()
+
+	for {
+		ip = pc
+		stat.Runtime.Step()
+		op := Opcode(code[pc])
+		pc++
+		switch op {
+		case OpConstant:
+			vm.push(proto.Constants[u16(code, pc)])
+			pc += 2
+		case OpUndefined:
+			vm.push(ast_interpreter.JsValue{Type: ast_interpreter.Undefined})
+		case OpNull:
+			vm.push(ast_interpreter.JsValue{Type: ast_interpreter.Null})
+		case OpTrue:
+			vm.push(ast_interpreter.JsValue{Value: true, Type: ast_interpreter.Boolean})
+		case OpFalse:
+			vm.push(ast_interpreter.JsValue{Value: false, Type: ast_interpreter.Boolean})
+		case OpPop:
+			vm.stack = vm.stack[:len(vm.stack)-1]
+		case OpDup:
+			vm.push(*vm.peek())
+		case OpDup2:
+			n := len(vm.stack)
+			vm.stack = append(vm.stack, vm.stack[n-2], vm.stack[n-1])
+		case OpSwap:
+			s := vm.stack[len(vm.stack)-2:]
+			s[0], s[1] = s[1], s[0]
+		case OpRot3:
+			s := vm.stack[len(vm.stack)-3:]
+			s[0], s[1], s[2] = s[2], s[0], s[1]
+		case OpRot4:
+			s := vm.stack[len(vm.stack)-4:]
+			s[0], s[1], s[2], s[3] = s[3], s[0], s[1], s[2]
+		case OpThis:
+			vm.push(f.this)
+
+		case OpGetVar, OpSetVar, OpInitVar, OpSetConst:
+			env := f.env
+			for depth := code[pc]; depth > 0; depth-- {
+				env = env.Parent
+			}
+			index := u16(code, pc+1)
+			pc += 3
+			if op == OpInitVar {
+				env.Slots[index] = vm.pop()
+				continue
+			}
+			if env.Slots[index].Type == ast_interpreter.Uninitialized {
+				panic(tdzError(env, index))
+			}
+			switch op {
+			case OpGetVar:
+				vm.push(env.Slots[index])
+			case OpSetVar:
+				env.Slots[index] = *vm.peek()
+			default:
+				panic(ast_interpreter.NewRuntimeError(logger.Loc{}, "TypeError: Assignment to constant variable."))
+			}
+
+		case OpGetGlobal:
+			vm.push(*stat.ReadVariable(proto.Names[u16(code, pc)], logger.Loc{}))
+			pc += 2
+		case OpSetGlobal:
+			stat.AssignVariable(proto.Names[u16(code, pc)], vm.peek(), logger.Loc{})
+			pc += 2
+		case OpTypeofGlobal:
+			name := proto.Names[u16(code, pc)]
+			pc += 2
+			typeof := "undefined"
+			if stat.LookupVariable(name) != nil {
+				typeof = ast_interpreter.TypeOf(stat.ReadVariable(name, logger.Loc{}))
+			}
+			vm.push(ast_interpreter.JsValue{Value: typeof, Type: ast_interpreter.String})
+		case OpDeleteGlobal:
+			//非严格模式下赋值创建的全局变量是全局对象的属性，可以删除
+			name := proto.Names[u16(code, pc)]
+			pc += 2
+			if vm.globals.Get(name) != nil {
+				vm.push(ast_interpreter.JsValue{Value: false, Type: ast_interpreter.Boolean})
+			} else {
+				vm.push(ast_interpreter.JsValue{Value: ast_interpreter.DeleteProperty(stat.Runtime.Global, name, logger.Loc{}), Type: ast_interpreter.Boolean})
+			}
+		case OpDeclareGlobal:
+			name := proto.Names[u16(code, pc)]
+			kind := code[pc+2]
+			pc += 3
+			value := vm.pop()
+			vm.globals.Declare(name, &value)
+			if kind != declareFunction {
+				vm.globals.SetConst(name, kind == declareConst)
+			}
+		case OpHoistGlobal:
+			name := proto.Names[u16(code, pc)]
+			kind := code[pc+2]
+			pc += 3
+			if kind == declareVar {
+				if _, has := vm.globals.Env[name]; !has {
+					vm.globals.Set(name, &ast_interpreter.JsValue{Type: ast_interpreter.Undefined})
+				}
+			} else {
+				vm.globals.DeclareUninitialized(name, kind == declareConst)
+			}
+
+		case OpGetProp:
+			obj := vm.pop()
+			vm.push(*stat.GetProperty(&obj, proto.Names[u16(code, pc)]))
+			pc += 2
+		case OpSetProp:
+			value := vm.pop()
+			obj := vm.pop()
+			stat.SetProperty(&obj, proto.Names[u16(code, pc)], &value)
+			vm.push(value)
+			pc += 2
+		case OpDeleteProp:
+			obj := vm.pop()
+			vm.push(ast_interpreter.JsValue{Value: ast_interpreter.DeleteProperty(&obj, proto.Names[u16(code, pc)], logger.Loc{}), Type: ast_interpreter.Boolean})
+			pc += 2
+		case OpGetIndex:
+			key := vm.pop()
+			obj := vm.pop()
+			vm.push(*stat.GetProperty(&obj, ast_interpreter.ToPropertyKey(&key)))
+		case OpSetIndex:
+			value := vm.pop()
+			key := vm.pop()
+			obj := vm.pop()
+			stat.SetProperty(&obj, ast_interpreter.ToPropertyKey(&key), &value)
+			vm.push(value)
+		case OpDeleteIndex:
+			key := vm.pop()
+			obj := vm.pop()
+			vm.push(ast_interpreter.JsValue{Value: ast_interpreter.DeleteProperty(&obj, ast_interpreter.ToPropertyKey(&key), logger.Loc{}), Type: ast_interpreter.Boolean})
+
+		case OpBinary:
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(ast_interpreter.BinaryOperation(ast_parser.EOp(code[pc]), left, right, logger.Loc{}, stat))
+			pc++
+		case OpUnary:
+			value := vm.pop()
+			vm.push(ast_interpreter.UnaryOperation(ast_parser.EOp(code[pc]), value, logger.Loc{}))
+			pc++
+		case OpUpdate:
+			value := vm.pop()
+			vm.push(ast_interpreter.UpdateOperation(ast_parser.EOp(code[pc]), value, logger.Loc{}))
+			pc++
+
+		case OpJump:
+			pc = u16(code, pc)
+		case OpJumpIfFalse:
+			if value := vm.pop(); ast_interpreter.IsTruthy(value) {
+				pc += 2
+			} else {
+				pc = u16(code, pc)
+			}
+		case OpJumpIfFalseOrPop, OpJumpIfTrueOrPop, OpJumpIfNotNullishOrPop:
+			value := vm.peek()
+			var jump bool
+			switch op {
+			case OpJumpIfFalseOrPop:
+				jump = !ast_interpreter.IsTruthy(*value)
+			case OpJumpIfTrueOrPop:
+				jump = ast_interpreter.IsTruthy(*value)
+			default:
+				jump = value.Type != ast_interpreter.Undefined && value.Type != ast_interpreter.Null
+			}
+			if jump {
+				pc = u16(code, pc)
+			} else {
+				vm.stack = vm.stack[:len(vm.stack)-1]
+				pc += 2
+			}
+
+		case OpCall, OpTailCall:
+			argc := int(code[pc])
+			pc++
+			n := len(vm.stack)
+			sp := n - argc - 2
+			this, callee := vm.stack[sp], vm.stack[sp+1]
+			//同一个虚拟机中的函数直接进入新的frame，尾调用时新的frame代替当前的frame
+			if closure, isClosure := callee.Value.(*Closure); isClosure && closure.vm == vm {
+				if op == OpTailCall {
+					vm.frames = vm.frames[:len(vm.frames)-1]
+					stat.Runtime.LeaveCall(f.depth)
+					sp = f.base
+				} else {
+					f.pc = pc
+				}
+				vm.pushFrame(closure, this, vm.stack[n-argc:], sp)
+				f = vm.frames[len(vm.frames)-1]
+				proto, code, pc = closure.Proto, closure.Proto.Code, 0
+				continue
+			}
+			if callee.Type != ast_interpreter.Function && callee.Type != ast_interpreter.BuiltInFunction && callee.Type != ast_interpreter.BuiltInClass {
+				panic(ast_interpreter.NewRuntimeError(logger.Loc{}, " is not a function"))
+			}
+			args := make([]ast_interpreter.JsValue, argc)
+			copy(args, vm.stack[n-argc:])
+			vm.stack = vm.stack[:sp]
+			stat.Runtime.CallSite = proto.loc(ip)
+			vm.push(*stat.CallFunction(&callee, this, args))
+		case OpNew:
+			argc := int(code[pc])
+			pc++
+			n := len(vm.stack)
+			args := make([]ast_interpreter.JsValue, argc)
+			copy(args, vm.stack[n-argc:])
+			callee := vm.stack[n-argc-1]
+			vm.stack = vm.stack[:n-argc-1]
+			if closure, isClosure := callee.Value.(*Closure); isClosure && closure.Proto.Arrow {
+				panic(ast_interpreter.NewRuntimeError(logger.Loc{}, "TypeError: "+ast_interpreter.ToString(&callee).Value.(string)+" is not a constructor"))
+			}
+			vm.push(*stat.Construct(&callee, args, proto.loc(ip)))
+		case OpReturn:
+			value := vm.pop()
+			vm.stack = vm.stack[:f.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			stat.Runtime.LeaveCall(f.depth)
+			if len(vm.frames) == base {
+				return value, true
+			}
+			f = vm.frames[len(vm.frames)-1]
+			proto, code, pc = f.closure.Proto, f.closure.Proto.Code, f.pc
+			stat.Strict = proto.Strict
+			vm.push(value)
+		case OpClosure:
+			closure := &Closure{Proto: proto.Functions[u16(code, pc)], Env: f.env, vm: vm}
+			pc += 2
+			if closure.Proto.Arrow {
+				closure.this = f.this
+			}
+			vm.push(ast_interpreter.JsValue{Value: closure, Type: ast_interpreter.Function})
+		case OpThrow:
+			panic(ast_interpreter.JsException{Loc: proto.loc(ip), Value: vm.pop()})
+		case OpRethrow:
+			panic(vm.pop().Value.(pendingException).err)
+		case OpPushHandler:
+			f.handlers = append(f.handlers, handler{pc: u16(code, pc), kind: code[pc+2], sp: len(vm.stack), env: f.env})
+			pc += 3
+		case OpPopHandler:
+			f.handlers = f.handlers[:len(f.handlers)-1]
+		case OpPushEnv:
+			f.env = newEnv(proto.Scopes[u16(code, pc)], f.env)
+			pc += 2
+		case OpPopEnv:
+			f.env = f.env.Parent
+		case OpCopyEnv:
+			f.env = &Env{Slots: append([]ast_interpreter.JsValue(nil), f.env.Slots...), Parent: f.env.Parent, info: f.env.info}
+
+		case OpArray:
+			n := u16(code, pc)
+			pc += 2
+			stat.Runtime.AllocArray(n)
+			items := make([]*ast_interpreter.JsValue, n)
+			values := make([]ast_interpreter.JsValue, n)
+			copy(values, vm.stack[len(vm.stack)-n:])
+			for i := range values {
+				items[i] = &values[i]
+			}
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(ast_interpreter.JsValue{Value: &ast_interpreter.JsArray{Arr: items, Length: uint(n)}, Type: ast_interpreter.Array})
+		case OpObject:
+			stat.Runtime.AllocObject(0)
+			obj := &ast_interpreter.JsObject{Proto: &ast_interpreter.ObjectPrototype}
+			vm.push(ast_interpreter.JsValue{Value: obj, Type: ast_interpreter.Object})
+		case OpDefineProp:
+			value := vm.pop()
+			key := vm.pop()
+			kind := code[pc]
+			pc++
+			obj := vm.peek().Value.(*ast_interpreter.JsObject)
+			k := ast_interpreter.ToPropertyKey(&key)
+			stat.Runtime.AllocProperty()
+			if kind == propertyData {
+				obj.Set(k, &value)
+				continue
+			}
+			//get和set合并成同一个访问器属性
+			accessor := &ast_interpreter.JsAccessor{}
+			if prev, has := obj.Get(k); has && prev.Type == ast_interpreter.Accessor {
+				*accessor = *prev.Value.(*ast_interpreter.JsAccessor)
+			}
+			if kind == propertyGet {
+				accessor.Get = &value
+			} else {
+				accessor.Set = &value
+			}
+			obj.Set(k, &ast_interpreter.JsValue{Value: accessor, Type: ast_interpreter.Accessor})
+		case OpSetProto:
+			value := vm.pop()
+			obj := vm.peek().Value.(*ast_interpreter.JsObject)
+			switch value.Type {
+			case ast_interpreter.Object:
+				obj.Proto = &value
+			case ast_interpreter.Null:
+				obj.Proto = nil
+			}
+		default:
+			panic("unknown opcode " + op.String())
+		}
+	}
+}
+
+/*
+处理执行中抛出的异常：没有位置信息时补上出错指令的位置，
+从最内层的frame开始找handler，catch得到抛出的值，finally得到原来的异常，
+这次run的frame中都没有handler时继续向外panic
+*/
+func (vm *VM) handle(err interface{}, loc logger.Loc, base int) {
+	switch e := err.(type) {
+	case ast_interpreter.RuntimeError:
+		if e.Loc == (logger.Loc{}) {
+			e.Loc = loc
+		}
+		err = e
+	case ast_interpreter.JsException:
+		if e.Loc == (logger.Loc{}) {
+			e.Loc = loc
+		}
+		err = e
+	case ast_interpreter.LimitError:
+		if e.Loc == (logger.Loc{}) {
+			e.Loc = loc
+		}
+		err = e
+	}
+	value, _, thrown := ast_interpreter.ThrownValue(err)
+	if !thrown {
+		panic(err)
+	}
+	for len(vm.frames) > base {
+		f := vm.frames[len(vm.frames)-1]
+		if n := len(f.handlers); n > 0 {
+			h := f.handlers[n-1]
+			f.handlers = f.handlers[:n-1]
+			vm.stack = vm.stack[:h.sp]
+			f.env = h.env
+			f.pc = h.pc
+			if h.kind == handlerCatch {
+				vm.push(value)
+			} else {
+				vm.push(ast_interpreter.JsValue{Value: pendingException{err}, Type: ast_interpreter.Undefined})
+			}
+			vm.stat.Strict = f.closure.Proto.Strict
+			return
+		}
+		vm.frames = vm.frames[:len(vm.frames)-1]
+		vm.stat.Runtime.LeaveCall(f.depth)
+	}
+	panic(err)
+}
+
+/*
+CodeRunner使用的引擎，runner.SetEngine(vm.Engine{})之后代码由字节码虚拟机执行
+虚拟机不支持的语法(例如generator和class)和语法错误一样在执行之前报告
+*/
+type Engine struct{}
+
+func (Engine) Compile(program *ast_parser.Stmt) (func(stat *ast_interpreter.InterpreterStat) ast_interpreter.Completion, []logger.Diagnostic) {
+	proto, diagnostics := Compile(program)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
+	}
+	return func(stat *ast_interpreter.InterpreterStat) ast_interpreter.Completion {
+		New(stat).Run(proto)
+		return ast_interpreter.Completion{}
+	}, nil
+}
@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	ast_interpreter "jsInterpreter/ast-interpreter"
+	"jsInterpreter/ast_parser"
+	"os"
+	"path/filepath"
+	"strings"
+	t "testing"
+	"time"
+)
+
+// 执行一段代码，engine为nil时使用树遍历解释器，返回打印到标准输出的内容
+func run(code string, engine ast_interpreter.Engine) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		output <- b.String()
+	}()
+	runner := ast_interpreter.NewCodeRunner(nil)
+	runner.SetEngine(engine)
+	runner.Run(code)
+	os.Stdout = stdout
+	w.Close()
+	return <-output
+}
+
+// testdata中的脚本在虚拟机和树遍历解释器中的输出都应该和同名的.out文件相同
+func TestSameOutput(t *t.T) {
+	files, _ := filepath.Glob("testdata/*.js")
+	if len(files) == 0 {
+		t.Fatal("no test scripts")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := os.ReadFile(strings.TrimSuffix(file, ".js") + ".out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		engines := map[string]ast_interpreter.Engine{"interpreter": nil, "vm": Engine{}}
+		for name, engine := range engines {
+			if got := run(string(data), engine); got != string(expected) {
+				t.Errorf("%s (%s): expected\n%s\ngot\n%s", file, name, expected, got)
+			}
+		}
+	}
+}
+
+//undefined、NaN和Infinity是全局对象上的只读属性
+func TestGlobalConstants(t *t.T) {
+	code := `let a = undefined
+console.log(a, typeof NaN, NaN == NaN, Infinity, -Infinity)
+undefined = 1
+console.log(undefined, delete globalThis.NaN, NaN)
+function f() { "use strict"; try { Infinity = 1 } catch (e) { return e } }
+console.log(f())
+`
+	expected := "undefined\nnumber\nfalse\nInfinity\n-Infinity\nundefined\nfalse\nNaN\n" +
+		"TypeError: Cannot assign to read only property 'Infinity' of object\n"
+	if got := run(code, Engine{}); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestUnsupported(t *t.T) {
+	cases := map[string]string{
+		"function* g() {}":      "generator function",
+		"async function f() {}": "async function",
+		"class A {}":            "class",
+	}
+	for code, expected := range cases {
+		p := ast_parser.NewParser(code)
+		ast, _ := p.Parse()
+		_, diagnostics := Compile(&ast)
+		if len(diagnostics) == 0 || !strings.Contains(diagnostics[0].Msg, expected) {
+			t.Errorf("%q: expected diagnostic about %s, got %v", code, expected, diagnostics)
+		}
+	}
+}
+
+func TestDisassemble(t *t.T) {
+	p := ast_parser.NewParser("let count = 0\nfunction inc() { count = count + 1 }\ninc()")
+	ast, _ := p.Parse()
+	proto, diagnostics := Compile(&ast)
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	code := proto.Disassemble()
+	for _, expected := range []string{"== <program> ==", "== inc ==", "CLOSURE 0 ; inc", "CALL 0", "RETURN"} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("expected %q in\n%s", expected, code)
+		}
+	}
+}
+
+func TestLimits(t *t.T) {
+	cases := []struct {
+		code   string
+		limits ast_interpreter.Limits
+		err    error
+	}{
+		{"for (;;) {}", ast_interpreter.Limits{MaxSteps: 10000}, ast_interpreter.ErrStepLimit},
+		{"function f() { try { for (;;) {} } finally { return 1 } }\nf()", ast_interpreter.Limits{MaxSteps: 10000}, ast_interpreter.ErrStepLimit},
+		{"let a = []\nfor (let i = 0; ; i++) { a[i] = { value: i } }", ast_interpreter.Limits{MaxHeap: 1 << 20}, ast_interpreter.ErrHeapLimit},
+		{"let n = 0\nfor (let i = 0; i < 100; i++) { n = n + i }", ast_interpreter.Limits{MaxSteps: 10000}, nil},
+	}
+	for _, c := range cases {
+		runner := ast_interpreter.NewCodeRunner(nil)
+		runner.SetEngine(Engine{})
+		runner.SetLimits(c.limits)
+		if err := runner.Run(c.code); !errors.Is(err, c.err) || (c.err == nil && err != nil) {
+			t.Errorf("%q: expected %v, got %v", c.code, c.err, err)
+		}
+	}
+}
+
+func TestInterrupt(t *t.T) {
+	runner := ast_interpreter.NewCodeRunner(nil)
+	runner.SetEngine(Engine{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		runner.Interrupt("stop")
+	}()
+	if err := runner.Run("for (;;) {}"); !errors.As(err, &ast_interpreter.InterruptError{}) {
+		t.Errorf("expected InterruptError, got %v", err)
+	}
+}